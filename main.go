@@ -1,14 +1,34 @@
 package main
 
 import (
+	"github.com/NerdShoreDev/YEP/server/pkg/admin"
 	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	clientRepository "github.com/NerdShoreDev/YEP/server/pkg/client/repository"
+	"github.com/NerdShoreDev/YEP/server/pkg/config"
+	consentRepository "github.com/NerdShoreDev/YEP/server/pkg/consent/repository"
+	credentialRepository "github.com/NerdShoreDev/YEP/server/pkg/credential/repository"
+	"github.com/NerdShoreDev/YEP/server/pkg/envelope"
+	eventRepository "github.com/NerdShoreDev/YEP/server/pkg/event/repository"
+	groupRepository "github.com/NerdShoreDev/YEP/server/pkg/group/repository"
+	keyRepository "github.com/NerdShoreDev/YEP/server/pkg/key/repository"
+	"github.com/NerdShoreDev/YEP/server/pkg/lockout"
+	failureRepository "github.com/NerdShoreDev/YEP/server/pkg/lockout/repository"
 	moduleFactory "github.com/NerdShoreDev/YEP/server/pkg/module/factory"
 	moduleHandler "github.com/NerdShoreDev/YEP/server/pkg/module/handler"
 	moduleRepository "github.com/NerdShoreDev/YEP/server/pkg/module/repository"
+	"github.com/NerdShoreDev/YEP/server/pkg/oidc"
+	pairwiseRepository "github.com/NerdShoreDev/YEP/server/pkg/pairwise/repository"
+	"github.com/NerdShoreDev/YEP/server/pkg/password"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	realmRepository "github.com/NerdShoreDev/YEP/server/pkg/realm/repository"
 	registryFactory "github.com/NerdShoreDev/YEP/server/pkg/registry/factory"
 	registryHandler "github.com/NerdShoreDev/YEP/server/pkg/registry/handler"
 	registryRepository "github.com/NerdShoreDev/YEP/server/pkg/registry/repository"
+	roleRepository "github.com/NerdShoreDev/YEP/server/pkg/role/repository"
 	"github.com/NerdShoreDev/YEP/server/pkg/service"
+	"github.com/NerdShoreDev/YEP/server/pkg/theme"
+	userRepository "github.com/NerdShoreDev/YEP/server/pkg/user/repository"
+	"net/http"
 	"time"
 
 	"github.com/NerdShoreDev/YEP/server/pkg/http/rest"
@@ -78,9 +98,147 @@ func main() {
 	modulesHandler := moduleHandler.NewModulesHandler(modulesFactory, modulesRepository, serverValues)
 
 	// Initialize ServiceHandler & JWTHandler
-	jwtHandler := auth.NewJwtHandler(restClient, serverValues.AuthTokenValidationIssuer, serverValues.AuthTokenValidationAudience)
+	// Keys of the token issuer are cached, an unknown kid refetches them at most every 30 seconds
+	jwksClient := auth.NewJWKSClient(&http.Client{Timeout: 10 * time.Second}, serverValues.AuthBaseUrl, time.Hour, 30*time.Second)
+	jwtHandler := auth.NewJwtHandler(jwksClient, serverValues.AuthTokenValidationIssuer, serverValues.AuthTokenValidationAudience)
 	serviceHandler := service.NewService(jwtHandler, modulesHandler, registryHandler, restClient, serverValues)
 
+	// Load authorization server settings and the key encryption keys sealing secrets at rest
+	authConfig := config.NewConfig()
+	kekEntries, err := authConfig.KeyEncryptionKeys()
+	if err != nil {
+		log.Fatalf("Unable to read key encryption keys: %v", err)
+	}
+	keks, err := envelope.ParseKEKs(kekEntries)
+	if err != nil {
+		log.Fatalf("Unable to parse key encryption keys: %v", err)
+	}
+	keyWrapper, err := envelope.NewEnvelopeCipher(keks)
+	if err != nil {
+		log.Fatalf("Unable to set up key encryption: %v", err)
+	}
+
+	// Initialise Realm Storage, the protocol endpoints answer for enabled realms only
+	realmRepository := realmRepository.NewRealmStorage(dbWrapper)
+	if err := realmRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create realm indexes: %v", err)
+	}
+	for _, name := range []string{authConfig.AdminRealm, authConfig.BootstrapRealm} {
+		if name == "" {
+			continue
+		}
+		if err := realmRepository.EnsureRealm(&realmDto.Realm{Name: name, DisplayName: name, Enabled: true}); err != nil {
+			log.Errorf("Unable to create realm %s: %v", name, err)
+		}
+	}
+
+	// Initialise Client Storage, the protocol endpoints only serve registered clients
+	clientRepository := clientRepository.NewClientStorage(dbWrapper)
+	if err := clientRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create client indexes: %v", err)
+	}
+
+	// Initialise User and Credential Storage, logins check the users' passwords and are throttled per realm
+	userRepository := userRepository.NewUserStorage(dbWrapper)
+	if err := userRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create user indexes: %v", err)
+	}
+	credentialRepository := credentialRepository.NewCredentialStorage(dbWrapper)
+	if err := credentialRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create credential indexes: %v", err)
+	}
+	var breachedPasswords password.BreachedList
+	if authConfig.BreachedPasswordsFile != "" {
+		denylist, err := password.LoadBreachedPasswords(authConfig.BreachedPasswordsFile)
+		if err != nil {
+			log.Fatalf("Unable to load breached passwords: %v", err)
+		}
+		log.Infof("Loaded %d breached passwords", denylist.Len())
+		breachedPasswords = denylist
+	}
+	passwordAuthenticator := password.NewPasswordAuthenticator(realmRepository, userRepository, credentialRepository, breachedPasswords)
+	eventRepository := eventRepository.NewEventStorage(dbWrapper)
+	if err := eventRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create event indexes: %v", err)
+	}
+	failureRepository := failureRepository.NewFailureStorage(dbWrapper)
+	if err := failureRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create login failure indexes: %v", err)
+	}
+	bruteForceProtector := lockout.NewBruteForceProtector(realmRepository, userRepository, failureRepository, eventRepository, passwordAuthenticator)
+
+	// Initialise Consent Storage and the protocol endpoints
+	consentRepository := consentRepository.NewConsentStorage(dbWrapper)
+	if err := consentRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create consent indexes: %v", err)
+	}
+	pairwiseRepository := pairwiseRepository.NewPairwiseStorage(dbWrapper)
+	if err := pairwiseRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create pairwise subject indexes: %v", err)
+	}
+	subjects := oidc.NewSubjectResolver(authConfig.PairwiseSalt, pairwiseRepository, &http.Client{Timeout: 10 * time.Second})
+	clients := oidc.NewClientRegistry(clientRepository)
+	claimsEngine := oidc.NewClaimsEngine(oidc.NewRealmScopeMappings(realmRepository), oidc.NewUserClaims(userRepository))
+	authorizationHandler := oidc.NewAuthorizationHandler(
+		clients,
+		consentRepository,
+		oidc.NewSessionStore(authConfig.SessionLifetime),
+		bruteForceProtector,
+		theme.NewThemes(authConfig.ThemesDir),
+		oidc.NewAuthorizationDetailsValidator(oidc.NewRealmAuthorizationDetailTypes(realmRepository)),
+		claimsEngine,
+		subjects,
+	)
+
+	// Initialise Key Storage and rotate realm signing keys, keeping replaced keys published while tokens signed with them are valid
+	keyRepository := keyRepository.NewKeyStorage(dbWrapper)
+	if err := keyRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create signing key indexes: %v", err)
+	}
+	keyRetention := authConfig.AccessTokenLifetime
+	if authConfig.IDTokenLifetime > keyRetention {
+		keyRetention = authConfig.IDTokenLifetime
+	}
+	var keyBackend oidc.KeyBackend
+	if authConfig.SigningServiceURL != "" {
+		signingService := auth.NewRemoteSigningService(&http.Client{Timeout: 10 * time.Second}, authConfig.SigningServiceURL, authConfig.SigningServiceToken)
+		keyBackend = oidc.NewRemoteKeyBackend(signingService)
+	} else {
+		localKeyBackend := oidc.NewLocalKeyBackend(keyWrapper)
+		go func() {
+			if err := localKeyBackend.RewrapKeys(keyRepository); err != nil {
+				log.Errorf("Unable to rewrap signing keys: %v", err)
+			}
+		}()
+		keyBackend = localKeyBackend
+	}
+	keyManager := oidc.NewKeyManager(keyRepository, keyBackend, oidc.NewRealmSigningAlgorithms(realmRepository), authConfig.KeyRotationPeriod, keyRetention)
+	for _, keyFile := range authConfig.SigningKeyFiles {
+		signer, err := auth.LoadLocalSigner(keyFile.Path, keyFile.Algorithm)
+		if err != nil {
+			log.Fatalf("Unable to load signing key %s: %v", keyFile.Path, err)
+		}
+		if err := keyManager.ImportKey(keyFile.Realm, signer); err != nil {
+			log.Fatalf("Unable to import signing key %s: %v", keyFile.Path, err)
+		}
+	}
+	keyManager.StartRotation(time.Hour)
+
+	tokenIssuer := oidc.NewTokenIssuer(authConfig.IssuerBaseURL, keyManager, authConfig.AccessTokenLifetime, authConfig.IDTokenLifetime)
+	tokenHandler := oidc.NewTokenHandler(authorizationHandler, clients, claimsEngine, tokenIssuer, subjects)
+
+	// Initialise the admin API, accepting tokens the admin realm issued to the admin client
+	roleRepository := roleRepository.NewRoleStorage(dbWrapper)
+	if err := roleRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create role indexes: %v", err)
+	}
+	groupRepository := groupRepository.NewGroupStorage(dbWrapper)
+	if err := groupRepository.EnsureIndexes(); err != nil {
+		log.Errorf("Unable to create group indexes: %v", err)
+	}
+	adminAuthenticator := auth.NewJwtHandler(oidc.NewRealmKeyClient(keyManager, authConfig.AdminRealm), tokenIssuer.Issuer(authConfig.AdminRealm), authConfig.AdminClientID)
+	adminHandler := admin.NewAdminHandler(authConfig.AdminRealm, realmRepository, clientRepository, userRepository, credentialRepository, passwordAuthenticator, bruteForceProtector, eventRepository, roleRepository, groupRepository)
+
 	webServer := rest.NewWebServer(serverValues.AllowedOrigins)
-	webServer.StartWebServer(serviceHandler)
+	webServer.StartWebServer(serviceHandler, adminAuthenticator, oidc.NewRealmLoader(realmRepository), authorizationHandler, tokenHandler, keyManager, adminHandler)
 }
@@ -0,0 +1,310 @@
+package admin
+
+import (
+	"encoding/json"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	clientDto "github.com/NerdShoreDev/YEP/server/pkg/client/dto"
+	credentialDto "github.com/NerdShoreDev/YEP/server/pkg/credential/dto"
+	eventDto "github.com/NerdShoreDev/YEP/server/pkg/event/dto"
+	groupDto "github.com/NerdShoreDev/YEP/server/pkg/group/dto"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	roleDto "github.com/NerdShoreDev/YEP/server/pkg/role/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// AdminRole is the realm role of the admin realm granting access to the admin API
+const AdminRole = "admin"
+
+// Page sizes of list endpoints
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type RealmStore interface {
+	FindRealm(name string) (*realmDto.Realm, error)
+	FindRealms(query db.Query) ([]*realmDto.Realm, int64, error)
+	CreateRealm(realm *realmDto.Realm) error
+	UpdateRealm(realm *realmDto.Realm) error
+	DeleteRealm(name string) error
+}
+
+type ClientStore interface {
+	FindClient(realm string, clientID string) (*clientDto.Client, error)
+	FindClients(realm string, query db.Query) ([]*clientDto.Client, int64, error)
+	CreateClient(client *clientDto.Client) error
+	UpdateClient(client *clientDto.Client) error
+	UpdateClientSecrets(realm string, clientID string, secrets []clientDto.ClientSecret) error
+	DeleteClient(realm string, clientID string) error
+	DeleteClients(realm string) error
+}
+
+type UserStore interface {
+	FindUser(realm string, id string) (*userDto.User, error)
+	FindUsers(realm string, query db.Query) ([]*userDto.User, int64, error)
+	CreateUser(user *userDto.User) error
+	UpdateUser(user *userDto.User) error
+	RemoveRealmRole(realm string, role string) error
+	RemoveGroup(realm string, groupID string) error
+	DeleteUser(realm string, id string) error
+	DeleteUsers(realm string) error
+}
+
+type CredentialStore interface {
+	FindCredentials(realm string, userID string, credentialType string) ([]*credentialDto.Credential, error)
+	DeleteCredential(realm string, userID string, id string) error
+	DeleteUserCredentials(realm string, userID string) error
+	DeleteCredentials(realm string) error
+}
+
+type PasswordSetter interface {
+	SetPassword(realm string, user *userDto.User, password string) error
+}
+
+type Unlocker interface {
+	Unlock(realm string, user *userDto.User, actor string) error
+}
+
+type EventStore interface {
+	FindEvents(realm string, query db.Query) ([]*eventDto.Event, int64, error)
+}
+
+type RoleStore interface {
+	FindRole(realm string, name string) (*roleDto.Role, error)
+	FindRoles(realm string, query db.Query) ([]*roleDto.Role, int64, error)
+	CreateRole(role *roleDto.Role) error
+	UpdateRole(role *roleDto.Role) error
+	DeleteRole(realm string, name string) error
+	DeleteRoles(realm string) error
+}
+
+type GroupStore interface {
+	FindGroup(realm string, id string) (*groupDto.Group, error)
+	FindGroups(realm string, query db.Query) ([]*groupDto.Group, int64, error)
+	CreateGroup(group *groupDto.Group) error
+	UpdateGroup(group *groupDto.Group) error
+	RemoveRealmRole(realm string, role string) error
+	DeleteGroup(realm string, id string) error
+	DeleteGroups(realm string) error
+}
+
+// Page is the response of the list endpoints
+type Page struct {
+	Items  interface{} `json:"items"`
+	Total  int64       `json:"total"`
+	Offset int64       `json:"offset"`
+	Limit  int64       `json:"limit"`
+}
+
+// filter is a query parameter of a list endpoint selecting the documents whose field of the same name matches exactly
+type filter struct {
+	name  string
+	parse func(value string) (interface{}, error)
+}
+
+type adminHandler struct {
+	adminRealm  string
+	realms      RealmStore
+	clients     ClientStore
+	users       UserStore
+	credentials CredentialStore
+	passwords   PasswordSetter
+	lockouts    Unlocker
+	events      EventStore
+	roles       RoleStore
+	groups      GroupStore
+}
+
+// NewAdminHandler creates the admin API. Callers need the admin role in the admin realm.
+func NewAdminHandler(adminRealm string, realms RealmStore, clients ClientStore, users UserStore, credentials CredentialStore, passwords PasswordSetter, lockouts Unlocker, events EventStore, roles RoleStore, groups GroupStore) *adminHandler {
+	return &adminHandler{
+		adminRealm:  adminRealm,
+		realms:      realms,
+		clients:     clients,
+		users:       users,
+		credentials: credentials,
+		passwords:   passwords,
+		lockouts:    lockouts,
+		events:      events,
+		roles:       roles,
+		groups:      groups,
+	}
+}
+
+// RegisterRoutes adds the admin API to the router, which has to authenticate the caller and put the principal into the request context
+func (ah *adminHandler) RegisterRoutes(router *mux.Router) {
+	router.Use(ah.requireAdmin)
+	router.HandleFunc("/realms", ah.listRealms).Methods(http.MethodGet)
+	router.HandleFunc("/realms", ah.createRealm).Methods(http.MethodPost)
+	router.HandleFunc("/realms/{realm}", ah.getRealm).Methods(http.MethodGet)
+	router.HandleFunc("/realms/{realm}", ah.updateRealm).Methods(http.MethodPut)
+	router.HandleFunc("/realms/{realm}", ah.deleteRealm).Methods(http.MethodDelete)
+
+	realmRouter := router.PathPrefix("/realms/{realm}").Subrouter()
+	realmRouter.Use(ah.requireRealm)
+	realmRouter.HandleFunc("/clients", ah.listClients).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/clients", ah.createClient).Methods(http.MethodPost)
+	realmRouter.HandleFunc("/clients/{clientId}", ah.getClient).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/clients/{clientId}", ah.updateClient).Methods(http.MethodPut)
+	realmRouter.HandleFunc("/clients/{clientId}", ah.deleteClient).Methods(http.MethodDelete)
+	realmRouter.HandleFunc("/clients/{clientId}/secret", ah.rotateClientSecret).Methods(http.MethodPost)
+	realmRouter.HandleFunc("/users", ah.listUsers).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/users", ah.createUser).Methods(http.MethodPost)
+	realmRouter.HandleFunc("/users/{id}", ah.getUser).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/users/{id}", ah.updateUser).Methods(http.MethodPut)
+	realmRouter.HandleFunc("/users/{id}", ah.deleteUser).Methods(http.MethodDelete)
+	realmRouter.HandleFunc("/users/{id}/password", ah.setPassword).Methods(http.MethodPut)
+	realmRouter.HandleFunc("/users/{id}/lockout", ah.unlockUser).Methods(http.MethodDelete)
+	realmRouter.HandleFunc("/users/{id}/credentials", ah.listCredentials).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/users/{id}/credentials/{credentialId}", ah.deleteCredential).Methods(http.MethodDelete)
+	realmRouter.HandleFunc("/events", ah.listEvents).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/roles", ah.listRoles).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/roles", ah.createRole).Methods(http.MethodPost)
+	realmRouter.HandleFunc("/roles/{role}", ah.getRole).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/roles/{role}", ah.updateRole).Methods(http.MethodPut)
+	realmRouter.HandleFunc("/roles/{role}", ah.deleteRole).Methods(http.MethodDelete)
+	realmRouter.HandleFunc("/groups", ah.listGroups).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/groups", ah.createGroup).Methods(http.MethodPost)
+	realmRouter.HandleFunc("/groups/{id}", ah.getGroup).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/groups/{id}", ah.updateGroup).Methods(http.MethodPut)
+	realmRouter.HandleFunc("/groups/{id}", ah.deleteGroup).Methods(http.MethodDelete)
+}
+
+// requireAdmin lets callers pass who have the admin role in the admin realm
+func (ah *adminHandler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFrom(r.Context())
+		if !ok {
+			WriteError(w, NewError(http.StatusUnauthorized, ErrorUnauthorized, "authentication required"))
+			return
+		}
+		admin, err := ah.isAdmin(principal.Subject)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		if !admin {
+			WriteError(w, NewError(http.StatusForbidden, ErrorForbidden, "role %s of realm %s required", AdminRole, ah.adminRealm))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin looks the role up in the admin realm instead of trusting the token, so taking it away applies at once
+func (ah *adminHandler) isAdmin(userID string) (bool, error) {
+	user, err := ah.users.FindUser(ah.adminRealm, userID)
+	if err != nil || user == nil || !user.Enabled {
+		return false, err
+	}
+	if contains(user.RealmRoles, AdminRole) {
+		return true, nil
+	}
+	for _, groupID := range user.Groups {
+		group, err := ah.groups.FindGroup(ah.adminRealm, groupID)
+		if err != nil {
+			return false, err
+		}
+		if group != nil && contains(group.RealmRoles, AdminRole) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// requireRealm answers requests for the resources of unknown realms with 404
+func (ah *adminHandler) requireRealm(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["realm"]
+		realm, err := ah.realms.FindRealm(name)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		if realm == nil {
+			WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "realm %s not found", name))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseQuery reads offset, limit, search and the filters of a list request
+func parseQuery(r *http.Request, filters ...filter) (db.Query, error) {
+	values := r.URL.Query()
+	query := db.Query{Filter: map[string]interface{}{}, Search: values.Get("search"), Limit: defaultPageSize}
+	if offset := values.Get("offset"); offset != "" {
+		parsed, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || parsed < 0 {
+			return query, NewError(http.StatusBadRequest, ErrorInvalidRequest, "offset must be a number of at least 0")
+		}
+		query.Offset = parsed
+	}
+	if limit := values.Get("limit"); limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return query, NewError(http.StatusBadRequest, ErrorInvalidRequest, "limit must be a number from 1 to %d", maxPageSize)
+		}
+		query.Limit = parsed
+	}
+	for _, f := range filters {
+		value := values.Get(f.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := f.parse(value)
+		if err != nil {
+			return query, NewError(http.StatusBadRequest, ErrorInvalidRequest, "invalid %s filter %s", f.name, value)
+		}
+		query.Filter[f.name] = parsed
+	}
+	return query, nil
+}
+
+func textFilter(name string) filter {
+	return filter{name: name, parse: func(value string) (interface{}, error) {
+		return value, nil
+	}}
+}
+
+func flagFilter(name string) filter {
+	return filter{name: name, parse: func(value string) (interface{}, error) {
+		return strconv.ParseBool(value)
+	}}
+}
+
+// writePage answers a list request with the page of items
+func writePage(w http.ResponseWriter, items interface{}, total int64, query db.Query) {
+	writeJSON(w, http.StatusOK, &Page{Items: items, Total: total, Offset: query.Offset, Limit: query.Limit})
+}
+
+// decodeBody reads the JSON request body, rejecting unknown fields to catch misspelled settings
+func decodeBody(r *http.Request, value interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "malformed request body: %v", err)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// orEmpty keeps lists from being stored and returned as null
+func orEmpty(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
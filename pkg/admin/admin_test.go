@@ -0,0 +1,505 @@
+package admin
+
+import (
+	"encoding/json"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	clientDto "github.com/NerdShoreDev/YEP/server/pkg/client/dto"
+	credentialDto "github.com/NerdShoreDev/YEP/server/pkg/credential/dto"
+	eventDto "github.com/NerdShoreDev/YEP/server/pkg/event/dto"
+	groupDto "github.com/NerdShoreDev/YEP/server/pkg/group/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/oidc"
+	"github.com/NerdShoreDev/YEP/server/pkg/password"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	roleDto "github.com/NerdShoreDev/YEP/server/pkg/role/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockRealmStore struct {
+	mock.Mock
+}
+
+func (mock *MockRealmStore) FindRealm(name string) (*realmDto.Realm, error) {
+	args := mock.Called(name)
+	return args.Get(0).(*realmDto.Realm), args.Error(1)
+}
+
+func (mock *MockRealmStore) FindRealms(query db.Query) ([]*realmDto.Realm, int64, error) {
+	args := mock.Called(query)
+	return args.Get(0).([]*realmDto.Realm), args.Get(1).(int64), args.Error(2)
+}
+
+func (mock *MockRealmStore) CreateRealm(realm *realmDto.Realm) error {
+	return mock.Called(realm).Error(0)
+}
+
+func (mock *MockRealmStore) UpdateRealm(realm *realmDto.Realm) error {
+	return mock.Called(realm).Error(0)
+}
+
+func (mock *MockRealmStore) DeleteRealm(name string) error {
+	return mock.Called(name).Error(0)
+}
+
+type MockClientStore struct {
+	mock.Mock
+}
+
+func (mock *MockClientStore) FindClient(realm string, clientID string) (*clientDto.Client, error) {
+	args := mock.Called(realm, clientID)
+	return args.Get(0).(*clientDto.Client), args.Error(1)
+}
+
+func (mock *MockClientStore) FindClients(realm string, query db.Query) ([]*clientDto.Client, int64, error) {
+	args := mock.Called(realm, query)
+	return args.Get(0).([]*clientDto.Client), args.Get(1).(int64), args.Error(2)
+}
+
+func (mock *MockClientStore) CreateClient(client *clientDto.Client) error {
+	return mock.Called(client).Error(0)
+}
+
+func (mock *MockClientStore) UpdateClient(client *clientDto.Client) error {
+	return mock.Called(client).Error(0)
+}
+
+func (mock *MockClientStore) UpdateClientSecrets(realm string, clientID string, secrets []clientDto.ClientSecret) error {
+	return mock.Called(realm, clientID, secrets).Error(0)
+}
+
+func (mock *MockClientStore) DeleteClient(realm string, clientID string) error {
+	return mock.Called(realm, clientID).Error(0)
+}
+
+func (mock *MockClientStore) DeleteClients(realm string) error {
+	return mock.Called(realm).Error(0)
+}
+
+type MockUserStore struct {
+	mock.Mock
+}
+
+func (mock *MockUserStore) FindUser(realm string, id string) (*userDto.User, error) {
+	args := mock.Called(realm, id)
+	return args.Get(0).(*userDto.User), args.Error(1)
+}
+
+func (mock *MockUserStore) FindUsers(realm string, query db.Query) ([]*userDto.User, int64, error) {
+	args := mock.Called(realm, query)
+	return args.Get(0).([]*userDto.User), args.Get(1).(int64), args.Error(2)
+}
+
+func (mock *MockUserStore) CreateUser(user *userDto.User) error {
+	return mock.Called(user).Error(0)
+}
+
+func (mock *MockUserStore) UpdateUser(user *userDto.User) error {
+	return mock.Called(user).Error(0)
+}
+
+func (mock *MockUserStore) RemoveRealmRole(realm string, role string) error {
+	return mock.Called(realm, role).Error(0)
+}
+
+func (mock *MockUserStore) RemoveGroup(realm string, groupID string) error {
+	return mock.Called(realm, groupID).Error(0)
+}
+
+func (mock *MockUserStore) DeleteUser(realm string, id string) error {
+	return mock.Called(realm, id).Error(0)
+}
+
+func (mock *MockUserStore) DeleteUsers(realm string) error {
+	return mock.Called(realm).Error(0)
+}
+
+type MockCredentialStore struct {
+	mock.Mock
+}
+
+func (mock *MockCredentialStore) FindCredentials(realm string, userID string, credentialType string) ([]*credentialDto.Credential, error) {
+	args := mock.Called(realm, userID, credentialType)
+	return args.Get(0).([]*credentialDto.Credential), args.Error(1)
+}
+
+func (mock *MockCredentialStore) DeleteCredential(realm string, userID string, id string) error {
+	return mock.Called(realm, userID, id).Error(0)
+}
+
+func (mock *MockCredentialStore) DeleteUserCredentials(realm string, userID string) error {
+	return mock.Called(realm, userID).Error(0)
+}
+
+func (mock *MockCredentialStore) DeleteCredentials(realm string) error {
+	return mock.Called(realm).Error(0)
+}
+
+type MockPasswordSetter struct {
+	mock.Mock
+}
+
+func (mock *MockPasswordSetter) SetPassword(realm string, user *userDto.User, password string) error {
+	return mock.Called(realm, user, password).Error(0)
+}
+
+type MockUnlocker struct {
+	mock.Mock
+}
+
+func (mock *MockUnlocker) Unlock(realm string, user *userDto.User, actor string) error {
+	return mock.Called(realm, user, actor).Error(0)
+}
+
+type MockEventStore struct {
+	mock.Mock
+}
+
+func (mock *MockEventStore) FindEvents(realm string, query db.Query) ([]*eventDto.Event, int64, error) {
+	args := mock.Called(realm, query)
+	return args.Get(0).([]*eventDto.Event), args.Get(1).(int64), args.Error(2)
+}
+
+type MockRoleStore struct {
+	mock.Mock
+}
+
+func (mock *MockRoleStore) FindRole(realm string, name string) (*roleDto.Role, error) {
+	args := mock.Called(realm, name)
+	return args.Get(0).(*roleDto.Role), args.Error(1)
+}
+
+func (mock *MockRoleStore) FindRoles(realm string, query db.Query) ([]*roleDto.Role, int64, error) {
+	args := mock.Called(realm, query)
+	return args.Get(0).([]*roleDto.Role), args.Get(1).(int64), args.Error(2)
+}
+
+func (mock *MockRoleStore) CreateRole(role *roleDto.Role) error {
+	return mock.Called(role).Error(0)
+}
+
+func (mock *MockRoleStore) UpdateRole(role *roleDto.Role) error {
+	return mock.Called(role).Error(0)
+}
+
+func (mock *MockRoleStore) DeleteRole(realm string, name string) error {
+	return mock.Called(realm, name).Error(0)
+}
+
+func (mock *MockRoleStore) DeleteRoles(realm string) error {
+	return mock.Called(realm).Error(0)
+}
+
+type MockGroupStore struct {
+	mock.Mock
+}
+
+func (mock *MockGroupStore) FindGroup(realm string, id string) (*groupDto.Group, error) {
+	args := mock.Called(realm, id)
+	return args.Get(0).(*groupDto.Group), args.Error(1)
+}
+
+func (mock *MockGroupStore) FindGroups(realm string, query db.Query) ([]*groupDto.Group, int64, error) {
+	args := mock.Called(realm, query)
+	return args.Get(0).([]*groupDto.Group), args.Get(1).(int64), args.Error(2)
+}
+
+func (mock *MockGroupStore) CreateGroup(group *groupDto.Group) error {
+	return mock.Called(group).Error(0)
+}
+
+func (mock *MockGroupStore) UpdateGroup(group *groupDto.Group) error {
+	return mock.Called(group).Error(0)
+}
+
+func (mock *MockGroupStore) RemoveRealmRole(realm string, role string) error {
+	return mock.Called(realm, role).Error(0)
+}
+
+func (mock *MockGroupStore) DeleteGroup(realm string, id string) error {
+	return mock.Called(realm, id).Error(0)
+}
+
+func (mock *MockGroupStore) DeleteGroups(realm string) error {
+	return mock.Called(realm).Error(0)
+}
+
+type adminTest struct {
+	realms      *MockRealmStore
+	clients     *MockClientStore
+	users       *MockUserStore
+	credentials *MockCredentialStore
+	passwords   *MockPasswordSetter
+	lockouts    *MockUnlocker
+	events      *MockEventStore
+	roles       *MockRoleStore
+	groups      *MockGroupStore
+	router      *mux.Router
+}
+
+// newAdminTest serves the admin API to user admin-1 of realm master, who is an admin through group admins
+func newAdminTest() *adminTest {
+	at := &adminTest{&MockRealmStore{}, &MockClientStore{}, &MockUserStore{}, &MockCredentialStore{}, &MockPasswordSetter{}, &MockUnlocker{}, &MockEventStore{}, &MockRoleStore{}, &MockGroupStore{}, mux.NewRouter()}
+	at.users.On("FindUser", "master", "admin-1").Return(&userDto.User{ID: "admin-1", Enabled: true, Groups: []string{"admins"}}, nil)
+	at.groups.On("FindGroup", "master", "admins").Return(&groupDto.Group{ID: "admins", RealmRoles: []string{AdminRole}}, nil)
+	at.realms.On("FindRealm", "YEP").Return(&realmDto.Realm{Name: "YEP", Enabled: true}, nil)
+	at.router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subject := r.Header.Get("X-Subject"); subject != "" {
+				r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Subject: subject}))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	NewAdminHandler("master", at.realms, at.clients, at.users, at.credentials, at.passwords, at.lockouts, at.events, at.roles, at.groups).RegisterRoutes(at.router)
+	return at
+}
+
+func (at *adminTest) serve(subject string, method string, path string, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("X-Subject", subject)
+	w := httptest.NewRecorder()
+	at.router.ServeHTTP(w, r)
+	response := map[string]interface{}{}
+	json.NewDecoder(w.Body).Decode(&response)
+	return w, response
+}
+
+func TestAdminAPI_whenCallerNoAdmin_thenForbidden(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	at.users.On("FindUser", "master", "user-1").Return(&userDto.User{ID: "user-1", Enabled: true, RealmRoles: []string{"viewer"}}, nil)
+
+	// act
+	anonymous, _ := at.serve("", http.MethodGet, "/realms", "")
+	w, response := at.serve("user-1", http.MethodGet, "/realms", "")
+
+	// assert
+	a.Equal(http.StatusUnauthorized, anonymous.Code)
+	a.Equal(http.StatusForbidden, w.Code)
+	a.Equal(ErrorForbidden, response["error"])
+	a.Equal("role admin of realm master required", response["message"])
+	at.realms.AssertNotCalled(t, "FindRealms", mock.Anything)
+}
+
+func TestAdminAPI_whenListingUsers_thenPassPageFilterAndSearch(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	query := db.Query{Filter: map[string]interface{}{"enabled": true}, Search: "ann", Offset: 10, Limit: 5}
+	at.users.On("FindUsers", "YEP", query).Return([]*userDto.User{{ID: "user-1", Username: "anna"}}, int64(11), nil)
+
+	// act
+	w, response := at.serve("admin-1", http.MethodGet, "/realms/YEP/users?enabled=true&search=ann&offset=10&limit=5", "")
+	invalid, invalidResponse := at.serve("admin-1", http.MethodGet, "/realms/YEP/users?limit=1000", "")
+
+	// assert
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal(float64(11), response["total"])
+	a.Len(response["items"], 1)
+	a.Equal(http.StatusBadRequest, invalid.Code)
+	a.Equal(ErrorInvalidRequest, invalidResponse["error"])
+}
+
+func TestAdminAPI_whenCreatingUserWithUnknownRole_thenBadRequest(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	at.roles.On("FindRole", "YEP", "auditor").Return((*roleDto.Role)(nil), nil)
+
+	// act
+	w, response := at.serve("admin-1", http.MethodPost, "/realms/YEP/users", `{"username":"anna","realmRoles":["auditor"]}`)
+
+	// assert
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("unknown role auditor", response["message"])
+	at.users.AssertNotCalled(t, "CreateUser", mock.Anything)
+}
+
+func TestAdminAPI_whenCreatingExistingRealm_thenConflict(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	at.realms.On("CreateRealm", mock.Anything).Return(mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}})
+
+	// act
+	w, response := at.serve("admin-1", http.MethodPost, "/realms", `{"name":"YEP","enabled":true}`)
+	invalid, _ := at.serve("admin-1", http.MethodPost, "/realms", `{"name":"YEP","signingAlgorithms":["none"]}`)
+	unknownField, _ := at.serve("admin-1", http.MethodPost, "/realms", `{"name":"YEP","enabeld":true}`)
+
+	// assert
+	a.Equal(http.StatusConflict, w.Code)
+	a.Equal("realm YEP exists already", response["message"])
+	a.Equal(http.StatusBadRequest, invalid.Code)
+	a.Equal(http.StatusBadRequest, unknownField.Code)
+}
+
+func TestAdminAPI_whenDeletingRealm_thenDeleteItsResources(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	at.realms.On("DeleteRealm", "YEP").Return(nil)
+	at.clients.On("DeleteClients", "YEP").Return(nil)
+	at.users.On("DeleteUsers", "YEP").Return(nil)
+	at.credentials.On("DeleteCredentials", "YEP").Return(nil)
+	at.roles.On("DeleteRoles", "YEP").Return(nil)
+	at.groups.On("DeleteGroups", "YEP").Return(nil)
+
+	// act
+	w, _ := at.serve("admin-1", http.MethodDelete, "/realms/YEP", "")
+	master, _ := at.serve("admin-1", http.MethodDelete, "/realms/master", "")
+
+	// assert
+	a.Equal(http.StatusNoContent, w.Code)
+	a.Equal(http.StatusConflict, master.Code)
+	at.users.AssertCalled(t, "DeleteUsers", "YEP")
+	at.credentials.AssertCalled(t, "DeleteCredentials", "YEP")
+	at.groups.AssertCalled(t, "DeleteGroups", "YEP")
+	at.realms.AssertNotCalled(t, "DeleteRealm", "master")
+}
+
+func TestAdminAPI_whenRealmUnknown_thenNotFound(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	at.realms.On("FindRealm", "other").Return((*realmDto.Realm)(nil), nil)
+
+	// act
+	w, response := at.serve("admin-1", http.MethodGet, "/realms/other/clients", "")
+
+	// assert
+	a.Equal(http.StatusNotFound, w.Code)
+	a.Equal(ErrorNotFound, response["error"])
+	at.clients.AssertNotCalled(t, "FindClients", mock.Anything, mock.Anything)
+}
+
+func TestAdminAPI_whenCreatingConfidentialClient_thenReturnGeneratedSecretOnce(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	var created *clientDto.Client
+	at.clients.On("CreateClient", mock.Anything).Run(func(args mock.Arguments) {
+		created = args.Get(0).(*clientDto.Client)
+	}).Return(nil)
+
+	// act
+	w, response := at.serve("admin-1", http.MethodPost, "/realms/YEP/clients", `{"clientId":"app","enabled":true,"redirectUris":["https://app.example.com/cb"]}`)
+	invalid, _ := at.serve("admin-1", http.MethodPost, "/realms/YEP/clients", `{"clientId":"spa","type":"public","redirectUriPatterns":["http*://app.example.com/cb"]}`)
+
+	// assert
+	a.Equal(http.StatusCreated, w.Code)
+	a.Equal(clientDto.TypeConfidential, response["type"])
+	a.NotEmpty(response["secret"])
+	a.Len(created.Secrets, 1)
+	a.Equal(oidc.HashClientSecret(response["secret"].(string)), created.Secrets[0].Hash)
+	a.Equal(http.StatusBadRequest, invalid.Code)
+}
+
+func TestAdminAPI_whenRotatingClientSecret_thenKeepPreviousSecretForGracePeriod(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	previous := []clientDto.ClientSecret{{Hash: oidc.HashClientSecret("old"), CreatedAt: time.Now().Add(-time.Hour)}}
+	at.clients.On("FindClient", "YEP", "app").Return(&clientDto.Client{Realm: "YEP", ClientID: "app", Type: clientDto.TypeConfidential, Secrets: previous}, nil)
+	var rotated []clientDto.ClientSecret
+	at.clients.On("UpdateClientSecrets", "YEP", "app", mock.Anything).Run(func(args mock.Arguments) {
+		rotated = args.Get(2).([]clientDto.ClientSecret)
+	}).Return(nil)
+
+	// act
+	w, response := at.serve("admin-1", http.MethodPost, "/realms/YEP/clients/app/secret?gracePeriod=600", "")
+	invalid, _ := at.serve("admin-1", http.MethodPost, "/realms/YEP/clients/app/secret?gracePeriod=-1", "")
+
+	// assert
+	a.Equal(http.StatusOK, w.Code)
+	a.NotEmpty(response["secret"])
+	a.Len(rotated, 2)
+	a.Equal(oidc.HashClientSecret(response["secret"].(string)), rotated[0].Hash)
+	a.WithinDuration(time.Now().Add(10*time.Minute), *rotated[1].ExpiresAt, time.Minute)
+	a.Equal(http.StatusBadRequest, invalid.Code)
+}
+
+func TestAdminAPI_whenUsernameOrEmailTaken_thenConflict(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	at.users.On("CreateUser", mock.Anything).Return(mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}})
+
+	// act
+	w, response := at.serve("admin-1", http.MethodPost, "/realms/YEP/users", `{"username":" Anna ","email":"Anna@Example.com"}`)
+	invalid, _ := at.serve("admin-1", http.MethodPost, "/realms/YEP/users", `{"username":"bob","email":"Bob <bob@example.com>"}`)
+
+	// assert
+	a.Equal(http.StatusConflict, w.Code)
+	a.Equal("username Anna or email Anna@Example.com is taken already", response["message"])
+	a.Equal(http.StatusBadRequest, invalid.Code)
+}
+
+func TestAdminAPI_whenDeletingUser_thenDeleteCredentials(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	at.users.On("DeleteUser", "YEP", "user-1").Return(nil)
+	at.credentials.On("DeleteUserCredentials", "YEP", "user-1").Return(nil)
+
+	// act
+	w, _ := at.serve("admin-1", http.MethodDelete, "/realms/YEP/users/user-1", "")
+
+	// assert
+	a.Equal(http.StatusNoContent, w.Code)
+	at.credentials.AssertCalled(t, "DeleteUserCredentials", "YEP", "user-1")
+}
+
+func TestAdminAPI_whenSettingPasswordAgainstPolicy_thenBadRequestNamingTheRules(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	user := &userDto.User{ID: "user-1", Realm: "YEP", Enabled: true}
+	at.users.On("FindUser", "YEP", "user-1").Return(user, nil)
+	at.users.On("FindUser", "YEP", "other").Return((*userDto.User)(nil), nil)
+	at.passwords.On("SetPassword", "YEP", user, "correct horse battery staple").Return(nil)
+	at.passwords.On("SetPassword", "YEP", user, "short").Return(&password.PolicyError{Violations: []string{
+		"password must be at least 12 characters long", "password must contain a digit",
+	}})
+
+	// act
+	w, _ := at.serve("admin-1", http.MethodPut, "/realms/YEP/users/user-1/password", `{"password":"correct horse battery staple"}`)
+	rejected, response := at.serve("admin-1", http.MethodPut, "/realms/YEP/users/user-1/password", `{"password":"short"}`)
+	unknown, _ := at.serve("admin-1", http.MethodPut, "/realms/YEP/users/other/password", `{"password":"correct horse battery staple"}`)
+
+	// assert
+	a.Equal(http.StatusNoContent, w.Code)
+	a.Equal(http.StatusBadRequest, rejected.Code)
+	a.Equal("password must be at least 12 characters long; password must contain a digit", response["message"])
+	a.Equal(http.StatusNotFound, unknown.Code)
+}
+
+func TestAdminAPI_whenUnlockingUser_thenUnlockAsCaller(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	at := newAdminTest()
+	user := &userDto.User{ID: "user-1", Realm: "YEP", Username: "anna"}
+	at.users.On("FindUser", "YEP", "user-1").Return(user, nil)
+	at.lockouts.On("Unlock", "YEP", user, "admin-1").Return(nil)
+	query := db.Query{Filter: map[string]interface{}{"type": eventDto.TypeUserUnlocked}, Limit: defaultPageSize}
+	at.events.On("FindEvents", "YEP", query).Return([]*eventDto.Event{{Realm: "YEP", Type: eventDto.TypeUserUnlocked, UserID: "user-1"}}, int64(1), nil)
+
+	// act
+	w, _ := at.serve("admin-1", http.MethodDelete, "/realms/YEP/users/user-1/lockout", "")
+	events, response := at.serve("admin-1", http.MethodGet, "/realms/YEP/events?type=USER_UNLOCKED", "")
+
+	// assert
+	a.Equal(http.StatusNoContent, w.Code)
+	at.lockouts.AssertCalled(t, "Unlock", "YEP", user, "admin-1")
+	a.Equal(http.StatusOK, events.Code)
+	a.Equal(float64(1), response["total"])
+}
@@ -0,0 +1,209 @@
+package admin
+
+import (
+	clientDto "github.com/NerdShoreDev/YEP/server/pkg/client/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/oidc"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultSecretGracePeriod keeps the previous secret of a client valid after a rotation until it is rolled out
+const defaultSecretGracePeriod = 24 * time.Hour
+
+// clientSecretResponse shows a generated secret, which cannot be read again later
+type clientSecretResponse struct {
+	*clientDto.Client
+	Secret string `json:"secret,omitempty"`
+}
+
+func (ah *adminHandler) listClients(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r, flagFilter("enabled"))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	clients, total, err := ah.clients.FindClients(mux.Vars(r)["realm"], query)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writePage(w, clients, total, query)
+}
+
+func (ah *adminHandler) createClient(w http.ResponseWriter, r *http.Request) {
+	var client clientDto.Client
+	if err := decodeBody(r, &client); err != nil {
+		WriteError(w, err)
+		return
+	}
+	client.Realm = mux.Vars(r)["realm"]
+	if client.ClientID == "" {
+		WriteError(w, NewError(http.StatusBadRequest, ErrorInvalidRequest, "clientId required"))
+		return
+	}
+	if err := validateClient(&client); err != nil {
+		WriteError(w, err)
+		return
+	}
+	response := &clientSecretResponse{Client: &client}
+	client.Secrets = []clientDto.ClientSecret{}
+	if client.Type == clientDto.TypeConfidential {
+		secret, secrets, err := oidc.RotateClientSecret(nil, 0, time.Now().UTC())
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+		response.Secret, client.Secrets = secret, secrets
+	}
+	if err := ah.clients.CreateClient(&client); err != nil {
+		WriteError(w, storeError(err, "client %s", client.ClientID))
+		return
+	}
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (ah *adminHandler) getClient(w http.ResponseWriter, r *http.Request) {
+	clientID := mux.Vars(r)["clientId"]
+	client, err := ah.clients.FindClient(mux.Vars(r)["realm"], clientID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if client == nil {
+		WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "client %s not found", clientID))
+		return
+	}
+	writeJSON(w, http.StatusOK, client)
+}
+
+func (ah *adminHandler) updateClient(w http.ResponseWriter, r *http.Request) {
+	var client clientDto.Client
+	if err := decodeBody(r, &client); err != nil {
+		WriteError(w, err)
+		return
+	}
+	client.Realm = mux.Vars(r)["realm"]
+	client.ClientID = mux.Vars(r)["clientId"]
+	if err := validateClient(&client); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := ah.clients.UpdateClient(&client); err != nil {
+		WriteError(w, storeError(err, "client %s", client.ClientID))
+		return
+	}
+	ah.getClient(w, r)
+}
+
+func (ah *adminHandler) deleteClient(w http.ResponseWriter, r *http.Request) {
+	clientID := mux.Vars(r)["clientId"]
+	if err := ah.clients.DeleteClient(mux.Vars(r)["realm"], clientID); err != nil {
+		WriteError(w, storeError(err, "client %s", clientID))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rotateClientSecret generates a new secret for the client. The previous one stays valid for the gracePeriod in seconds.
+func (ah *adminHandler) rotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	clientID := mux.Vars(r)["clientId"]
+	gracePeriod := defaultSecretGracePeriod
+	if value := r.URL.Query().Get("gracePeriod"); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || seconds < 0 {
+			WriteError(w, NewError(http.StatusBadRequest, ErrorInvalidRequest, "gracePeriod must be a number of seconds"))
+			return
+		}
+		gracePeriod = time.Duration(seconds) * time.Second
+	}
+
+	client, err := ah.clients.FindClient(realm, clientID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if client == nil {
+		WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "client %s not found", clientID))
+		return
+	}
+	if client.Type != clientDto.TypeConfidential {
+		WriteError(w, NewError(http.StatusConflict, ErrorConflict, "public client %s has no secret", clientID))
+		return
+	}
+	secret, secrets, err := oidc.RotateClientSecret(client.Secrets, gracePeriod, time.Now().UTC())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := ah.clients.UpdateClientSecrets(realm, clientID, secrets); err != nil {
+		WriteError(w, storeError(err, "client %s", clientID))
+		return
+	}
+	client.Secrets = secrets
+	writeJSON(w, http.StatusOK, &clientSecretResponse{Client: client, Secret: secret})
+}
+
+// validateClient checks the settings and fills in the defaults of the client type
+func validateClient(client *clientDto.Client) error {
+	if client.Type == "" {
+		client.Type = clientDto.TypeConfidential
+	}
+	switch client.Type {
+	case clientDto.TypePublic:
+		if client.TokenEndpointAuthMethod == "" {
+			client.TokenEndpointAuthMethod = oidc.AuthMethodNone
+		}
+		if client.TokenEndpointAuthMethod != oidc.AuthMethodNone {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "public clients authenticate with %s", oidc.AuthMethodNone)
+		}
+	case clientDto.TypeConfidential:
+		if client.TokenEndpointAuthMethod == "" {
+			client.TokenEndpointAuthMethod = oidc.AuthMethodClientSecretBasic
+		}
+		if client.TokenEndpointAuthMethod != oidc.AuthMethodClientSecretBasic && client.TokenEndpointAuthMethod != oidc.AuthMethodClientSecretPost {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "confidential clients authenticate with %s or %s", oidc.AuthMethodClientSecretBasic, oidc.AuthMethodClientSecretPost)
+		}
+	default:
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "type must be %s or %s", clientDto.TypePublic, clientDto.TypeConfidential)
+	}
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{oidc.GrantTypeAuthorizationCode}
+	}
+	for _, grantType := range client.GrantTypes {
+		if !contains(oidc.SupportedGrantTypes, grantType) {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "grant type %s is not supported", grantType)
+		}
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		if err := oidc.ValidateRedirectURI(redirectURI); err != nil {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "%s", err.Error())
+		}
+	}
+	for _, pattern := range client.RedirectURIPatterns {
+		if _, err := oidc.CompileRedirectURIPattern(pattern); err != nil {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "%s", err.Error())
+		}
+	}
+	for _, origin := range client.WebOrigins {
+		if parsed, err := url.Parse(origin); origin != "+" && (err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Path != "" || origin != parsed.Scheme+"://"+parsed.Host) {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "web origin %s must be + or scheme://host[:port]", origin)
+		}
+	}
+	if client.AccessTokenLifetime < 0 || client.IDTokenLifetime < 0 {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "token lifetimes must not be negative")
+	}
+	if client.SubjectType != "" && client.SubjectType != oidc.SubjectTypePublic && client.SubjectType != oidc.SubjectTypePairwise {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "subjectType must be %s or %s", oidc.SubjectTypePublic, oidc.SubjectTypePairwise)
+	}
+	client.RedirectURIs = orEmpty(client.RedirectURIs)
+	client.RedirectURIPatterns = orEmpty(client.RedirectURIPatterns)
+	client.WebOrigins = orEmpty(client.WebOrigins)
+	if _, err := oidc.NewClient(client); err != nil {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "%s", err.Error())
+	}
+	return nil
+}
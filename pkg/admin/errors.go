@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+)
+
+// Error codes of the admin API
+const (
+	ErrorInvalidRequest = "invalid_request"
+	ErrorUnauthorized   = "unauthorized"
+	ErrorForbidden      = "forbidden"
+	ErrorNotFound       = "not_found"
+	ErrorConflict       = "conflict"
+	ErrorServerError    = "server_error"
+)
+
+// Error is the JSON error response of the admin API
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+// NewError creates an admin API error with a formatted message
+func NewError(status int, code string, format string, args ...interface{}) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// WriteError writes err as JSON error response. Errors which are not admin API errors are logged and reported as server_error.
+func WriteError(w http.ResponseWriter, err error) {
+	adminErr, ok := err.(*Error)
+	if !ok {
+		log.Errorf("admin API request failed: %v", err)
+		adminErr = NewError(http.StatusInternalServerError, ErrorServerError, "internal error")
+	}
+	writeJSON(w, adminErr.Status, adminErr)
+}
+
+// storeError turns the not found and duplicate key errors of the stores into admin API errors
+func storeError(err error, format string, args ...interface{}) error {
+	if err == mongo.ErrNoDocuments {
+		return NewError(http.StatusNotFound, ErrorNotFound, format+" not found", args...)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return NewError(http.StatusConflict, ErrorConflict, format+" exists already", args...)
+	}
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
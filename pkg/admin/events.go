@@ -0,0 +1,20 @@
+package admin
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+func (ah *adminHandler) listEvents(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r, textFilter("type"), textFilter("userId"), textFilter("ipAddress"))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	events, total, err := ah.events.FindEvents(mux.Vars(r)["realm"], query)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writePage(w, events, total, query)
+}
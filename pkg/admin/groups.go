@@ -0,0 +1,98 @@
+package admin
+
+import (
+	groupDto "github.com/NerdShoreDev/YEP/server/pkg/group/dto"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+func (ah *adminHandler) listGroups(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r, textFilter("name"))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	groups, total, err := ah.groups.FindGroups(mux.Vars(r)["realm"], query)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writePage(w, groups, total, query)
+}
+
+func (ah *adminHandler) createGroup(w http.ResponseWriter, r *http.Request) {
+	var group groupDto.Group
+	if err := decodeBody(r, &group); err != nil {
+		WriteError(w, err)
+		return
+	}
+	group.Realm = mux.Vars(r)["realm"]
+	if err := ah.validateGroup(&group); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := ah.groups.CreateGroup(&group); err != nil {
+		WriteError(w, storeError(err, "group %s", group.Name))
+		return
+	}
+	writeJSON(w, http.StatusCreated, &group)
+}
+
+func (ah *adminHandler) getGroup(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	group, err := ah.groups.FindGroup(mux.Vars(r)["realm"], id)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if group == nil {
+		WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "group %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, group)
+}
+
+func (ah *adminHandler) updateGroup(w http.ResponseWriter, r *http.Request) {
+	var group groupDto.Group
+	if err := decodeBody(r, &group); err != nil {
+		WriteError(w, err)
+		return
+	}
+	group.Realm = mux.Vars(r)["realm"]
+	group.ID = mux.Vars(r)["id"]
+	if err := ah.validateGroup(&group); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := ah.groups.UpdateGroup(&group); err != nil {
+		WriteError(w, storeError(err, "group %s", group.ID))
+		return
+	}
+	ah.getGroup(w, r)
+}
+
+// deleteGroup removes the group and ends the membership of its users
+func (ah *adminHandler) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	id := mux.Vars(r)["id"]
+	if err := ah.groups.DeleteGroup(realm, id); err != nil {
+		WriteError(w, storeError(err, "group %s", id))
+		return
+	}
+	if err := ah.users.RemoveGroup(realm, id); err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ah *adminHandler) validateGroup(group *groupDto.Group) error {
+	if group.Name == "" {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "name required")
+	}
+	if err := ah.validateRoles(group.Realm, group.RealmRoles); err != nil {
+		return err
+	}
+	group.RealmRoles = orEmpty(group.RealmRoles)
+	return nil
+}
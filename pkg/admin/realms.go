@@ -0,0 +1,149 @@
+package admin
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/oidc"
+	"github.com/NerdShoreDev/YEP/server/pkg/password"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/theme"
+	"github.com/gorilla/mux"
+	"net/http"
+	"regexp"
+)
+
+// realmNamePattern keeps realm names usable in paths and issuer identifiers without escaping
+var realmNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+func (ah *adminHandler) listRealms(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r, flagFilter("enabled"))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	realms, total, err := ah.realms.FindRealms(query)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writePage(w, realms, total, query)
+}
+
+func (ah *adminHandler) createRealm(w http.ResponseWriter, r *http.Request) {
+	var realm realmDto.Realm
+	if err := decodeBody(r, &realm); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if !realmNamePattern.MatchString(realm.Name) {
+		WriteError(w, NewError(http.StatusBadRequest, ErrorInvalidRequest, "name must consist of letters, digits, _ and -"))
+		return
+	}
+	if err := validateRealm(&realm); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := ah.realms.CreateRealm(&realm); err != nil {
+		WriteError(w, storeError(err, "realm %s", realm.Name))
+		return
+	}
+	writeJSON(w, http.StatusCreated, &realm)
+}
+
+func (ah *adminHandler) getRealm(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["realm"]
+	realm, err := ah.realms.FindRealm(name)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if realm == nil {
+		WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "realm %s not found", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, realm)
+}
+
+func (ah *adminHandler) updateRealm(w http.ResponseWriter, r *http.Request) {
+	var realm realmDto.Realm
+	if err := decodeBody(r, &realm); err != nil {
+		WriteError(w, err)
+		return
+	}
+	realm.Name = mux.Vars(r)["realm"]
+	if err := validateRealm(&realm); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if realm.Name == ah.adminRealm && !realm.Enabled {
+		WriteError(w, NewError(http.StatusConflict, ErrorConflict, "the admin realm cannot be disabled"))
+		return
+	}
+	if err := ah.realms.UpdateRealm(&realm); err != nil {
+		WriteError(w, storeError(err, "realm %s", realm.Name))
+		return
+	}
+	ah.getRealm(w, r)
+}
+
+// deleteRealm removes the realm with its clients, users, roles and groups
+func (ah *adminHandler) deleteRealm(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["realm"]
+	if name == ah.adminRealm {
+		WriteError(w, NewError(http.StatusConflict, ErrorConflict, "the admin realm cannot be deleted"))
+		return
+	}
+	if err := ah.realms.DeleteRealm(name); err != nil {
+		WriteError(w, storeError(err, "realm %s", name))
+		return
+	}
+	for _, deleteAll := range []func(string) error{ah.clients.DeleteClients, ah.users.DeleteUsers, ah.credentials.DeleteCredentials, ah.roles.DeleteRoles, ah.groups.DeleteGroups} {
+		if err := deleteAll(name); err != nil {
+			WriteError(w, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateRealm(realm *realmDto.Realm) error {
+	if realm.AccessTokenLifetime < 0 || realm.IDTokenLifetime < 0 {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "token lifetimes must not be negative")
+	}
+	for _, algorithm := range realm.SigningAlgorithms {
+		if !oidc.SupportsSigningAlgorithm(algorithm) {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "signing algorithm %s is not supported", algorithm)
+		}
+	}
+	if realm.PasswordHashing != (realmDto.PasswordHashing{}) {
+		if err := password.ParamsOf(realm.PasswordHashing).Validate(); err != nil {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "%s", err.Error())
+		}
+	}
+	if err := password.ValidatePolicy(realm.PasswordPolicy); err != nil {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "%s", err.Error())
+	}
+	protection := realm.BruteForceProtection
+	if protection.FailureWindow < 0 || protection.MinDelay < 0 || protection.MaxDelay < 0 || protection.LockoutDuration < 0 ||
+		protection.MaxFailures < 0 || protection.MaxLockouts < 0 || protection.MaxIPFailures < 0 {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "brute force protection settings must not be negative")
+	}
+	if protection.MaxDelay > 0 && protection.MaxDelay < protection.MinDelay {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "brute force protection maxDelay must not be below minDelay")
+	}
+	if err := oidc.ValidateScopeMappings(realm.ScopeMappings); err != nil {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "%s", err.Error())
+	}
+	if err := oidc.ValidateAuthorizationDetailTypes(realm.AuthorizationDetailTypes); err != nil {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "%s", err.Error())
+	}
+	if realm.Theme != "" && !theme.ValidName(realm.Theme) {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "theme must consist of lowercase letters, digits, _ and -")
+	}
+	realm.SigningAlgorithms = orEmpty(realm.SigningAlgorithms)
+	if realm.ScopeMappings == nil {
+		realm.ScopeMappings = []realmDto.ScopeMapping{}
+	}
+	if realm.AuthorizationDetailTypes == nil {
+		realm.AuthorizationDetailTypes = []realmDto.AuthorizationDetailType{}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package admin
+
+import (
+	roleDto "github.com/NerdShoreDev/YEP/server/pkg/role/dto"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+func (ah *adminHandler) listRoles(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	roles, total, err := ah.roles.FindRoles(mux.Vars(r)["realm"], query)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writePage(w, roles, total, query)
+}
+
+func (ah *adminHandler) createRole(w http.ResponseWriter, r *http.Request) {
+	var role roleDto.Role
+	if err := decodeBody(r, &role); err != nil {
+		WriteError(w, err)
+		return
+	}
+	role.Realm = mux.Vars(r)["realm"]
+	if role.Name == "" {
+		WriteError(w, NewError(http.StatusBadRequest, ErrorInvalidRequest, "name required"))
+		return
+	}
+	if err := ah.roles.CreateRole(&role); err != nil {
+		WriteError(w, storeError(err, "role %s", role.Name))
+		return
+	}
+	writeJSON(w, http.StatusCreated, &role)
+}
+
+func (ah *adminHandler) getRole(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["role"]
+	role, err := ah.roles.FindRole(mux.Vars(r)["realm"], name)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if role == nil {
+		WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "role %s not found", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, role)
+}
+
+func (ah *adminHandler) updateRole(w http.ResponseWriter, r *http.Request) {
+	var role roleDto.Role
+	if err := decodeBody(r, &role); err != nil {
+		WriteError(w, err)
+		return
+	}
+	role.Realm = mux.Vars(r)["realm"]
+	role.Name = mux.Vars(r)["role"]
+	if err := ah.roles.UpdateRole(&role); err != nil {
+		WriteError(w, storeError(err, "role %s", role.Name))
+		return
+	}
+	ah.getRole(w, r)
+}
+
+// deleteRole removes the role and takes it away from the users and groups it was granted to
+func (ah *adminHandler) deleteRole(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	name := mux.Vars(r)["role"]
+	if realm == ah.adminRealm && name == AdminRole {
+		WriteError(w, NewError(http.StatusConflict, ErrorConflict, "the admin role cannot be deleted"))
+		return
+	}
+	if err := ah.roles.DeleteRole(realm, name); err != nil {
+		WriteError(w, storeError(err, "role %s", name))
+		return
+	}
+	if err := ah.users.RemoveRealmRole(realm, name); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := ah.groups.RemoveRealmRole(realm, name); err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateRoles checks that the roles exist in the realm
+func (ah *adminHandler) validateRoles(realm string, names []string) error {
+	for _, name := range names {
+		role, err := ah.roles.FindRole(realm, name)
+		if err != nil {
+			return err
+		}
+		if role == nil {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "unknown role %s", name)
+		}
+	}
+	return nil
+}
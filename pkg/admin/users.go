@@ -0,0 +1,220 @@
+package admin
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	"github.com/NerdShoreDev/YEP/server/pkg/password"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"net/mail"
+	"strings"
+)
+
+func (ah *adminHandler) listUsers(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQuery(r, flagFilter("enabled"), textFilter("username"), textFilter("email"))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	users, total, err := ah.users.FindUsers(mux.Vars(r)["realm"], query)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writePage(w, users, total, query)
+}
+
+func (ah *adminHandler) createUser(w http.ResponseWriter, r *http.Request) {
+	var user userDto.User
+	if err := decodeBody(r, &user); err != nil {
+		WriteError(w, err)
+		return
+	}
+	user.Realm = mux.Vars(r)["realm"]
+	if err := ah.validateUser(&user); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := ah.users.CreateUser(&user); err != nil {
+		WriteError(w, userStoreError(err, &user))
+		return
+	}
+	writeJSON(w, http.StatusCreated, &user)
+}
+
+func (ah *adminHandler) getUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	user, err := ah.users.FindUser(mux.Vars(r)["realm"], id)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if user == nil {
+		WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "user %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (ah *adminHandler) updateUser(w http.ResponseWriter, r *http.Request) {
+	var user userDto.User
+	if err := decodeBody(r, &user); err != nil {
+		WriteError(w, err)
+		return
+	}
+	user.Realm = mux.Vars(r)["realm"]
+	user.ID = mux.Vars(r)["id"]
+	if err := ah.validateUser(&user); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := ah.users.UpdateUser(&user); err != nil {
+		WriteError(w, userStoreError(err, &user))
+		return
+	}
+	ah.getUser(w, r)
+}
+
+func (ah *adminHandler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := ah.users.DeleteUser(mux.Vars(r)["realm"], id); err != nil {
+		WriteError(w, storeError(err, "user %s", id))
+		return
+	}
+	if err := ah.credentials.DeleteUserCredentials(mux.Vars(r)["realm"], id); err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// passwordRequest sets the password of a user
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+// setPassword replaces the password of the user, which has to comply with the realm's password policy
+func (ah *adminHandler) setPassword(w http.ResponseWriter, r *http.Request) {
+	var request passwordRequest
+	if err := decodeBody(r, &request); err != nil {
+		WriteError(w, err)
+		return
+	}
+	realm := mux.Vars(r)["realm"]
+	id := mux.Vars(r)["id"]
+	if request.Password == "" {
+		WriteError(w, NewError(http.StatusBadRequest, ErrorInvalidRequest, "password required"))
+		return
+	}
+	user, err := ah.users.FindUser(realm, id)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if user == nil {
+		WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "user %s not found", id))
+		return
+	}
+	err = ah.passwords.SetPassword(realm, user, request.Password)
+	if policyErr, ok := err.(*password.PolicyError); ok {
+		WriteError(w, NewError(http.StatusBadRequest, ErrorInvalidRequest, "%s", policyErr.Error()))
+		return
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unlockUser lifts a temporary or permanent lockout of the user after failed logins
+func (ah *adminHandler) unlockUser(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	id := mux.Vars(r)["id"]
+	user, err := ah.users.FindUser(realm, id)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if user == nil {
+		WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "user %s not found", id))
+		return
+	}
+	principal, _ := auth.PrincipalFrom(r.Context())
+	if err := ah.lockouts.Unlock(realm, user, principal.Subject); err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listCredentials shows the credentials of the user without their secrets
+func (ah *adminHandler) listCredentials(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	id := mux.Vars(r)["id"]
+	user, err := ah.users.FindUser(realm, id)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if user == nil {
+		WriteError(w, NewError(http.StatusNotFound, ErrorNotFound, "user %s not found", id))
+		return
+	}
+	credentials, err := ah.credentials.FindCredentials(realm, id, "")
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, credentials)
+}
+
+func (ah *adminHandler) deleteCredential(w http.ResponseWriter, r *http.Request) {
+	credentialID := mux.Vars(r)["credentialId"]
+	if err := ah.credentials.DeleteCredential(mux.Vars(r)["realm"], mux.Vars(r)["id"], credentialID); err != nil {
+		WriteError(w, storeError(err, "credential %s", credentialID))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userStoreError tells that the username or email is taken, as both are unique in the realm
+func userStoreError(err error, user *userDto.User) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return NewError(http.StatusConflict, ErrorConflict, "username %s or email %s is taken already", user.Username, user.Email)
+	}
+	return storeError(err, "user %s", user.ID)
+}
+
+// validateUser checks the username and that the roles and groups of the user exist in its realm
+func (ah *adminHandler) validateUser(user *userDto.User) error {
+	user.Username = strings.TrimSpace(user.Username)
+	user.Email = strings.TrimSpace(user.Email)
+	if user.Username == "" {
+		return NewError(http.StatusBadRequest, ErrorInvalidRequest, "username required")
+	}
+	if user.Email != "" {
+		if _, err := mail.ParseAddress(user.Email); err != nil || strings.ContainsAny(user.Email, "<> ") {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "invalid email %s", user.Email)
+		}
+	}
+	if err := ah.validateRoles(user.Realm, user.RealmRoles); err != nil {
+		return err
+	}
+	for _, groupID := range user.Groups {
+		group, err := ah.groups.FindGroup(user.Realm, groupID)
+		if err != nil {
+			return err
+		}
+		if group == nil {
+			return NewError(http.StatusBadRequest, ErrorInvalidRequest, "unknown group %s", groupID)
+		}
+	}
+	user.RealmRoles = orEmpty(user.RealmRoles)
+	user.Groups = orEmpty(user.Groups)
+	if user.Attributes == nil {
+		user.Attributes = map[string][]string{}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIssuer = "https://sso.example.com/auth/realm/YEP"
+
+func signTestToken(method jwt.SigningMethod, key interface{}) string {
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"iss": testIssuer, "aud": "yep", "exp": time.Now().Add(time.Minute).Unix()})
+	token.Header["kid"] = "key-1"
+	token.Header["typ"] = "at+jwt"
+	signed, _ := token.SignedString(key)
+	return signed
+}
+
+func encode(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+func TestJWTValidation_whenSignedWithES256_thenSucceed(t *testing.T) {
+	// arrange
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mc := &MockOIDClient{}
+	mc.On("GetJWK", "key-1").Return(&JWK{Kty: "EC", Crv: "P-256", Kid: "key-1", X: encode(key.X.Bytes()), Y: encode(key.Y.Bytes())}, nil)
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+
+	// act
+	err := jwtHandler.ValidateJWTToken(signTestToken(jwt.SigningMethodES256, key))
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func TestJWTValidation_whenSignedWithPS256_thenSucceed(t *testing.T) {
+	// arrange
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	mc := &MockOIDClient{}
+	mc.On("GetJWK", "key-1").Return(&JWK{Kty: "RSA", Kid: "key-1", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}, nil)
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+
+	// act
+	err := jwtHandler.ValidateJWTToken(signTestToken(jwt.SigningMethodPS256, key))
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func TestJWTValidation_whenSignedWithEdDSA_thenSucceed(t *testing.T) {
+	// arrange
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	mc := &MockOIDClient{}
+	mc.On("GetJWK", "key-1").Return(&JWK{Kty: "OKP", Crv: "Ed25519", Kid: "key-1", X: encode(publicKey)}, nil)
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+
+	// act
+	err := jwtHandler.ValidateJWTToken(signTestToken(SigningMethodEdDSA, privateKey))
+
+	// assert
+	assert.NoError(t, err)
+}
+
+func TestJWTValidation_whenAlgorithmNotAllowed_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mc := &MockOIDClient{}
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep", "RS256")
+
+	// act
+	err := jwtHandler.ValidateJWTToken(signTestToken(jwt.SigningMethodES256, key))
+
+	// assert
+	mc.AssertNotCalled(t, "GetJWK", "key-1")
+	a.Error(err)
+	a.Contains(err.Error(), "unexpected signing method: ES256")
+}
+
+func TestJWTValidation_whenKeyBoundToOtherAlgorithm_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	mc := &MockOIDClient{}
+	mc.On("GetJWK", "key-1").Return(&JWK{Kty: "RSA", Kid: "key-1", Alg: "RS256", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())}, nil)
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+
+	// act
+	err := jwtHandler.ValidateJWTToken(signTestToken(jwt.SigningMethodPS256, key))
+
+	// assert
+	a.Error(err)
+	a.Contains(err.Error(), "not meant for PS256")
+}
+
+func TestJWTValidation_whenCurveDoesNotFitAlgorithm_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	mc := &MockOIDClient{}
+	mc.On("GetJWK", "key-1").Return(&JWK{Kty: "EC", Crv: "P-384", Kid: "key-1", X: encode(key.X.Bytes()), Y: encode(key.Y.Bytes())}, nil)
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+	// swap the header of a P-384 signed token to claim ES256
+	signed := strings.SplitN(signTestToken(jwt.SigningMethodES384, key), ".", 2)
+	header := encode([]byte(`{"alg":"ES256","kid":"key-1","typ":"JWT"}`))
+
+	// act
+	err := jwtHandler.ValidateJWTToken(header + "." + signed[1])
+
+	// assert
+	a.Error(err)
+	a.Contains(err.Error(), "does not fit signing method ES256")
+}
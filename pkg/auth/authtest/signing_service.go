@@ -0,0 +1,96 @@
+// Package authtest provides a local stand-in for the remote signing service
+package authtest
+
+import (
+	"encoding/json"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	"github.com/gorilla/mux"
+	"gopkg.in/square/go-jose.v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+)
+
+// SigningService keeps its keys in memory and speaks the protocol of auth.NewRemoteSigningService
+type SigningService struct {
+	*httptest.Server
+	mutex sync.Mutex
+	keys  map[string]auth.Signer
+	next  int
+}
+
+// NewSigningService starts the stub, close it when done
+func NewSigningService() *SigningService {
+	service := &SigningService{keys: map[string]auth.Signer{}}
+	router := mux.NewRouter()
+	router.HandleFunc("/keys", service.createKey).Methods(http.MethodPost)
+	router.HandleFunc("/keys/{id}/sign", service.sign).Methods(http.MethodPost)
+	router.HandleFunc("/keys/{id}", service.deleteKey).Methods(http.MethodDelete)
+	service.Server = httptest.NewServer(router)
+	return service
+}
+
+// KeyCount returns the number of keys the service holds
+func (s *SigningService) KeyCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.keys)
+}
+
+func (s *SigningService) createKey(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	signer, err := auth.GenerateLocalSigner(request.Algorithm)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.Lock()
+	s.next++
+	id := "stub-" + strconv.Itoa(s.next)
+	s.keys[id] = signer
+	s.mutex.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":  id,
+		"jwk": jose.JSONWebKey{Key: signer.Public(), Algorithm: signer.Algorithm(), Use: "sig"},
+	})
+}
+
+func (s *SigningService) sign(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	signer, ok := s.keys[mux.Vars(r)["id"]]
+	s.mutex.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var request struct {
+		Algorithm string `json:"alg"`
+		Input     string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Algorithm != signer.Algorithm() {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	signature, err := signer.Sign(request.Input)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"signature": signature})
+}
+
+func (s *SigningService) deleteKey(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	delete(s.keys, mux.Vars(r)["id"])
+	s.mutex.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
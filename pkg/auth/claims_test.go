@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func signClaimsTestToken(key *ecdsa.PrivateKey, typ string, claims jwt.MapClaims) string {
+	claims["iss"] = testIssuer
+	claims["aud"] = "yep"
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = "key-1"
+	token.Header["typ"] = typ
+	signed, _ := token.SignedString(key)
+	return signed
+}
+
+func TestJWTValidation_whenTimeClaimsWithinLeeway_thenSucceed(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, mc := newPolicyTestKey("key-1")
+	now := time.Now()
+	jwtHandler := NewMultiIssuerJwtHandler([]ValidationPolicy{{Issuer: testIssuer, Audiences: []string{"yep"}, OIDClient: mc, Leeway: time.Minute}})
+	strict := NewJwtHandler(mc, testIssuer, "yep")
+	skewed := signClaimsTestToken(key, "at+jwt", jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix(), "nbf": now.Add(30 * time.Second).Unix(), "iat": now.Add(30 * time.Second).Unix()})
+
+	// act
+	err := jwtHandler.ValidateJWTToken(skewed)
+	strictErr := strict.ValidateJWTToken(skewed)
+
+	// assert
+	a.NoError(err)
+	a.True(errors.Is(strictErr, ErrTokenExpired))
+}
+
+func TestJWTValidation_whenTimeClaimsInvalid_thenFailWithTypedError(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, mc := newPolicyTestKey("key-1")
+	otherKey, _ := newPolicyTestKey("key-1")
+	now := time.Now()
+	jwtHandler := NewMultiIssuerJwtHandler([]ValidationPolicy{{Issuer: testIssuer, Audiences: []string{"yep"}, OIDClient: mc, MaxAge: time.Hour, RequiredClaims: []string{"exp", "sub"}}})
+
+	// act
+	premature := jwtHandler.ValidateJWTToken(signClaimsTestToken(key, "at+jwt", jwt.MapClaims{"exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix(), "iat": now.Unix(), "sub": "user"}))
+	tooOld := jwtHandler.ValidateJWTToken(signClaimsTestToken(key, "at+jwt", jwt.MapClaims{"exp": now.Add(time.Minute).Unix(), "iat": now.Add(-2 * time.Hour).Unix(), "sub": "user"}))
+	withoutSubject := jwtHandler.ValidateJWTToken(signClaimsTestToken(key, "at+jwt", jwt.MapClaims{"exp": now.Add(time.Minute).Unix(), "iat": now.Unix()}))
+	forged := jwtHandler.ValidateJWTToken(signClaimsTestToken(otherKey, "at+jwt", jwt.MapClaims{"exp": now.Add(-time.Minute).Unix(), "iat": now.Unix(), "sub": "user"}))
+
+	// assert
+	a.True(errors.Is(premature, ErrTokenNotValidYet))
+	a.True(errors.Is(tooOld, ErrTokenTooOld))
+	a.True(errors.Is(withoutSubject, ErrTokenClaimMissing))
+	a.True(errors.Is(forged, ErrTokenSignatureInvalid))
+	a.False(errors.Is(forged, ErrTokenExpired))
+}
+
+func TestJWTValidation_whenOtherTokenType_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, mc := newPolicyTestKey("key-1")
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+	exp := time.Now().Add(time.Minute).Unix()
+
+	// act
+	accessErr := jwtHandler.ValidateJWTToken(signClaimsTestToken(key, "at+jwt", jwt.MapClaims{"exp": exp, "typ": "Bearer"}))
+	logoutErr := jwtHandler.ValidateJWTToken(signClaimsTestToken(key, "logout+jwt", jwt.MapClaims{"exp": exp}))
+	idErr := jwtHandler.ValidateJWTToken(signClaimsTestToken(key, "JWT", jwt.MapClaims{"exp": exp, "typ": "ID"}))
+
+	// assert
+	a.NoError(accessErr)
+	a.True(errors.Is(logoutErr, ErrTokenTypeInvalid))
+	a.True(errors.Is(idErr, ErrTokenTypeInvalid))
+}
+
+func TestJWTValidation_whenIDTokenOfForeignIssuer_thenFailUnlessUntypedTokensAccepted(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, mc := newPolicyTestKey("key-1")
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+	lenient := NewMultiIssuerJwtHandler([]ValidationPolicy{{Issuer: testIssuer, Audiences: []string{"yep"}, OIDClient: mc, AcceptUntypedTokens: true}})
+	exp := time.Now().Add(time.Minute).Unix()
+	idToken := signClaimsTestToken(key, "JWT", jwt.MapClaims{"exp": exp, "sub": "user-1", "nonce": "n-0S6_WzA2Mj"})
+	keycloakToken := signClaimsTestToken(key, "JWT", jwt.MapClaims{"exp": exp, "sub": "user-1", "typ": "Bearer"})
+
+	// act
+	idErr := jwtHandler.ValidateJWTToken(idToken)
+	keycloakErr := jwtHandler.ValidateJWTToken(keycloakToken)
+	lenientErr := lenient.ValidateJWTToken(idToken)
+
+	// assert
+	a.True(errors.Is(idErr, ErrTokenTypeInvalid))
+	a.NoError(keycloakErr)
+	a.NoError(lenientErr)
+}
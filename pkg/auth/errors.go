@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Kinds of TokenError, to be matched with errors.Is
+var (
+	ErrTokenMalformed        = errors.New("token is malformed")
+	ErrTokenUnverifiable     = errors.New("token cannot be verified")
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	ErrTokenExpired          = errors.New("token is expired")
+	ErrTokenNotValidYet      = errors.New("token is not valid yet")
+	ErrTokenTooOld           = errors.New("token is too old")
+	ErrTokenClaimMissing     = errors.New("token claim is missing")
+	ErrTokenTypeInvalid      = errors.New("token has the wrong type")
+	ErrTokenUnauthorized     = errors.New("token is not meant for us")
+)
+
+// TokenError tells why a token was rejected. Expired or premature tokens are a client matter, the other kinds point at a forged or misdirected token.
+type TokenError struct {
+	Kind    error
+	message string
+}
+
+func newTokenError(kind error, format string, args ...interface{}) *TokenError {
+	return &TokenError{Kind: kind, message: fmt.Sprintf(format, args...)}
+}
+
+func (e *TokenError) Error() string {
+	return e.message
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Kind
+}
+
+// parseError turns the error of jwt-go's parser into a TokenError
+func parseError(err error) error {
+	var tokenError *TokenError
+	if errors.As(err, &tokenError) {
+		return tokenError
+	}
+	kind := ErrTokenMalformed
+	if validationError, ok := err.(*jwt.ValidationError); ok {
+		if inner, ok := validationError.Inner.(*TokenError); ok {
+			return inner
+		}
+		switch {
+		case validationError.Errors&jwt.ValidationErrorUnverifiable != 0:
+			kind = ErrTokenUnverifiable
+		case validationError.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			kind = ErrTokenSignatureInvalid
+		}
+	}
+	return newTokenError(kind, "unable to validate JWT Token: %v", err)
+}
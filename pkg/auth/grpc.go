@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+type grpcInterceptors struct {
+	authenticator Authenticator
+	requirements  map[string]Requirement
+}
+
+// authenticatedStream hands the principal to stream handlers through its context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// NewGRPCInterceptors creates the server interceptors validating the bearer token of the authorization metadata.
+// Requirements are keyed by full method name, e.g. "/yep.Modules/Delete". Other methods only need a valid token.
+func NewGRPCInterceptors(authenticator Authenticator, requirements map[string]Requirement) *grpcInterceptors {
+	return &grpcInterceptors{authenticator: authenticator, requirements: requirements}
+}
+
+// Unary returns the interceptor of unary calls, the handler finds the principal with PrincipalFrom
+func (gi *grpcInterceptors) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := gi.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns the interceptor of streaming calls, the handler finds the principal in the stream's context
+func (gi *grpcInterceptors) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := gi.authenticate(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+func (gi *grpcInterceptors) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := md.Get("authorization")
+	if len(authorization) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "bearer token required")
+	}
+	parts := strings.SplitN(authorization[0], " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return nil, status.Error(codes.Unauthenticated, "bearer token required")
+	}
+
+	principal, err := gi.authenticator.Authenticate(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	requirement := gi.requirements[fullMethod]
+	if !principal.HasScopes(requirement.Scopes...) {
+		return nil, status.Errorf(codes.PermissionDenied, "insufficient scope, %s required", strings.Join(requirement.Scopes, " "))
+	}
+	if !requirement.rolesGrantedTo(principal) {
+		return nil, status.Error(codes.PermissionDenied, "insufficient roles")
+	}
+	if !requirement.authenticationSufficient(principal, time.Now()) {
+		params := requirement.stepUpParams()
+		required := []string{}
+		for i := 0; i+1 < len(params); i += 2 {
+			required = append(required, params[i]+"="+params[i+1])
+		}
+		return nil, status.Errorf(codes.Unauthenticated, "insufficient_user_authentication, %s required", strings.Join(required, " "))
+	}
+	return WithPrincipal(ctx, principal), nil
+}
+
+func (as *authenticatedStream) Context() context.Context {
+	return as.ctx
+}
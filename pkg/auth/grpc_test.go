@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ts *testServerStream) Context() context.Context {
+	return ts.ctx
+}
+
+func newGRPCTest() (*grpcInterceptors, string) {
+	bearer, token := newMiddlewareTest()
+	interceptors := NewGRPCInterceptors(bearer.authenticator, map[string]Requirement{
+		"/yep.Modules/Delete": {Scopes: []string{"modules:write"}},
+	})
+	return interceptors, token
+}
+
+func TestGRPCInterceptors_whenTokenValid_thenPassPrincipal(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	interceptors, token := newGRPCTest()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	var unaryPrincipal, streamPrincipal *Principal
+
+	// act
+	_, unaryErr := interceptors.Unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/yep.Modules/Read"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		unaryPrincipal, _ = PrincipalFrom(ctx)
+		return nil, nil
+	})
+	streamErr := interceptors.Stream()(nil, &testServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/yep.Modules/Watch"}, func(srv interface{}, stream grpc.ServerStream) error {
+		streamPrincipal, _ = PrincipalFrom(stream.Context())
+		return nil
+	})
+
+	// assert
+	a.NoError(unaryErr)
+	a.NoError(streamErr)
+	a.Equal("user-1", unaryPrincipal.Subject)
+	a.Equal("user-1", streamPrincipal.Subject)
+}
+
+func TestGRPCInterceptors_whenUnauthenticatedOrMissingScope_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	interceptors, token := newGRPCTest()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	valid := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	invalid := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token+"x"))
+
+	// act
+	_, missingErr := interceptors.Unary()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/yep.Modules/Read"}, handler)
+	_, invalidErr := interceptors.Unary()(invalid, nil, &grpc.UnaryServerInfo{FullMethod: "/yep.Modules/Read"}, handler)
+	_, scopeErr := interceptors.Unary()(valid, nil, &grpc.UnaryServerInfo{FullMethod: "/yep.Modules/Delete"}, handler)
+
+	// assert
+	a.Equal(codes.Unauthenticated, status.Code(missingErr))
+	a.Equal(codes.Unauthenticated, status.Code(invalidErr))
+	a.Equal(codes.PermissionDenied, status.Code(scopeErr))
+}
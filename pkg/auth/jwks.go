@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned for a kid the issuer's JWKS does not hold even after a refetch
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// publicKeyClient is implemented by OIDClients caching decoded public keys, which spares decoding the JWK on every validation
+type publicKeyClient interface {
+	GetPublicKey(kid string) (*JWK, crypto.PublicKey, error)
+}
+
+type cachedKey struct {
+	jwk       *JWK
+	publicKey crypto.PublicKey
+}
+
+// jwksFetch lets concurrent lookups wait for the same request
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+type jwksClient struct {
+	httpClient *http.Client
+	issuer     string
+	ttl        time.Duration
+	// minRefreshInterval limits how often an unknown kid triggers a refetch
+	minRefreshInterval time.Duration
+
+	mutex     sync.Mutex
+	jwksURI   string
+	keys      map[string]*cachedKey
+	expiresAt time.Time
+	fetchedAt time.Time
+	fetch     *jwksFetch
+}
+
+type providerMetadata struct {
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// NewJWKSClient creates the OIDClient finding the issuer's JWKS through discovery.
+// Keys are cached for the max-age the JWKS response allows, the ttl if it names none.
+// An unknown kid refetches the JWKS, at most once per minRefreshInterval.
+func NewJWKSClient(httpClient *http.Client, issuer string, ttl time.Duration, minRefreshInterval time.Duration) *jwksClient {
+	return &jwksClient{
+		httpClient:         httpClient,
+		issuer:             strings.TrimSuffix(issuer, "/"),
+		ttl:                ttl,
+		minRefreshInterval: minRefreshInterval,
+	}
+}
+
+func (jc *jwksClient) GetJWK(kid string) (*JWK, error) {
+	jwk, _, err := jc.GetPublicKey(kid)
+	return jwk, err
+}
+
+// GetPublicKey returns the JWK with its decoded public key
+func (jc *jwksClient) GetPublicKey(kid string) (*JWK, crypto.PublicKey, error) {
+	key, refetch := jc.lookup(kid)
+	if refetch {
+		err := jc.refresh()
+		// a key the issuer still published before a failed fetch stays usable
+		if key, _ = jc.lookup(kid); key == nil && err != nil {
+			return nil, nil, err
+		}
+	}
+	if key == nil {
+		return nil, nil, fmt.Errorf("%w %s", ErrUnknownKey, kid)
+	}
+	return key.jwk, key.publicKey, nil
+}
+
+// lookup returns the cached key, even an expired one, and whether the JWKS should be fetched again
+func (jc *jwksClient) lookup(kid string) (*cachedKey, bool) {
+	jc.mutex.Lock()
+	defer jc.mutex.Unlock()
+	now := time.Now()
+	key := jc.keys[kid]
+	mayRefetch := jc.keys == nil || !now.Before(jc.fetchedAt.Add(jc.minRefreshInterval))
+	return key, mayRefetch && (key == nil || !now.Before(jc.expiresAt))
+}
+
+// refresh fetches the JWKS, joining a fetch already in flight
+func (jc *jwksClient) refresh() error {
+	jc.mutex.Lock()
+	if fetch := jc.fetch; fetch != nil {
+		jc.mutex.Unlock()
+		<-fetch.done
+		return fetch.err
+	}
+	fetch := &jwksFetch{done: make(chan struct{})}
+	jc.fetch = fetch
+	jwksURI := jc.jwksURI
+	jc.mutex.Unlock()
+
+	keys, maxAge, err := jc.fetchKeys(jwksURI)
+
+	jc.mutex.Lock()
+	now := time.Now()
+	jc.fetchedAt = now
+	if err == nil {
+		jc.keys = keys
+		jc.expiresAt = now.Add(maxAge)
+	} else if jc.keys == nil {
+		jc.keys = map[string]*cachedKey{}
+	}
+	jc.fetch = nil
+	jc.mutex.Unlock()
+
+	fetch.err = err
+	close(fetch.done)
+	return err
+}
+
+func (jc *jwksClient) fetchKeys(jwksURI string) (map[string]*cachedKey, time.Duration, error) {
+	if jwksURI == "" {
+		var metadata providerMetadata
+		if _, err := jc.getJSON(jc.issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+			return nil, 0, err
+		}
+		if metadata.JWKSURI == "" {
+			return nil, 0, errors.New("issuer metadata names no jwks_uri")
+		}
+		jwksURI = metadata.JWKSURI
+		jc.mutex.Lock()
+		jc.jwksURI = jwksURI
+		jc.mutex.Unlock()
+	}
+
+	var jwks JWK
+	header, err := jc.getJSON(jwksURI, &jwks)
+	if err != nil {
+		return nil, 0, err
+	}
+	keys := map[string]*cachedKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := decodePublicKey(jwk)
+		if err != nil {
+			log.Warnf("Ignoring key %s of the issuer's JWKS: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = &cachedKey{jwk: jwk, publicKey: publicKey}
+	}
+	return keys, jc.maxAge(header), nil
+}
+
+// maxAge is the time the Cache-Control header allows to cache the response, the ttl if it does not say
+func (jc *jwksClient) maxAge(header http.Header) time.Duration {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(strings.ToLower(directive))
+		if directive == "no-cache" || directive == "no-store" {
+			return 0
+		}
+		if strings.HasPrefix(directive, "max-age=") {
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		if maxAge := time.Until(expires); maxAge > 0 {
+			return maxAge
+		}
+		return 0
+	}
+	return jc.ttl
+}
+
+func (jc *jwksClient) getJSON(url string, response interface{}) (http.Header, error) {
+	httpResponse, err := jc.httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %v", url, err)
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch %s: status %d", url, httpResponse.StatusCode)
+	}
+	if err := json.NewDecoder(httpResponse.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("malformed response of %s: %v", url, err)
+	}
+	return httpResponse.Header, nil
+}
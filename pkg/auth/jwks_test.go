@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type jwksIssuer struct {
+	*httptest.Server
+	mutex        sync.Mutex
+	keys         []jose.JSONWebKey
+	cacheControl string
+	fetches      int32
+	// release holds back JWKS responses until it is closed, if set
+	release chan struct{}
+}
+
+func newJWKSIssuer(kids ...string) *jwksIssuer {
+	issuer := &jwksIssuer{}
+	for _, kid := range kids {
+		issuer.addKey(kid)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuer.URL + "/certs"})
+	})
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&issuer.fetches, 1)
+		if issuer.release != nil {
+			<-issuer.release
+		}
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		if issuer.cacheControl != "" {
+			w.Header().Set("Cache-Control", issuer.cacheControl)
+		}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: issuer.keys})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	return issuer
+}
+
+func (issuer *jwksIssuer) addKey(kid string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	issuer.keys = append(issuer.keys, jose.JSONWebKey{Key: key.Public(), KeyID: kid, Algorithm: "ES256", Use: "sig"})
+}
+
+func (issuer *jwksIssuer) fetchCount() int {
+	return int(atomic.LoadInt32(&issuer.fetches))
+}
+
+func TestJWKSClient_whenKeyCached_thenFetchOnce(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	issuer := newJWKSIssuer("key-1")
+	defer issuer.Close()
+	client := NewJWKSClient(http.DefaultClient, issuer.URL, time.Hour, time.Minute)
+
+	// act
+	first, firstErr := client.GetJWK("key-1")
+	_, publicKey, secondErr := client.GetPublicKey("key-1")
+
+	// assert
+	a.NoError(firstErr)
+	a.NoError(secondErr)
+	a.Equal("EC", first.Kty)
+	a.IsType(&ecdsa.PublicKey{}, publicKey)
+	a.Equal(1, issuer.fetchCount())
+}
+
+func TestJWKSClient_whenCacheControlForbidsCaching_thenRefetch(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	issuer := newJWKSIssuer("key-1")
+	issuer.cacheControl = "no-cache"
+	defer issuer.Close()
+	client := NewJWKSClient(http.DefaultClient, issuer.URL, time.Hour, 0)
+
+	// act
+	_, _ = client.GetJWK("key-1")
+	_, err := client.GetJWK("key-1")
+
+	// assert
+	a.NoError(err)
+	a.Equal(2, issuer.fetchCount())
+}
+
+func TestJWKSClient_whenKidUnknown_thenRefetchRateLimited(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	issuer := newJWKSIssuer("key-1")
+	defer issuer.Close()
+	rotating := NewJWKSClient(http.DefaultClient, issuer.URL, time.Hour, 0)
+	limited := NewJWKSClient(http.DefaultClient, issuer.URL, time.Hour, time.Hour)
+	_, _ = rotating.GetJWK("key-1")
+	_, _ = limited.GetJWK("key-1")
+	issuer.addKey("key-2")
+
+	// act
+	rotated, rotatedErr := rotating.GetJWK("key-2")
+	_, limitedErr := limited.GetJWK("key-2")
+
+	// assert
+	a.NoError(rotatedErr)
+	a.Equal("key-2", rotated.Kid)
+	a.True(errors.Is(limitedErr, ErrUnknownKey))
+	a.Equal(3, issuer.fetchCount())
+}
+
+func TestJWKSClient_whenConcurrentLookups_thenShareFetch(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	issuer := newJWKSIssuer("key-1")
+	issuer.release = make(chan struct{})
+	defer issuer.Close()
+	client := NewJWKSClient(http.DefaultClient, issuer.URL, time.Hour, time.Minute)
+	errs := make(chan error, 10)
+
+	// act
+	for i := 0; i < 10; i++ {
+		go func() {
+			_, err := client.GetJWK("key-1")
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(issuer.release)
+
+	// assert
+	for i := 0; i < 10; i++ {
+		a.NoError(<-errs)
+	}
+	a.Equal(1, issuer.fetchCount())
+}
@@ -1,82 +1,401 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	log "github.com/sirupsen/logrus"
 	"math/big"
 	"strings"
+	"time"
 )
 
 type OIDClient interface {
 	GetJWK(kid string) (*JWK, error)
 }
 
+// DefaultAllowedAlgorithms are accepted when no algorithm allowlist is given
+var DefaultAllowedAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// DefaultTokenTypes are the typ header values of access tokens accepted when a policy names none (RFC 9068)
+var DefaultTokenTypes = []string{"at+jwt"}
+
+// DefaultRequiredClaims must be present in tokens when a policy names no required claims
+var DefaultRequiredClaims = []string{"exp"}
+
+// ValidationPolicy trusts the tokens an issuer signs for one of the audiences
+type ValidationPolicy struct {
+	Issuer    string
+	Audiences []string
+	// AuthorizedParties restricts the azp claim if the token has one, any party is accepted if empty
+	AuthorizedParties []string
+	OIDClient         OIDClient
+	// Leeway tolerates clock skew between the issuer and us in the exp, nbf and iat checks
+	Leeway time.Duration
+	// MaxAge rejects tokens issued longer ago, there is no limit if it is zero
+	MaxAge         time.Duration
+	RequiredClaims []string
+	// TokenTypes are the typ header values of access tokens. Tokens typed JWT or not at all are accepted if their typ
+	// claim is Bearer, like the access tokens of ours and Keycloak.
+	TokenTypes []string
+	// AcceptUntypedTokens accepts tokens typed JWT or not at all without typ claim. Such tokens cannot be told apart
+	// from ID tokens, so only issuers which type their tokens neither way need it.
+	AcceptUntypedTokens bool
+}
+
 type jwtHandler struct {
-	oidClient                   OIDClient
-	authTokenValidationIssuer   string
-	authTokenValidationAudience string
+	policies          []ValidationPolicy
+	allowedAlgorithms []string
+}
+
+// NewJwtHandler creates the validator of the issuer's tokens. Only the given signing algorithms are accepted, DefaultAllowedAlgorithms if there are none.
+func NewJwtHandler(oidClient OIDClient, authTokenValidationIssuer string, authTokenValidationAudience string, allowedAlgorithms ...string) *jwtHandler {
+	return NewMultiIssuerJwtHandler([]ValidationPolicy{{
+		Issuer:    authTokenValidationIssuer,
+		Audiences: []string{authTokenValidationAudience},
+		OIDClient: oidClient,
+	}}, allowedAlgorithms...)
 }
 
-func NewJwtHandler(oidClient OIDClient, authTokenValidationIssuer string, authTokenValidationAudience string) *jwtHandler {
+// NewMultiIssuerJwtHandler creates the validator of tokens of several trusted issuers, each verified with its own keys
+func NewMultiIssuerJwtHandler(policies []ValidationPolicy, allowedAlgorithms ...string) *jwtHandler {
+	if len(allowedAlgorithms) == 0 {
+		allowedAlgorithms = DefaultAllowedAlgorithms
+	}
 	jwtHandler := &jwtHandler{
-		oidClient:                   oidClient,
-		authTokenValidationIssuer:   authTokenValidationIssuer,
-		authTokenValidationAudience: authTokenValidationAudience,
+		policies:          policies,
+		allowedAlgorithms: allowedAlgorithms,
 	}
 
 	return jwtHandler
 }
 
+// ValidateJWTToken validates the token for callers that do not need to know who sent it
 func (jh *jwtHandler) ValidateJWTToken(tokenString string) error {
+	_, err := jh.Authenticate(tokenString)
+	return err
+}
+
+// Authenticate validates the token and returns the caller it was issued to
+func (jh *jwtHandler) Authenticate(tokenString string) (*Principal, error) {
 	// Strip "Bearer " from token string
 	authToken := strings.Replace(tokenString, "Bearer ", "", 1)
 
 	// Parse authToken
-	parsedToken, err := jwt.Parse(authToken, func(token *jwt.Token) (interface{}, error) {
-		// Check for RSA signing method
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			log.Printf("===== Unexpected signing method: %v =====", token.Header["alg"])
+	var policy *ValidationPolicy
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	parsedToken, err := parser.Parse(authToken, func(token *jwt.Token) (interface{}, error) {
+		// Check for an allowed signing method
+		if !jh.allowsAlgorithm(token.Method.Alg()) {
+			log.Debugf("unexpected signing method: %v", token.Header["alg"])
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		// Lookup and return signing key
-		key, err := jh.oidClient.GetJWK(token.Header["kid"].(string))
+		// Lookup and return signing key of the token's issuer
+		var err error
+		if policy, err = jh.policyFor(token.Claims.(jwt.MapClaims)); err != nil {
+			return nil, err
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, publicKey, err := publicKeyOf(policy.OIDClient, kid)
 		if err != nil {
 			return nil, err
 		}
-		return decodePublicKey(key)
+		// A key bound to an algorithm must not be used with another one
+		if key.Alg != "" && key.Alg != token.Method.Alg() {
+			return nil, fmt.Errorf("key %s is not meant for %s", kid, token.Method.Alg())
+		}
+		if !keyMatchesMethod(publicKey, token.Method) {
+			return nil, fmt.Errorf("key %s does not fit signing method %s", kid, token.Method.Alg())
+		}
+		return publicKey, nil
 	})
 
 	if err != nil {
-		return fmt.Errorf("unable to validate JWT Token: %v", err)
+		return nil, parseError(err)
 	}
 
-	return jh.validateClaims(parsedToken)
+	if err := validateTokenType(policy, parsedToken); err != nil {
+		return nil, err
+	}
+	claims := parsedToken.Claims.(jwt.MapClaims)
+	if err := validateTimes(policy, claims, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := validateClaims(policy, parsedToken); err != nil {
+		return nil, err
+	}
+	return NewPrincipal(claims), nil
 }
 
-func (jh *jwtHandler) validateClaims(parsedToken *jwt.Token) error {
+// policyFor returns the policy of the token's issuer. Tokens of other issuers are rejected before any key is looked up.
+func (jh *jwtHandler) policyFor(claims jwt.MapClaims) (*ValidationPolicy, error) {
+	for i := range jh.policies {
+		if claims["iss"] == jh.policies[i].Issuer {
+			return &jh.policies[i], nil
+		}
+	}
+	return nil, newTokenError(ErrTokenUnauthorized, "unauthorized issuer")
+}
+
+func validateClaims(policy *ValidationPolicy, parsedToken *jwt.Token) error {
 	claims := parsedToken.Claims.(jwt.MapClaims)
 	log.Debugln("Claims: ", claims)
-	validIssuer := jh.authTokenValidationIssuer
-	log.Debugln("Issuer Check ", validIssuer, claims["iss"])
-	if claims["iss"] != validIssuer {
-		return fmt.Errorf("unauthorized issuer")
+	log.Debugln("Issuer Check ", policy.Issuer, claims["iss"])
+	if claims["iss"] != policy.Issuer {
+		return newTokenError(ErrTokenUnauthorized, "unauthorized issuer")
+	}
+	audiences := audiencesOf(claims)
+	log.Debugln("Audience Check ", policy.Audiences, audiences)
+	if !containsAny(policy.Audiences, audiences) {
+		return newTokenError(ErrTokenUnauthorized, "unauthorized audience")
+	}
+	if azp, ok := claims["azp"]; ok && len(policy.AuthorizedParties) > 0 {
+		party, _ := azp.(string)
+		if !containsAny(policy.AuthorizedParties, []string{party}) {
+			return newTokenError(ErrTokenUnauthorized, "unauthorized party")
+		}
+	}
+	return nil
+}
+
+// validateTokenType keeps ID, logout and other tokens from being replayed as access tokens. A token has to be typed as
+// access token in its typ header, or in its typ claim as issuers like ours and Keycloak do.
+func validateTokenType(policy *ValidationPolicy, parsedToken *jwt.Token) error {
+	tokenTypes := policy.TokenTypes
+	if len(tokenTypes) == 0 {
+		tokenTypes = DefaultTokenTypes
+	}
+	headerType := ""
+	if typ, ok := parsedToken.Header["typ"]; ok {
+		headerType, _ = typ.(string)
+		headerType = strings.TrimPrefix(strings.ToLower(headerType), "application/")
+	}
+	claimType, typed := parsedToken.Claims.(jwt.MapClaims)["typ"]
+	if typed && claimType != "Bearer" {
+		return newTokenError(ErrTokenTypeInvalid, "unexpected token type %v", claimType)
+	}
+	if containsFold(tokenTypes, headerType) {
+		return nil
+	}
+	if headerType != "" && headerType != "jwt" {
+		return newTokenError(ErrTokenTypeInvalid, "unexpected token type %v", parsedToken.Header["typ"])
+	}
+	if !typed && !policy.AcceptUntypedTokens {
+		return newTokenError(ErrTokenTypeInvalid, "token is not typed as access token")
+	}
+	return nil
+}
+
+// validateTimes checks the required claims and the exp, nbf and iat claims, tolerating the policy's leeway
+func validateTimes(policy *ValidationPolicy, claims jwt.MapClaims, now time.Time) error {
+	requiredClaims := policy.RequiredClaims
+	if requiredClaims == nil {
+		requiredClaims = DefaultRequiredClaims
+	}
+	for _, claim := range requiredClaims {
+		if _, ok := claims[claim]; !ok {
+			return newTokenError(ErrTokenClaimMissing, "missing claim %s", claim)
+		}
+	}
+
+	expiresAt, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if expiresAt != nil && !now.Before(expiresAt.Add(policy.Leeway)) {
+		return newTokenError(ErrTokenExpired, "Token is expired by %v", now.Sub(*expiresAt).Truncate(time.Second))
+	}
+	notBefore, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if notBefore != nil && now.Add(policy.Leeway).Before(*notBefore) {
+		return newTokenError(ErrTokenNotValidYet, "Token is not valid yet")
+	}
+	issuedAt, err := numericDate(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if issuedAt != nil && now.Add(policy.Leeway).Before(*issuedAt) {
+		return newTokenError(ErrTokenNotValidYet, "Token used before issued")
+	}
+	if policy.MaxAge > 0 {
+		if issuedAt == nil {
+			return newTokenError(ErrTokenClaimMissing, "missing claim iat")
+		}
+		if now.Sub(*issuedAt) > policy.MaxAge+policy.Leeway {
+			return newTokenError(ErrTokenTooOld, "Token was issued more than %v ago", policy.MaxAge)
+		}
 	}
-	validAudience := jh.authTokenValidationAudience
-	claimAudienceString := fmt.Sprintf("%v", claims["aud"])
-	log.Debugln("Audience Check ", validAudience, claimAudienceString, !strings.Contains(claimAudienceString, validAudience))
-	if !strings.Contains(claimAudienceString, validAudience) {
-		return fmt.Errorf("unauthorized audience")
+	return nil
+}
+
+// numericDate reads a NumericDate claim, nil if the token has none
+func numericDate(claims jwt.MapClaims, name string) (*time.Time, error) {
+	var seconds float64
+	switch value := claims[name].(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		seconds = value
+	case json.Number:
+		parsed, err := value.Float64()
+		if err != nil {
+			return nil, newTokenError(ErrTokenMalformed, "malformed claim %s", name)
+		}
+		seconds = parsed
+	default:
+		return nil, newTokenError(ErrTokenMalformed, "malformed claim %s", name)
+	}
+	date := time.Unix(0, int64(seconds*float64(time.Second)))
+	return &date, nil
+}
+
+// audiencesOf reads the aud claim, which is a single string or an array of strings
+func audiencesOf(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		audiences := []string{}
+		for _, value := range aud {
+			if audience, ok := value.(string); ok {
+				audiences = append(audiences, audience)
+			}
+		}
+		return audiences
 	}
 	return nil
 }
 
-func decodePublicKey(jwk *JWK) (*rsa.PublicKey, error) {
+func containsFold(allowed []string, value string) bool {
+	for _, candidate := range allowed {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether one of the values matches one of the allowed ones exactly
+func containsAny(allowed []string, values []string) bool {
+	for _, value := range values {
+		for _, candidate := range allowed {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publicKeyOf looks up the JWK of the kid, decoding it unless the client caches decoded keys
+func publicKeyOf(oidClient OIDClient, kid string) (*JWK, crypto.PublicKey, error) {
+	if client, ok := oidClient.(publicKeyClient); ok {
+		return client.GetPublicKey(kid)
+	}
+	key, err := oidClient.GetJWK(kid)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := decodePublicKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, publicKey, nil
+}
+
+func (jh *jwtHandler) allowsAlgorithm(alg string) bool {
+	for _, allowed := range jh.allowedAlgorithms {
+		if allowed == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// keyMatchesMethod prevents verifying a token with a key of another type than its algorithm needs
+func keyMatchesMethod(key crypto.PublicKey, method jwt.SigningMethod) bool {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		return ok && ecKey.Curve.Params().BitSize == method.(*jwt.SigningMethodECDSA).CurveBits
+	case *signingMethodEdDSA:
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	}
+	return false
+}
+
+// decodePublicKey turns an RSA, EC or OKP (Ed25519) JWK into its public key
+func decodePublicKey(jwk *JWK) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		return decodeRSAPublicKey(jwk)
+	case "EC":
+		return decodeECPublicKey(jwk)
+	case "OKP":
+		return decodeOKPPublicKey(jwk)
+	}
+	return nil, fmt.Errorf("unsupported JWK key type %s", jwk.Kty)
+}
+
+func decodeECPublicKey(jwk *JWK) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported JWK curve %s", jwk.Crv)
+	}
+
+	decodedX, err := safeDecode(jwk.X)
+	if err != nil {
+		return nil, errors.New("malformed JWK EC key")
+	}
+	decodedY, err := safeDecode(jwk.Y)
+	if err != nil {
+		return nil, errors.New("malformed JWK EC key")
+	}
+	pubKey := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(decodedX),
+		Y:     new(big.Int).SetBytes(decodedY),
+	}
+	if !curve.IsOnCurve(pubKey.X, pubKey.Y) {
+		return nil, errors.New("JWK EC point is not on the curve")
+	}
+	return pubKey, nil
+}
+
+func decodeOKPPublicKey(jwk *JWK) (ed25519.PublicKey, error) {
+	if jwk.Crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported JWK curve %s", jwk.Crv)
+	}
+	decodedX, err := safeDecode(jwk.X)
+	if err != nil || len(decodedX) != ed25519.PublicKeySize {
+		return nil, errors.New("malformed JWK OKP key")
+	}
+	return ed25519.PublicKey(decodedX), nil
+}
+
+func decodeRSAPublicKey(jwk *JWK) (*rsa.PublicKey, error) {
 	// decode exponent
 	decodedE, err := safeDecode(jwk.E)
 	if err != nil {
@@ -85,7 +85,7 @@ func TestJWTValidation_whenIssuerMismatch_thenFail(t *testing.T) {
 	err := jwtHandler.ValidateJWTToken(tokenString)
 
 	// assert
-	mc.AssertExpectations(t)
+	mc.AssertNotCalled(t, "GetJWK", kid)
 	assert.EqualError(t, err, "unauthorized issuer")
 }
 
@@ -119,7 +119,7 @@ func TestJWTValidation_whenTokenIsNotValid_thenFail(t *testing.T) {
 	// arrange
 	a := assert.New(t)
 	mc := &MockOIDClient{}
-	authTokenValidationIssuer := "https://account-oidcmock-mfm-general.ae.dev.cloudhh.de/auth/realms/Fielmann"
+	authTokenValidationIssuer := "https://sso-general-auth.ae.qa.cloudhh.de/auth/realms/Fielmann"
 	authTokenValidationAudience := "oidcmock"
 	jwtHandler := NewJwtHandler(mc, authTokenValidationIssuer, authTokenValidationAudience)
 	invalidTokenString := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCIsImtpZCI6IkN3Sk12ZXNLdUVqdkJPZFppaTM3dkZKbDJZMzBKWG41Y1ZPMzRielZhWTQifQ.ewogICJqdGkiOiAiY2I1ZWIwMmYtZmU3Mi00NTJkLWE2NzItNzcwMTI2YTFkMDlmIiwKICAiZXhwIjogNDEwMjM1ODQwMCwKICAibmJmIjogMCwKICAiaWF0IjogNDEwMjM1ODQwMCwKICAiaXNzIjogImh0dHBzOi8vc3NvLWdlbmVyYWwtYXV0aC5hZS5xYS5jbG91ZGhoLmRlL2F1dGgvcmVhbG1zL0ZpZWxtYW5uIiwKICAiYXVkIjogWwogICAgInR2LWZyb250ZW5kIiwKICAgICJtZm0iLAogICAgInR2IgogIF0sCiAgInN1YiI6ICIwODBjMDkzYS00MzdhLTQ2MTItYjNmYS00ODIxMmUyNDdmNjUiLAogICJ0eXAiOiAiQmVhcmVyIiwKICAiYXpwIjogIm1mbS1hY2NvdW50LWZlIiwKICAibm9uY2UiOiAiMmRkNWM1Zjc1MDFhNDZjMDlkZDA4YTYyNmMwODdhYjYiLAogICJhdXRoX3RpbWUiOiAxNTc4NDY1OTY4LAogICJzZXNzaW9uX3N0YXRlIjogIjM1YTk4ZWM0LTlkZTQtNDA4OC05YmFjLTQ5OWI5ZmVhNmRjMCIsCiAgImFjciI6ICIxIiwKICAiYWxsb3dlZC1vcmlnaW5zIjogWwogICAgImh0dHBzOi8vZnJvbnRlbmQtbWZtLmFlLnFhLmNsb3VkaGguZGUiLAogICAgImh0dHBzOi8vcHdhLmFlLnFhLmNsb3VkaGguZGUiCiAgXSwKICAic2NvcGUiOiAib3BlbmlkIG1mbS1hY2NvdW50LXJlYWQgbWZtLXB1YmxpYyBtZm0tYWNjb3VudC13cml0ZSIsCiAgIm1mbSI6IHsKICAgICJhY2NvdW50LWlkIjogIjU0YjI3NDUxLTdiMTctNDRkZi04NTZjLTM4ZDY1MGUxOWMxYyIKICB9Cn0.FbhDA6_s76e6h06nrPQYsFcza4dUHlfUUm9aLMShWpjAidIBjifta-yNAaTIxqqYuacQma4eYiIKuiExViYfl9rZnN5D-6uumFuSC0twsHxLK6KbSHgj2s4Ru20oBb18w4LHSOelYCXPMLjweMkSNgl2PVnCWqjYSnY3WWjj1rSb5EcxvGuMxBYk6Txt7zkTbMLvn2u-8IBls4uqBqwcHH7UmLj3UG_GtGhvCwyF6YRUDTZaNifCSTlCEVmFVDGVZ0BSz9vmnj5R5qsr7ysMqluX8qX80QKmuT1RIiEByctE54LQsEHUx5l-cdAnvlh7gzYTX0S1glSI9WNLl8OVtQ"
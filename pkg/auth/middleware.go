@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authenticator validates a bearer token and returns the caller it was issued to
+type Authenticator interface {
+	Authenticate(tokenString string) (*Principal, error)
+}
+
+// Requirement lists what the principal needs for a route, all of it must be granted
+type Requirement struct {
+	Scopes      []string
+	RealmRoles  []string
+	ClientRoles map[string][]string
+	// ACRValues are the authentication context classes one of which the user must have authenticated with
+	ACRValues []string
+	// MaxAge is the time since the user last authenticated actively after which the route asks for authentication again
+	MaxAge time.Duration
+}
+
+type bearerMiddleware struct {
+	authenticator Authenticator
+	realm         string
+}
+
+// NewBearerMiddleware creates the middleware validating bearer tokens (RFC 6750). The realm is named in the
+// WWW-Authenticate challenges. It can be used with negroni directly or wrap a net/http handler with Protect.
+func NewBearerMiddleware(authenticator Authenticator, realm string) *bearerMiddleware {
+	return &bearerMiddleware{authenticator: authenticator, realm: realm}
+}
+
+// ServeHTTP lets negroni run the middleware without requirements
+func (bm *bearerMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	bm.Protect(next, Requirement{}).ServeHTTP(w, r)
+}
+
+// Protect validates the bearer token of requests to the handler, which finds the principal with PrincipalFrom
+func (bm *bearerMiddleware) Protect(next http.Handler, requirement Requirement) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := bearerToken(r)
+		if err != nil {
+			bm.challenge(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		if token == "" {
+			bm.challenge(w, http.StatusUnauthorized, "", "bearer token required")
+			return
+		}
+
+		principal, err := bm.authenticator.Authenticate(token)
+		if err != nil {
+			log.Debugf("%s: JWT validation error: %v", r.URL.Path, err)
+			bm.challenge(w, http.StatusUnauthorized, "invalid_token", err.Error())
+			return
+		}
+		if !principal.HasScopes(requirement.Scopes...) {
+			bm.challenge(w, http.StatusForbidden, "insufficient_scope", "insufficient scope", "scope", strings.Join(requirement.Scopes, " "))
+			return
+		}
+		if !requirement.rolesGrantedTo(principal) {
+			bm.challenge(w, http.StatusForbidden, "insufficient_scope", "insufficient roles")
+			return
+		}
+		if !requirement.authenticationSufficient(principal, time.Now()) {
+			bm.challenge(w, http.StatusUnauthorized, "insufficient_user_authentication", "stronger or more recent authentication required", requirement.stepUpParams()...)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func (req Requirement) rolesGrantedTo(principal *Principal) bool {
+	for _, role := range req.RealmRoles {
+		if !principal.HasRealmRole(role) {
+			return false
+		}
+	}
+	for client, roles := range req.ClientRoles {
+		for _, role := range roles {
+			if !principal.HasClientRole(client, role) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// authenticationSufficient reports whether the user authenticated strongly and recently enough (RFC 9470)
+func (req Requirement) authenticationSufficient(principal *Principal, now time.Time) bool {
+	if len(req.ACRValues) > 0 && !containsAny(req.ACRValues, []string{principal.ACR}) {
+		return false
+	}
+	if req.MaxAge > 0 && (principal.AuthTime.IsZero() || now.Sub(principal.AuthTime) > req.MaxAge) {
+		return false
+	}
+	return true
+}
+
+// stepUpParams are the challenge parameters telling the client how to authenticate the user again
+func (req Requirement) stepUpParams() []string {
+	params := []string{}
+	if len(req.ACRValues) > 0 {
+		params = append(params, "acr_values", strings.Join(req.ACRValues, " "))
+	}
+	if req.MaxAge > 0 {
+		params = append(params, "max_age", strconv.Itoa(int(req.MaxAge.Seconds())))
+	}
+	return params
+}
+
+// challenge answers with a WWW-Authenticate header as RFC 6750 section 3 describes it. Further parameters are passed as name value pairs.
+func (bm *bearerMiddleware) challenge(w http.ResponseWriter, status int, errorCode string, description string, extra ...string) {
+	params := []string{fmt.Sprintf("realm=%q", bm.realm)}
+	if errorCode != "" {
+		params = append(params, fmt.Sprintf("error=%q", errorCode), fmt.Sprintf("error_description=%q", sanitizeParam(description)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		params = append(params, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": description})
+}
+
+// bearerToken reads the token of the Authorization header, an empty one if the request carries none
+func bearerToken(r *http.Request) (string, error) {
+	headers := r.Header.Values("Authorization")
+	if len(headers) == 0 {
+		return "", nil
+	}
+	if len(headers) > 1 {
+		return "", fmt.Errorf("multiple authorization headers")
+	}
+	parts := strings.SplitN(headers[0], " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", nil
+	}
+	token := strings.TrimSpace(parts[1])
+	if token == "" {
+		return "", fmt.Errorf("empty bearer token")
+	}
+	return token, nil
+}
+
+// sanitizeParam keeps a description within the characters RFC 6750 allows in error_description
+func sanitizeParam(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return ' '
+		}
+		return r
+	}, value)
+}
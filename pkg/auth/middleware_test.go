@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newMiddlewareTest() (*bearerMiddleware, string) {
+	key, mc := newPolicyTestKey("key-1")
+	token := signPolicyTestToken(key, "key-1", jwt.MapClaims{"iss": testIssuer, "aud": "yep", "sub": "user-1", "scope": "modules:read"})
+	return NewBearerMiddleware(NewJwtHandler(mc, testIssuer, "yep"), "yep"), token
+}
+
+func serveProtected(bearer *bearerMiddleware, requirement Requirement, authorization string) (*httptest.ResponseRecorder, *Principal) {
+	var principal *Principal
+	handler := bearer.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = PrincipalFrom(r.Context())
+	}), requirement)
+	r := httptest.NewRequest(http.MethodGet, "/modules", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, principal
+}
+
+func TestBearerMiddleware_whenTokenValid_thenPassPrincipal(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	bearer, token := newMiddlewareTest()
+
+	// act
+	w, principal := serveProtected(bearer, Requirement{Scopes: []string{"modules:read"}}, "Bearer "+token)
+
+	// assert
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("user-1", principal.Subject)
+}
+
+func TestBearerMiddleware_whenTokenMissingOrInvalid_thenChallenge(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	bearer, token := newMiddlewareTest()
+
+	// act
+	missing, _ := serveProtected(bearer, Requirement{}, "")
+	basic, _ := serveProtected(bearer, Requirement{}, "Basic dXNlcjpwYXNz")
+	invalid, principal := serveProtected(bearer, Requirement{}, "Bearer "+token+"x")
+
+	// assert
+	a.Equal(http.StatusUnauthorized, missing.Code)
+	a.Equal(`Bearer realm="yep"`, missing.Header().Get("WWW-Authenticate"))
+	a.Equal(http.StatusUnauthorized, basic.Code)
+	a.Equal(http.StatusUnauthorized, invalid.Code)
+	a.Contains(invalid.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+	a.Nil(principal)
+}
+
+func TestBearerMiddleware_whenScopeOrRoleMissing_thenForbidden(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	bearer, token := newMiddlewareTest()
+
+	// act
+	scope, _ := serveProtected(bearer, Requirement{Scopes: []string{"modules:read", "modules:write"}}, "Bearer "+token)
+	role, _ := serveProtected(bearer, Requirement{RealmRoles: []string{"admin"}}, "Bearer "+token)
+
+	// assert
+	a.Equal(http.StatusForbidden, scope.Code)
+	a.Equal(`Bearer realm="yep", error="insufficient_scope", error_description="insufficient scope", scope="modules:read modules:write"`, scope.Header().Get("WWW-Authenticate"))
+	a.Equal(http.StatusForbidden, role.Code)
+	a.Contains(role.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+}
+
+func TestBearerMiddleware_whenAuthenticationTooWeakOrOld_thenStepUpChallenge(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, mc := newPolicyTestKey("key-1")
+	bearer := NewBearerMiddleware(NewJwtHandler(mc, testIssuer, "yep"), "yep")
+	token := signPolicyTestToken(key, "key-1", jwt.MapClaims{"iss": testIssuer, "aud": "yep", "acr": "1", "auth_time": time.Now().Add(-time.Hour).Unix()})
+
+	// act
+	weak, _ := serveProtected(bearer, Requirement{ACRValues: []string{"2"}}, "Bearer "+token)
+	old, _ := serveProtected(bearer, Requirement{MaxAge: 5 * time.Minute}, "Bearer "+token)
+	sufficient, _ := serveProtected(bearer, Requirement{ACRValues: []string{"1", "2"}, MaxAge: 2 * time.Hour}, "Bearer "+token)
+
+	// assert
+	a.Equal(http.StatusUnauthorized, weak.Code)
+	a.Equal(`Bearer realm="yep", error="insufficient_user_authentication", error_description="stronger or more recent authentication required", acr_values="2"`, weak.Header().Get("WWW-Authenticate"))
+	a.Equal(http.StatusUnauthorized, old.Code)
+	a.Contains(old.Header().Get("WWW-Authenticate"), `max_age="300"`)
+	a.Equal(http.StatusOK, sufficient.Code)
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newPolicyTestKey(kid string) (*ecdsa.PrivateKey, *MockOIDClient) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mc := &MockOIDClient{}
+	mc.On("GetJWK", kid).Return(&JWK{Kty: "EC", Crv: "P-256", Kid: kid, X: encode(key.X.Bytes()), Y: encode(key.Y.Bytes())}, nil)
+	return key, mc
+}
+
+func signPolicyTestToken(key *ecdsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = kid
+	token.Header["typ"] = "at+jwt"
+	signed, _ := token.SignedString(key)
+	return signed
+}
+
+func TestJWTValidation_whenSeveralIssuersTrusted_thenVerifyEachWithItsKeys(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	firstKey, firstClient := newPolicyTestKey("first-key")
+	secondKey, secondClient := newPolicyTestKey("second-key")
+	jwtHandler := NewMultiIssuerJwtHandler([]ValidationPolicy{
+		{Issuer: "https://first.example.com", Audiences: []string{"yep"}, OIDClient: firstClient},
+		{Issuer: "https://second.example.com", Audiences: []string{"yep", "yep-admin"}, OIDClient: secondClient},
+	})
+
+	// act
+	firstErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(firstKey, "first-key", jwt.MapClaims{"iss": "https://first.example.com", "aud": "yep"}))
+	secondErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(secondKey, "second-key", jwt.MapClaims{"iss": "https://second.example.com", "aud": []string{"other", "yep-admin"}}))
+	forgedErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(firstKey, "second-key", jwt.MapClaims{"iss": "https://second.example.com", "aud": "yep"}))
+
+	// assert
+	a.NoError(firstErr)
+	a.NoError(secondErr)
+	a.Error(forgedErr)
+	firstClient.AssertNotCalled(t, "GetJWK", "second-key")
+}
+
+func TestJWTValidation_whenIssuerUnknown_thenFailWithoutKeyLookup(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, mc := newPolicyTestKey("key-1")
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+
+	// act
+	unknownErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(key, "key-1", jwt.MapClaims{"iss": "https://evil.example.com", "aud": "yep"}))
+	missingErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(key, "key-1", jwt.MapClaims{"aud": "yep"}))
+
+	// assert
+	a.EqualError(unknownErr, "unauthorized issuer")
+	a.True(errors.Is(unknownErr, ErrTokenUnauthorized))
+	a.EqualError(missingErr, "unauthorized issuer")
+	mc.AssertNotCalled(t, "GetJWK", "key-1")
+}
+
+func TestJWTValidation_whenAudienceOnlyContainsAllowedOne_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, mc := newPolicyTestKey("key-1")
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+
+	// act
+	stringErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(key, "key-1", jwt.MapClaims{"iss": testIssuer, "aud": "yep-admin"}))
+	arrayErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(key, "key-1", jwt.MapClaims{"iss": testIssuer, "aud": []string{"yep-admin", "my-yep"}}))
+
+	// assert
+	a.EqualError(stringErr, "unauthorized audience")
+	a.EqualError(arrayErr, "unauthorized audience")
+}
+
+func TestJWTValidation_whenAuthorizedPartyNotAllowed_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, mc := newPolicyTestKey("key-1")
+	jwtHandler := NewMultiIssuerJwtHandler([]ValidationPolicy{
+		{Issuer: testIssuer, Audiences: []string{"yep"}, AuthorizedParties: []string{"yep-frontend"}, OIDClient: mc},
+	})
+
+	// act
+	allowedErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(key, "key-1", jwt.MapClaims{"iss": testIssuer, "aud": "yep", "azp": "yep-frontend"}))
+	withoutErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(key, "key-1", jwt.MapClaims{"iss": testIssuer, "aud": "yep"}))
+	otherErr := jwtHandler.ValidateJWTToken(signPolicyTestToken(key, "key-1", jwt.MapClaims{"iss": testIssuer, "aud": "yep", "azp": "yep-frontend-evil"}))
+
+	// assert
+	a.NoError(allowedErr)
+	a.NoError(withoutErr)
+	a.EqualError(otherErr, "unauthorized party")
+}
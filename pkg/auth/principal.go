@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Principal is the caller a validated access token was issued to
+type Principal struct {
+	Subject string
+	Issuer  string
+	// ClientID is the client the token was issued to, taken from azp or client_id
+	ClientID  string
+	Scopes    []string
+	SessionID string
+	// ACR and AuthTime tell how and when the user last authenticated actively, AuthTime is zero if the token does not say
+	ACR      string
+	AuthTime time.Time
+	// RealmRoles and ClientRoles are read from the realm_access and resource_access claims of Keycloak style issuers
+	RealmRoles  []string
+	ClientRoles map[string][]string
+	Claims      map[string]interface{}
+}
+
+type principalContextKey struct{}
+
+// NewPrincipal reads the principal from the claims of a validated token
+func NewPrincipal(claims map[string]interface{}) *Principal {
+	principal := &Principal{
+		Subject:     stringValue(claims["sub"]),
+		Issuer:      stringValue(claims["iss"]),
+		ClientID:    stringValue(claims["azp"]),
+		Scopes:      strings.Fields(stringValue(claims["scope"])),
+		SessionID:   stringValue(claims["sid"]),
+		ACR:         stringValue(claims["acr"]),
+		RealmRoles:  []string{},
+		ClientRoles: map[string][]string{},
+		Claims:      claims,
+	}
+	if principal.ClientID == "" {
+		principal.ClientID = stringValue(claims["client_id"])
+	}
+	if principal.SessionID == "" {
+		principal.SessionID = stringValue(claims["session_state"])
+	}
+	if len(principal.Scopes) == 0 {
+		principal.Scopes = stringValues(claims["scp"])
+	}
+	if authTime, err := numericDate(claims, "auth_time"); err == nil && authTime != nil {
+		principal.AuthTime = *authTime
+	}
+	if realmAccess, ok := claims["realm_access"].(map[string]interface{}); ok {
+		principal.RealmRoles = stringValues(realmAccess["roles"])
+	}
+	if resourceAccess, ok := claims["resource_access"].(map[string]interface{}); ok {
+		for client, access := range resourceAccess {
+			if access, ok := access.(map[string]interface{}); ok {
+				principal.ClientRoles[client] = stringValues(access["roles"])
+			}
+		}
+	}
+	return principal
+}
+
+// HasScope reports whether the token was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	return containsAny(p.Scopes, []string{scope})
+}
+
+// HasScopes reports whether the token was granted all of the scopes
+func (p *Principal) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !p.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasRealmRole reports whether the user has the role in the realm
+func (p *Principal) HasRealmRole(role string) bool {
+	return containsAny(p.RealmRoles, []string{role})
+}
+
+// HasClientRole reports whether the user has the role of the client
+func (p *Principal) HasClientRole(client string, role string) bool {
+	return containsAny(p.ClientRoles[client], []string{role})
+}
+
+// WithPrincipal returns a copy of the context carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFrom returns the principal the context carries
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+func stringValue(value interface{}) string {
+	text, _ := value.(string)
+	return text
+}
+
+// stringValues reads a claim holding an array of strings
+func stringValues(value interface{}) []string {
+	values := []string{}
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+	case []string:
+		values = append(values, value...)
+	}
+	return values
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate_whenTokenValid_thenReturnPrincipal(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, mc := newPolicyTestKey("key-1")
+	jwtHandler := NewJwtHandler(mc, testIssuer, "yep")
+	token := signPolicyTestToken(key, "key-1", jwt.MapClaims{
+		"iss":             testIssuer,
+		"aud":             "yep",
+		"sub":             "user-1",
+		"azp":             "yep-frontend",
+		"scope":           "openid modules:read",
+		"session_state":   "session-1",
+		"realm_access":    map[string]interface{}{"roles": []string{"admin"}},
+		"resource_access": map[string]interface{}{"yep": map[string]interface{}{"roles": []string{"editor"}}},
+		"iat":             time.Now().Unix(),
+	})
+
+	// act
+	principal, err := jwtHandler.Authenticate("Bearer " + token)
+
+	// assert
+	a.NoError(err)
+	a.Equal("user-1", principal.Subject)
+	a.Equal("yep-frontend", principal.ClientID)
+	a.Equal("session-1", principal.SessionID)
+	a.True(principal.HasScopes("openid", "modules:read"))
+	a.False(principal.HasScope("modules:write"))
+	a.True(principal.HasRealmRole("admin"))
+	a.True(principal.HasClientRole("yep", "editor"))
+	a.False(principal.HasClientRole("other", "editor"))
+	a.Equal("user-1", principal.Claims["sub"])
+}
+
+func TestPrincipalFrom_whenContextCarriesPrincipal_thenReturnIt(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	principal := NewPrincipal(map[string]interface{}{"sub": "user-1", "scp": []interface{}{"read"}})
+
+	// act
+	carried, ok := PrincipalFrom(WithPrincipal(context.Background(), principal))
+	_, missing := PrincipalFrom(context.Background())
+
+	// assert
+	a.True(ok)
+	a.Same(principal, carried)
+	a.True(carried.HasScope("read"))
+	a.False(missing)
+}
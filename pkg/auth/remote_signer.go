@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/square/go-jose.v2"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RemoteSigner is a Signer whose private key stays in the signing service
+type RemoteSigner interface {
+	Signer
+	// RemoteID names the key in the signing service
+	RemoteID() string
+}
+
+type remoteSigningService struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+type remoteSigner struct {
+	service   *remoteSigningService
+	remoteID  string
+	kid       string
+	algorithm string
+	public    crypto.PublicKey
+}
+
+type createKeyRequest struct {
+	Algorithm string `json:"alg"`
+}
+
+type createKeyResponse struct {
+	ID  string          `json:"id"`
+	JWK jose.JSONWebKey `json:"jwk"`
+}
+
+type signRequest struct {
+	Algorithm string `json:"alg"`
+	Input     string `json:"input"`
+}
+
+type signResponse struct {
+	Signature string `json:"signature"`
+}
+
+// NewRemoteSigningService creates the client of an HTTP signing service (KMS) keeping the private keys.
+// The service creates keys with POST /keys, signs with POST /keys/{id}/sign and destroys keys with DELETE /keys/{id}.
+func NewRemoteSigningService(httpClient *http.Client, baseURL string, token string) *remoteSigningService {
+	return &remoteSigningService{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+	}
+}
+
+// CreateKey lets the service generate a key for the algorithm and returns its signer
+func (rs *remoteSigningService) CreateKey(algorithm string) (RemoteSigner, error) {
+	var created createKeyResponse
+	if err := rs.call(http.MethodPost, "/keys", &createKeyRequest{Algorithm: algorithm}, &created); err != nil {
+		return nil, err
+	}
+	if created.ID == "" || created.JWK.Key == nil || !created.JWK.IsPublic() {
+		return nil, fmt.Errorf("signing service returned no public key")
+	}
+	return rs.Signer(created.ID, algorithm, created.JWK.Key)
+}
+
+// Signer returns the signer of a key the service created before
+func (rs *remoteSigningService) Signer(remoteID string, algorithm string, public crypto.PublicKey) (RemoteSigner, error) {
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil || !keyMatchesMethod(public, method) {
+		return nil, fmt.Errorf("key of type %T cannot verify %s", public, algorithm)
+	}
+	kid, err := KeyID(public)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteSigner{service: rs, remoteID: remoteID, kid: kid, algorithm: algorithm, public: public}, nil
+}
+
+// DeleteKey destroys the key in the service
+func (rs *remoteSigningService) DeleteKey(remoteID string) error {
+	return rs.call(http.MethodDelete, "/keys/"+url.PathEscape(remoteID), nil, nil)
+}
+
+func (rs *remoteSigningService) call(method string, path string, request interface{}, response interface{}) error {
+	var body bytes.Buffer
+	if request != nil {
+		if err := json.NewEncoder(&body).Encode(request); err != nil {
+			return err
+		}
+	}
+	httpRequest, err := http.NewRequest(method, rs.baseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if rs.token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+rs.token)
+	}
+
+	httpResponse, err := rs.httpClient.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf("signing service unavailable: %v", err)
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode > 299 {
+		return fmt.Errorf("signing service answered %s %s with status %d", method, path, httpResponse.StatusCode)
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(httpResponse.Body).Decode(response)
+}
+
+func (rs *remoteSigner) RemoteID() string {
+	return rs.remoteID
+}
+
+func (rs *remoteSigner) KeyID() string {
+	return rs.kid
+}
+
+func (rs *remoteSigner) Algorithm() string {
+	return rs.algorithm
+}
+
+func (rs *remoteSigner) Public() crypto.PublicKey {
+	return rs.public
+}
+
+// Sign lets the service sign and verifies the signature before it is handed out
+func (rs *remoteSigner) Sign(signingString string) (string, error) {
+	var signed signResponse
+	request := &signRequest{Algorithm: rs.algorithm, Input: signingString}
+	if err := rs.service.call(http.MethodPost, "/keys/"+url.PathEscape(rs.remoteID)+"/sign", request, &signed); err != nil {
+		return "", err
+	}
+	if err := jwt.GetSigningMethod(rs.algorithm).Verify(signingString, signed.Signature, rs.public); err != nil {
+		return "", fmt.Errorf("signing service returned an invalid signature: %v", err)
+	}
+	return signed.Signature, nil
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/square/go-jose.v2"
+	"io/ioutil"
+)
+
+// Signer signs tokens with a key whose private part it may keep elsewhere
+type Signer interface {
+	KeyID() string
+	Algorithm() string
+	Public() crypto.PublicKey
+	// Sign returns the base64url encoded JWS signature of the signing input
+	Sign(signingString string) (string, error)
+}
+
+// SignToken signs the claims with the signer, naming its key in the kid header
+func SignToken(signer Signer, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(&signerMethod{signer: signer}, claims)
+	token.Header["kid"] = signer.KeyID()
+	return token.SignedString(nil)
+}
+
+// signerMethod lets jwt-go sign through a Signer
+type signerMethod struct {
+	signer Signer
+}
+
+func (m *signerMethod) Alg() string {
+	return m.signer.Algorithm()
+}
+
+func (m *signerMethod) Verify(signingString string, signature string, key interface{}) error {
+	return jwt.GetSigningMethod(m.signer.Algorithm()).Verify(signingString, signature, key)
+}
+
+func (m *signerMethod) Sign(signingString string, key interface{}) (string, error) {
+	return m.signer.Sign(signingString)
+}
+
+// KeyID is the RFC 7638 thumbprint of the public key
+func KeyID(key crypto.PublicKey) (string, error) {
+	digest, err := (&jose.JSONWebKey{Key: key}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(digest), nil
+}
+
+type localSigner struct {
+	kid       string
+	algorithm string
+	method    jwt.SigningMethod
+	key       crypto.Signer
+}
+
+// NewLocalSigner creates the signer holding the private key in memory
+func NewLocalSigner(key crypto.Signer, algorithm string) (*localSigner, error) {
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil || !keyMatchesMethod(key.Public(), method) {
+		return nil, fmt.Errorf("key of type %T cannot sign %s", key, algorithm)
+	}
+	kid, err := KeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &localSigner{kid: kid, algorithm: algorithm, method: method, key: key}, nil
+}
+
+// GenerateLocalSigner creates a new private key fitting the algorithm
+func GenerateLocalSigner(algorithm string) (*localSigner, error) {
+	var key crypto.Signer
+	var err error
+	switch algorithm {
+	case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		key, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case SigningMethodEdDSA.Alg():
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalSigner(key, algorithm)
+}
+
+// ParseLocalSigner restores a signer from its PKCS #8 DER encoded private key
+func ParseLocalSigner(der []byte, algorithm string) (*localSigner, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign")
+	}
+	return NewLocalSigner(signer, algorithm)
+}
+
+// LoadLocalSigner reads the private key from a PEM or JWK file. An empty algorithm is taken from the JWK alg member.
+func LoadLocalSigner(path string, algorithm string) (*localSigner, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key interface{}
+	if block, _ := pem.Decode(data); block != nil {
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		default:
+			return nil, fmt.Errorf("unsupported pem block %s", block.Type)
+		}
+	} else {
+		var jwk jose.JSONWebKey
+		err = json.Unmarshal(data, &jwk)
+		key = jwk.Key
+		if algorithm == "" {
+			algorithm = jwk.Algorithm
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse signing key %s: %v", path, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s holds no private key", path)
+	}
+	return NewLocalSigner(signer, algorithm)
+}
+
+func (ls *localSigner) KeyID() string {
+	return ls.kid
+}
+
+func (ls *localSigner) Algorithm() string {
+	return ls.algorithm
+}
+
+func (ls *localSigner) Public() crypto.PublicKey {
+	return ls.key.Public()
+}
+
+func (ls *localSigner) Sign(signingString string) (string, error) {
+	return ls.method.Sign(signingString, ls.key)
+}
+
+// MarshalPrivateKey returns the PKCS #8 DER encoded private key, to be sealed before it is stored
+func (ls *localSigner) MarshalPrivateKey() ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(ls.key)
+}
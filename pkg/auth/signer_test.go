@@ -0,0 +1,98 @@
+package auth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth/authtest"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func verify(t *testing.T, signer auth.Signer, token string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, signer.KeyID(), token.Header["kid"])
+		return signer.Public(), nil
+	})
+	assert.NoError(t, err)
+	return claims
+}
+
+func TestLoadLocalSigner_whenPEMOrJWKFile_thenSign(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	jwk, _ := json.Marshal(jose.JSONWebKey{Key: key, Algorithm: "ES256"})
+	pemPath := filepath.Join(t.TempDir(), "key.pem")
+	jwkPath := filepath.Join(t.TempDir(), "key.json")
+	ioutil.WriteFile(pemPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	ioutil.WriteFile(jwkPath, jwk, 0600)
+
+	// act
+	fromPEM, pemErr := auth.LoadLocalSigner(pemPath, "ES256")
+	fromJWK, jwkErr := auth.LoadLocalSigner(jwkPath, "")
+	_, mismatchErr := auth.LoadLocalSigner(pemPath, "RS256")
+	token, signErr := auth.SignToken(fromJWK, jwt.MapClaims{"sub": "user-1"})
+
+	// assert
+	a.NoError(pemErr)
+	a.NoError(jwkErr)
+	a.Error(mismatchErr)
+	a.Equal(fromPEM.KeyID(), fromJWK.KeyID())
+	a.Equal("ES256", fromJWK.Algorithm())
+	a.NoError(signErr)
+	a.Equal("user-1", verify(t, fromPEM, token)["sub"])
+}
+
+func TestRemoteSigner_whenServiceSigns_thenVerifiableWithPublicKey(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	stub := authtest.NewSigningService()
+	defer stub.Close()
+	service := auth.NewRemoteSigningService(http.DefaultClient, stub.URL, "")
+
+	// act
+	signer, err := service.CreateKey("EdDSA")
+	token, signErr := auth.SignToken(signer, jwt.MapClaims{"sub": "user-1"})
+	restored, _ := service.Signer(signer.RemoteID(), "EdDSA", signer.Public())
+	deleteErr := service.DeleteKey(signer.RemoteID())
+	_, deletedErr := auth.SignToken(restored, jwt.MapClaims{"sub": "user-1"})
+
+	// assert
+	a.NoError(err)
+	a.NoError(signErr)
+	a.Equal("user-1", verify(t, signer, token)["sub"])
+	a.Equal(signer.KeyID(), restored.KeyID())
+	a.NoError(deleteErr)
+	a.Error(deletedErr)
+	a.Equal(0, stub.KeyCount())
+}
+
+func TestRemoteSigner_whenSignatureDoesNotMatchKey_thenFail(t *testing.T) {
+	// arrange
+	stub := authtest.NewSigningService()
+	defer stub.Close()
+	service := auth.NewRemoteSigningService(http.DefaultClient, stub.URL, "")
+	first, _ := service.CreateKey("ES256")
+	second, _ := service.CreateKey("ES256")
+	// a signer claiming the public key of another key in the service
+	confused, _ := service.Signer(first.RemoteID(), "ES256", second.Public())
+
+	// act
+	_, err := auth.SignToken(confused, jwt.MapClaims{})
+
+	// assert
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid signature")
+}
@@ -0,0 +1,62 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Client types of RFC 6749 section 2.1
+const (
+	// TypePublic clients cannot keep a secret, e.g. single page and native apps
+	TypePublic = "public"
+	// TypeConfidential clients authenticate with a secret
+	TypeConfidential = "confidential"
+)
+
+// Client is a relying party registered in a realm
+type Client struct {
+	Realm       string `bson:"realm" json:"realm"`
+	ClientID    string `bson:"clientId" json:"clientId"`
+	Name        string `bson:"name" json:"name"`
+	Description string `bson:"description" json:"description"`
+	Enabled     bool   `bson:"enabled" json:"enabled"`
+	// Type is public or confidential
+	Type       string   `bson:"type" json:"type"`
+	GrantTypes []string `bson:"grantTypes" json:"grantTypes"`
+	// RedirectURIs must match exactly, in RedirectURIPatterns a * stands for any characters but / ? # @ and :
+	RedirectURIs        []string `bson:"redirectUris" json:"redirectUris"`
+	RedirectURIPatterns []string `bson:"redirectUriPatterns" json:"redirectUriPatterns"`
+	// WebOrigins may call the token endpoint from the browser, + allows the origins of the redirect URIs
+	WebOrigins []string `bson:"webOrigins" json:"webOrigins"`
+	// AccessTokenLifetime and IDTokenLifetime are in seconds, 0 uses the realm's lifetime
+	AccessTokenLifetime int64 `bson:"accessTokenLifetime" json:"accessTokenLifetime"`
+	IDTokenLifetime     int64 `bson:"idTokenLifetime" json:"idTokenLifetime"`
+	// TokenEndpointAuthMethod is client_secret_basic or client_secret_post for confidential clients and none for public ones
+	TokenEndpointAuthMethod string `bson:"tokenEndpointAuthMethod" json:"tokenEndpointAuthMethod"`
+	// Secrets are set by rotation only, during a rotation the previous secret stays valid until it expires
+	Secrets []ClientSecret `bson:"secrets" json:"secrets"`
+	// Trusted first-party clients are not asked for user consent
+	Trusted bool `bson:"trusted" json:"trusted"`
+	// SubjectType is public or pairwise
+	SubjectType         string `bson:"subjectType" json:"subjectType"`
+	SectorIdentifierURI string `bson:"sectorIdentifierUri" json:"sectorIdentifierUri"`
+	// JWKS holds the public keys the client registered, used to encrypt tokens for it
+	JWKS json.RawMessage `bson:"jwks,omitempty" json:"jwks,omitempty"`
+	// Signing and encryption of ID tokens and userinfo responses
+	IDTokenSignedResponseAlg     string    `bson:"idTokenSignedResponseAlg" json:"idTokenSignedResponseAlg"`
+	IDTokenEncryptedResponseAlg  string    `bson:"idTokenEncryptedResponseAlg" json:"idTokenEncryptedResponseAlg"`
+	IDTokenEncryptedResponseEnc  string    `bson:"idTokenEncryptedResponseEnc" json:"idTokenEncryptedResponseEnc"`
+	UserInfoSignedResponseAlg    string    `bson:"userInfoSignedResponseAlg" json:"userInfoSignedResponseAlg"`
+	UserInfoEncryptedResponseAlg string    `bson:"userInfoEncryptedResponseAlg" json:"userInfoEncryptedResponseAlg"`
+	UserInfoEncryptedResponseEnc string    `bson:"userInfoEncryptedResponseEnc" json:"userInfoEncryptedResponseEnc"`
+	CreatedAt                    time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt                    time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ClientSecret is the SHA-256 hash of a generated client secret, the secret itself is only shown once
+type ClientSecret struct {
+	Hash      []byte    `bson:"hash" json:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	// ExpiresAt is set once a newer secret replaces this one
+	ExpiresAt *time.Time `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/client/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const clientCollection = "clients"
+
+type clientStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewClientStorage creates the Mongo backed storage of realm clients
+func NewClientStorage(dbWrapper *db.DatabaseWrapper) *clientStorage {
+	return &clientStorage{
+		collection:   dbWrapper.Database.Collection(clientCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique index on realm and client id
+func (cs *clientStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := cs.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "realm", Value: 1}, {Key: "clientId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// FindClient returns the client of the realm or nil if there is none
+func (cs *clientStorage) FindClient(realm string, clientID string) (*dto.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	var client dto.Client
+	err := cs.collection.FindOne(ctx, bson.M{"realm": realm, "clientId": clientID}).Decode(&client)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// FindClients returns the page of clients of the realm matching the query and the number of all matching clients
+func (cs *clientStorage) FindClients(realm string, query db.Query) ([]*dto.Client, int64, error) {
+	clients := []*dto.Client{}
+	total, err := db.FindPage(cs.collection, cs.queryTimeout, query.Match(bson.M{"realm": realm}, "clientId", "name"), "clientId", query, &clients)
+	return clients, total, err
+}
+
+// CreateClient stores a new client
+func (cs *clientStorage) CreateClient(client *dto.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	client.CreatedAt = time.Now().UTC()
+	client.UpdatedAt = client.CreatedAt
+	_, err := cs.collection.InsertOne(ctx, client)
+	return err
+}
+
+// UpdateClient overwrites the settings of the client, keeping its id, secrets and creation time
+func (cs *clientStorage) UpdateClient(client *dto.Client) error {
+	client.UpdatedAt = time.Now().UTC()
+	return cs.update(client.Realm, client.ClientID, bson.M{
+		"name":                         client.Name,
+		"description":                  client.Description,
+		"enabled":                      client.Enabled,
+		"type":                         client.Type,
+		"grantTypes":                   client.GrantTypes,
+		"redirectUris":                 client.RedirectURIs,
+		"redirectUriPatterns":          client.RedirectURIPatterns,
+		"webOrigins":                   client.WebOrigins,
+		"accessTokenLifetime":          client.AccessTokenLifetime,
+		"idTokenLifetime":              client.IDTokenLifetime,
+		"tokenEndpointAuthMethod":      client.TokenEndpointAuthMethod,
+		"trusted":                      client.Trusted,
+		"subjectType":                  client.SubjectType,
+		"sectorIdentifierUri":          client.SectorIdentifierURI,
+		"jwks":                         client.JWKS,
+		"idTokenSignedResponseAlg":     client.IDTokenSignedResponseAlg,
+		"idTokenEncryptedResponseAlg":  client.IDTokenEncryptedResponseAlg,
+		"idTokenEncryptedResponseEnc":  client.IDTokenEncryptedResponseEnc,
+		"userInfoSignedResponseAlg":    client.UserInfoSignedResponseAlg,
+		"userInfoEncryptedResponseAlg": client.UserInfoEncryptedResponseAlg,
+		"userInfoEncryptedResponseEnc": client.UserInfoEncryptedResponseEnc,
+		"updatedAt":                    client.UpdatedAt,
+	})
+}
+
+// UpdateClientSecrets replaces the secret hashes of the client
+func (cs *clientStorage) UpdateClientSecrets(realm string, clientID string, secrets []dto.ClientSecret) error {
+	return cs.update(realm, clientID, bson.M{"secrets": secrets, "updatedAt": time.Now().UTC()})
+}
+
+func (cs *clientStorage) update(realm string, clientID string, fields bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	result, err := cs.collection.UpdateOne(ctx, bson.M{"realm": realm, "clientId": clientID}, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteClient removes the client
+func (cs *clientStorage) DeleteClient(realm string, clientID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	result, err := cs.collection.DeleteOne(ctx, bson.M{"realm": realm, "clientId": clientID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteClients removes all clients of the realm
+func (cs *clientStorage) DeleteClients(realm string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := cs.collection.DeleteMany(ctx, bson.M{"realm": realm})
+	return err
+}
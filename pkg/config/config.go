@@ -27,3 +27,117 @@ package config
     ]
 }
 */
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Config holds the settings of the authorization server
+type Config struct {
+	IssuerBaseURL       string
+	AccessTokenLifetime time.Duration
+	IDTokenLifetime     time.Duration
+	SessionLifetime     time.Duration
+	PairwiseSalt        string
+	KeyRotationPeriod   time.Duration
+	// KEKPath points to a file with the key encryption keys, KEKs holds them directly if there is no file
+	KEKPath string
+	KEKs    string
+	// SigningServiceURL selects the remote signing service holding the signing keys, local keys sealed with the KEK are used without it
+	SigningServiceURL   string
+	SigningServiceToken string
+	SigningKeyFiles     []SigningKeyFile
+	// BootstrapRealm is created enabled on startup unless it exists, so a fresh database has a realm to log in to
+	BootstrapRealm string
+	// AdminRealm holds the admins of the admin API, which accepts access tokens the realm issued to AdminClientID
+	AdminRealm    string
+	AdminClientID string
+	// BreachedPasswordsFile is the denylist of breached password hashes for realms whose password policy rejects them
+	BreachedPasswordsFile string
+	// ThemesDir holds the themes of the login pages in subdirectories named like the theme
+	ThemesDir string
+}
+
+// SigningKeyFile is a PEM or JWK private key to import into a realm
+type SigningKeyFile struct {
+	Realm     string
+	Algorithm string
+	Path      string
+}
+
+// NewConfig reads the authorization server settings from the environment
+func NewConfig() *Config {
+	return &Config{
+		IssuerBaseURL:         getEnv("ISSUER_BASE_URL", "http://localhost:3000"),
+		AccessTokenLifetime:   getDurationEnv("ACCESS_TOKEN_LIFETIME", 5*time.Minute),
+		IDTokenLifetime:       getDurationEnv("ID_TOKEN_LIFETIME", 5*time.Minute),
+		SessionLifetime:       getDurationEnv("SESSION_LIFETIME", 8*time.Hour),
+		PairwiseSalt:          getEnv("PAIRWISE_SALT", ""),
+		KeyRotationPeriod:     getDurationEnv("KEY_ROTATION_PERIOD", 30*24*time.Hour),
+		KEKPath:               getEnv("KEK_FILE", ""),
+		KEKs:                  getEnv("KEK", ""),
+		SigningServiceURL:     getEnv("SIGNING_SERVICE_URL", ""),
+		SigningServiceToken:   getEnv("SIGNING_SERVICE_TOKEN", ""),
+		SigningKeyFiles:       parseSigningKeyFiles(getEnv("SIGNING_KEY_FILES", "")),
+		BootstrapRealm:        getEnv("BOOTSTRAP_REALM", ""),
+		AdminRealm:            getEnv("ADMIN_REALM", "master"),
+		AdminClientID:         getEnv("ADMIN_CLIENT_ID", "admin-cli"),
+		BreachedPasswordsFile: getEnv("BREACHED_PASSWORDS_FILE", ""),
+		ThemesDir:             getEnv("THEMES_DIR", ""),
+	}
+}
+
+// KeyEncryptionKeys returns the id:base64 entries of the key encryption keys, the active one first
+func (c *Config) KeyEncryptionKeys() (string, error) {
+	if c.KEKPath == "" {
+		return c.KEKs, nil
+	}
+	data, err := ioutil.ReadFile(c.KEKPath)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parseSigningKeyFiles reads comma separated realm:algorithm:path entries. The algorithm may be empty for JWK files naming it.
+func parseSigningKeyFiles(value string) []SigningKeyFile {
+	files := []SigningKeyFile{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			log.Warnf("Ignoring invalid signing key file entry '%s', expected realm:algorithm:path", entry)
+			continue
+		}
+		files = append(files, SigningKeyFile{Realm: parts[0], Algorithm: parts[1], Path: parts[2]})
+	}
+	return files
+}
+
+func getEnv(name string, defaultValue string) string {
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getDurationEnv(name string, defaultValue time.Duration) time.Duration {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Warnf("Invalid duration '%s' for %s, using %v", value, name, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
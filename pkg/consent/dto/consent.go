@@ -0,0 +1,33 @@
+package dto
+
+import "time"
+
+// Consent records the scopes and individually requested claims a user granted to a client
+type Consent struct {
+	Realm    string   `bson:"realm" json:"realm"`
+	UserID   string   `bson:"userId" json:"userId"`
+	ClientID string   `bson:"clientId" json:"clientId"`
+	Scopes   []string `bson:"scopes" json:"scopes"`
+	// Claims are the claims granted through the claims request parameter beyond the scopes
+	Claims    []string  `bson:"claims" json:"claims"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Covers reports whether all scopes and claims have been granted before
+func (c *Consent) Covers(scopes []string, claims []string) bool {
+	return containsAll(c.Scopes, scopes) && containsAll(c.Claims, claims)
+}
+
+func containsAll(granted []string, requested []string) bool {
+	grantedSet := make(map[string]bool, len(granted))
+	for _, value := range granted {
+		grantedSet[value] = true
+	}
+	for _, value := range requested {
+		if !grantedSet[value] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/consent/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const consentCollection = "consents"
+
+type consentStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewConsentStorage creates the Mongo backed storage of user consents
+func NewConsentStorage(dbWrapper *db.DatabaseWrapper) *consentStorage {
+	return &consentStorage{
+		collection:   dbWrapper.Database.Collection(consentCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique index on realm, user and client
+func (cs *consentStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := cs.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "realm", Value: 1}, {Key: "userId", Value: 1}, {Key: "clientId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// FindConsent returns the consent of the user for the client or nil if there is none
+func (cs *consentStorage) FindConsent(realm string, userID string, clientID string) (*dto.Consent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	var consent dto.Consent
+	err := cs.collection.FindOne(ctx, consentFilter(realm, userID, clientID)).Decode(&consent)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// SaveConsent adds the scopes and claims to the consent of the user for the client
+func (cs *consentStorage) SaveConsent(realm string, userID string, clientID string, scopes []string, claims []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	// $each needs arrays
+	if claims == nil {
+		claims = []string{}
+	}
+	now := time.Now().UTC()
+	update := bson.M{
+		"$addToSet":    bson.M{"scopes": bson.M{"$each": scopes}, "claims": bson.M{"$each": claims}},
+		"$set":         bson.M{"updatedAt": now},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}
+	_, err := cs.collection.UpdateOne(ctx, consentFilter(realm, userID, clientID), update, options.Update().SetUpsert(true))
+	return err
+}
+
+// DeleteConsent revokes the consent of the user for the client
+func (cs *consentStorage) DeleteConsent(realm string, userID string, clientID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := cs.collection.DeleteOne(ctx, consentFilter(realm, userID, clientID))
+	return err
+}
+
+func consentFilter(realm string, userID string, clientID string) bson.M {
+	return bson.M{"realm": realm, "userId": userID, "clientId": clientID}
+}
@@ -0,0 +1,61 @@
+package dto
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/envelope"
+	"time"
+)
+
+// Credential types, a credential holds the data of its type only
+const (
+	TypePassword = "password"
+	TypeOTP      = "otp"
+	TypeWebAuthn = "webauthn"
+)
+
+// Credential is a means of a user to authenticate, stored apart from the user so secrets never travel with profiles
+type Credential struct {
+	ID     string `bson:"id" json:"id"`
+	Realm  string `bson:"realm" json:"realm"`
+	UserID string `bson:"userId" json:"userId"`
+	Type   string `bson:"type" json:"type"`
+	// Label tells several OTP devices or security keys of a user apart
+	Label      string     `bson:"label" json:"label"`
+	Password   *Password  `bson:"password,omitempty" json:"-"`
+	OTP        *OTP       `bson:"otp,omitempty" json:"otp,omitempty"`
+	WebAuthn   *WebAuthn  `bson:"webauthn,omitempty" json:"webauthn,omitempty"`
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time  `bson:"updatedAt" json:"updatedAt"`
+	LastUsedAt *time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+}
+
+// Password is the password hash, encoded with its algorithm and parameters
+type Password struct {
+	Hash string `bson:"hash"`
+	// ChangedAt is when the user got the password, upgrading its hash does not change it
+	ChangedAt time.Time `bson:"changedAt"`
+	// History holds the hashes of the previous passwords, newest first
+	History []string `bson:"history"`
+}
+
+// OTP is a time-based one-time password generator (RFC 6238)
+type OTP struct {
+	Algorithm string `bson:"algorithm" json:"algorithm"`
+	Digits    int    `bson:"digits" json:"digits"`
+	// Period is the time step in seconds
+	Period int64 `bson:"period" json:"period"`
+	// Secret is the shared key sealed with the key encryption key
+	Secret *envelope.Envelope `bson:"secret" json:"-"`
+	// LastStep is the time step of the last accepted code, codes of it and earlier steps are replays
+	LastStep int64 `bson:"lastStep" json:"-"`
+}
+
+// WebAuthn is a public key credential of an authenticator
+type WebAuthn struct {
+	CredentialID []byte `bson:"credentialId" json:"credentialId"`
+	// PublicKey is the COSE encoded public key of the authenticator
+	PublicKey []byte `bson:"publicKey" json:"-"`
+	AAGUID    []byte `bson:"aaguid" json:"aaguid"`
+	// SignCount is the last signature counter, a counter which does not increase hints at a cloned authenticator
+	SignCount  uint32   `bson:"signCount" json:"signCount"`
+	Transports []string `bson:"transports" json:"transports"`
+}
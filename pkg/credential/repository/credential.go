@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/credential/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const credentialCollection = "credentials"
+
+type credentialStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewCredentialStorage creates the Mongo backed storage of user credentials
+func NewCredentialStorage(dbWrapper *db.DatabaseWrapper) *credentialStorage {
+	return &credentialStorage{
+		collection:   dbWrapper.Database.Collection(credentialCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique indexes on realm and credential id, on the password of a user and on the ids of
+// WebAuthn credentials, and the index to look up the credentials of a user
+func (cs *credentialStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := cs.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "realm", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "realm", Value: 1}, {Key: "userId", Value: 1}, {Key: "type", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "realm", Value: 1}, {Key: "userId", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"type": dto.TypePassword}),
+		},
+		{
+			Keys:    bson.D{{Key: "realm", Value: 1}, {Key: "webauthn.credentialId", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"type": dto.TypeWebAuthn}),
+		},
+	})
+	return err
+}
+
+// FindCredential returns the credential of the realm or nil if there is none
+func (cs *credentialStorage) FindCredential(realm string, id string) (*dto.Credential, error) {
+	return cs.findOne(bson.M{"realm": realm, "id": id})
+}
+
+// FindPassword returns the password credential of the user or nil if the user has no password
+func (cs *credentialStorage) FindPassword(realm string, userID string) (*dto.Credential, error) {
+	return cs.findOne(bson.M{"realm": realm, "userId": userID, "type": dto.TypePassword})
+}
+
+// FindCredentials returns the credentials of the user, only those of the type unless it is empty, oldest first
+func (cs *credentialStorage) FindCredentials(realm string, userID string, credentialType string) ([]*dto.Credential, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"realm": realm, "userId": userID}
+	if credentialType != "" {
+		filter["type"] = credentialType
+	}
+	cursor, err := cs.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	credentials := []*dto.Credential{}
+	if err := cursor.All(ctx, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+func (cs *credentialStorage) findOne(filter bson.M) (*dto.Credential, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	var credential dto.Credential
+	err := cs.collection.FindOne(ctx, filter).Decode(&credential)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// CreateCredential stores a new OTP or WebAuthn credential under a generated id
+func (cs *credentialStorage) CreateCredential(credential *dto.Credential) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	credential.ID = primitive.NewObjectID().Hex()
+	credential.CreatedAt = time.Now().UTC()
+	credential.UpdatedAt = credential.CreatedAt
+	_, err := cs.collection.InsertOne(ctx, credential)
+	return err
+}
+
+// SetPassword replaces the password of the user, creating the password credential if the user has none
+func (cs *credentialStorage) SetPassword(realm string, userID string, password *dto.Password) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	filter := bson.M{"realm": realm, "userId": userID, "type": dto.TypePassword}
+	update := bson.M{
+		"$set":         bson.M{"password": password, "updatedAt": now},
+		"$setOnInsert": bson.M{"id": primitive.NewObjectID().Hex(), "label": "", "createdAt": now},
+	}
+	_, err := cs.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// UpdateCredential overwrites the label, the type specific data and the last use of the credential
+func (cs *credentialStorage) UpdateCredential(credential *dto.Credential) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	credential.UpdatedAt = time.Now().UTC()
+	set := bson.M{"label": credential.Label, "updatedAt": credential.UpdatedAt}
+	switch credential.Type {
+	case dto.TypePassword:
+		set["password"] = credential.Password
+	case dto.TypeOTP:
+		set["otp"] = credential.OTP
+	case dto.TypeWebAuthn:
+		set["webauthn"] = credential.WebAuthn
+	}
+	if credential.LastUsedAt != nil {
+		set["lastUsedAt"] = credential.LastUsedAt
+	}
+	result, err := cs.collection.UpdateOne(ctx, bson.M{"realm": credential.Realm, "id": credential.ID, "type": credential.Type}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteCredential removes the credential of the user
+func (cs *credentialStorage) DeleteCredential(realm string, userID string, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	result, err := cs.collection.DeleteOne(ctx, bson.M{"realm": realm, "userId": userID, "id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteUserCredentials removes all credentials of the user
+func (cs *credentialStorage) DeleteUserCredentials(realm string, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := cs.collection.DeleteMany(ctx, bson.M{"realm": realm, "userId": userID})
+	return err
+}
+
+// DeleteCredentials removes all credentials of the realm
+func (cs *credentialStorage) DeleteCredentials(realm string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := cs.collection.DeleteMany(ctx, bson.M{"realm": realm})
+	return err
+}
@@ -0,0 +1,165 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const kekSize = 32
+
+// Envelope is a secret encrypted with its own data encryption key, which is in turn wrapped by a key encryption key
+type Envelope struct {
+	// KekID names the key encryption key that wrapped the data key
+	KekID      string `bson:"kekId" json:"kekId"`
+	WrappedKey []byte `bson:"wrappedKey" json:"wrappedKey"`
+	Ciphertext []byte `bson:"ciphertext" json:"ciphertext"`
+}
+
+// KEK is a 256 bit AES key encryption key
+type KEK struct {
+	ID  string
+	Key []byte
+}
+
+type envelopeCipher struct {
+	active *KEK
+	keks   map[string]*KEK
+}
+
+// NewEnvelopeCipher creates the cipher sealing secrets with the first KEK. The others only open secrets sealed before a KEK rotation.
+func NewEnvelopeCipher(keks []KEK) (*envelopeCipher, error) {
+	if len(keks) == 0 {
+		return nil, errors.New("no key encryption key configured")
+	}
+	ec := &envelopeCipher{keks: map[string]*KEK{}}
+	for i := range keks {
+		kek := &keks[i]
+		if len(kek.Key) != kekSize {
+			return nil, fmt.Errorf("key encryption key %s must be %d bytes", kek.ID, kekSize)
+		}
+		if _, ok := ec.keks[kek.ID]; ok {
+			return nil, fmt.Errorf("duplicate key encryption key %s", kek.ID)
+		}
+		ec.keks[kek.ID] = kek
+	}
+	ec.active = &keks[0]
+	return ec, nil
+}
+
+// ParseKEKs reads key encryption keys given as id:base64 entries, separated by commas or new lines, the active one first
+func ParseKEKs(text string) ([]KEK, error) {
+	keks := []KEK{}
+	for _, entry := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New("key encryption keys must be given as id:base64")
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("key encryption key %s is not base64: %v", parts[0], err)
+		}
+		keks = append(keks, KEK{ID: parts[0], Key: key})
+	}
+	return keks, nil
+}
+
+// ActiveKekID names the KEK new secrets are sealed with
+func (ec *envelopeCipher) ActiveKekID() string {
+	return ec.active.ID
+}
+
+// Seal encrypts the secret with a fresh data key wrapped by the active KEK
+func (ec *envelopeCipher) Seal(plaintext []byte) (*Envelope, error) {
+	dataKey := make([]byte, kekSize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	ciphertext, err := encrypt(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := encrypt(ec.active.Key, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KekID: ec.active.ID, WrappedKey: wrappedKey, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts the secret with whichever configured KEK sealed it
+func (ec *envelopeCipher) Open(envelope *Envelope) ([]byte, error) {
+	dataKey, err := ec.unwrap(envelope)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(dataKey, envelope.Ciphertext)
+}
+
+// Rewrap wraps the data key of an envelope sealed with an older KEK with the active one. The ciphertext stays the same.
+// It reports false if the envelope already uses the active KEK.
+func (ec *envelopeCipher) Rewrap(envelope *Envelope) (*Envelope, bool, error) {
+	if envelope.KekID == ec.active.ID {
+		return envelope, false, nil
+	}
+	dataKey, err := ec.unwrap(envelope)
+	if err != nil {
+		return nil, false, err
+	}
+	wrappedKey, err := encrypt(ec.active.Key, dataKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return &Envelope{KekID: ec.active.ID, WrappedKey: wrappedKey, Ciphertext: envelope.Ciphertext}, true, nil
+}
+
+func (ec *envelopeCipher) unwrap(envelope *Envelope) ([]byte, error) {
+	if envelope == nil {
+		return nil, errors.New("missing envelope")
+	}
+	kek, ok := ec.keks[envelope.KekID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key encryption key %s", envelope.KekID)
+	}
+	return decrypt(kek.Key, envelope.WrappedKey)
+}
+
+// encrypt seals with AES-256-GCM, prefixing the nonce
+func encrypt(key []byte, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key []byte, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("malformed ciphertext")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,85 @@
+package envelope
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var (
+	oldKEK = KEK{ID: "2024-01", Key: bytes.Repeat([]byte{1}, 32)}
+	newKEK = KEK{ID: "2024-06", Key: bytes.Repeat([]byte{2}, 32)}
+)
+
+func TestSealAndOpen(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	ec, _ := NewEnvelopeCipher([]KEK{oldKEK})
+
+	// act
+	envelope, err := ec.Seal([]byte("private key"))
+	plaintext, openErr := ec.Open(envelope)
+
+	// assert
+	a.NoError(err)
+	a.NoError(openErr)
+	a.Equal("2024-01", envelope.KekID)
+	a.NotContains(string(envelope.Ciphertext), "private key")
+	a.Equal("private key", string(plaintext))
+}
+
+func TestOpen_whenTampered_thenFail(t *testing.T) {
+	// arrange
+	ec, _ := NewEnvelopeCipher([]KEK{oldKEK})
+	envelope, _ := ec.Seal([]byte("private key"))
+	envelope.Ciphertext[len(envelope.Ciphertext)-1] ^= 1
+
+	// act
+	_, err := ec.Open(envelope)
+
+	// assert
+	assert.Error(t, err)
+}
+
+func TestRewrap_whenKEKRotated_thenOpenWithNewKEKOnly(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	before, _ := NewEnvelopeCipher([]KEK{oldKEK})
+	during, _ := NewEnvelopeCipher([]KEK{newKEK, oldKEK})
+	after, _ := NewEnvelopeCipher([]KEK{newKEK})
+	sealed, _ := before.Seal([]byte("private key"))
+
+	// act
+	_, openErr := during.Open(sealed)
+	rewrapped, changed, err := during.Rewrap(sealed)
+	_, unchanged, _ := during.Rewrap(rewrapped)
+	plaintext, afterErr := after.Open(rewrapped)
+	_, staleErr := after.Open(sealed)
+
+	// assert
+	a.NoError(openErr)
+	a.NoError(err)
+	a.True(changed)
+	a.False(unchanged)
+	a.Equal("2024-06", rewrapped.KekID)
+	a.Equal(sealed.Ciphertext, rewrapped.Ciphertext)
+	a.NoError(afterErr)
+	a.Equal("private key", string(plaintext))
+	a.Error(staleErr)
+}
+
+func TestParseKEKs(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+
+	// act
+	keks, err := ParseKEKs("2024-06:AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=,\n2024-01:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=\n")
+	_, malformedErr := ParseKEKs("no-separator")
+	_, shortErr := NewEnvelopeCipher([]KEK{{ID: "short", Key: []byte("short")}})
+
+	// assert
+	a.NoError(err)
+	a.Equal([]KEK{newKEK, oldKEK}, keks)
+	a.Error(malformedErr)
+	a.Error(shortErr)
+}
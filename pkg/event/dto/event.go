@@ -0,0 +1,30 @@
+package dto
+
+import "time"
+
+// Types of events
+const (
+	// TypeUserLocked is a user locked out for a while after too many failed logins
+	TypeUserLocked = "USER_LOCKED"
+	// TypeUserLockedPermanently is a user locked out until an admin unlocks it
+	TypeUserLockedPermanently = "USER_LOCKED_PERMANENTLY"
+	// TypeUserUnlocked is an admin lifting the lockout of a user
+	TypeUserUnlocked = "USER_UNLOCKED"
+	// TypeIPAddressBlocked is a source address blocked for a while after too many failed logins
+	TypeIPAddressBlocked = "IP_ADDRESS_BLOCKED"
+)
+
+// Event is an entry of the event log of a realm
+type Event struct {
+	ID    string    `bson:"id" json:"id"`
+	Realm string    `bson:"realm" json:"realm"`
+	Type  string    `bson:"type" json:"type"`
+	Time  time.Time `bson:"time" json:"time"`
+	// UserID is the user the event is about if it is known, Username what was entered at login
+	UserID    string `bson:"userId,omitempty" json:"userId,omitempty"`
+	Username  string `bson:"username,omitempty" json:"username,omitempty"`
+	IPAddress string `bson:"ipAddress,omitempty" json:"ipAddress,omitempty"`
+	// Actor is the subject of the admin who caused the event
+	Actor   string            `bson:"actor,omitempty" json:"actor,omitempty"`
+	Details map[string]string `bson:"details,omitempty" json:"details,omitempty"`
+}
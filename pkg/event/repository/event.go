@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/event/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+const eventCollection = "events"
+
+type eventStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewEventStorage creates the Mongo backed event log
+func NewEventStorage(dbWrapper *db.DatabaseWrapper) *eventStorage {
+	return &eventStorage{
+		collection:   dbWrapper.Database.Collection(eventCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the indexes to list the events of a realm, newest first, and of a type
+func (es *eventStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), es.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := es.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "realm", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "realm", Value: 1}, {Key: "type", Value: 1}, {Key: "time", Value: -1}}},
+	})
+	return err
+}
+
+// RecordEvent appends the event to the log under a generated id
+func (es *eventStorage) RecordEvent(event *dto.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), es.queryTimeout*time.Second)
+	defer cancel()
+
+	event.ID = primitive.NewObjectID().Hex()
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	_, err := es.collection.InsertOne(ctx, event)
+	return err
+}
+
+// FindEvents returns the page of events of the realm matching the query, newest first, and the number of all matching events
+func (es *eventStorage) FindEvents(realm string, query db.Query) ([]*dto.Event, int64, error) {
+	events := []*dto.Event{}
+	total, err := db.FindPage(es.collection, es.queryTimeout, query.Match(bson.M{"realm": realm}, "username", "userId", "ipAddress"), "-time", query, &events)
+	return events, total, err
+}
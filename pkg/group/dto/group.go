@@ -0,0 +1,13 @@
+package dto
+
+import "time"
+
+// Group grants its realm roles to all of its members
+type Group struct {
+	ID         string    `bson:"id" json:"id"`
+	Realm      string    `bson:"realm" json:"realm"`
+	Name       string    `bson:"name" json:"name"`
+	RealmRoles []string  `bson:"realmRoles" json:"realmRoles"`
+	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time `bson:"updatedAt" json:"updatedAt"`
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/group/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const groupCollection = "groups"
+
+type groupStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewGroupStorage creates the Mongo backed storage of realm groups
+func NewGroupStorage(dbWrapper *db.DatabaseWrapper) *groupStorage {
+	return &groupStorage{
+		collection:   dbWrapper.Database.Collection(groupCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique indexes on realm and group id and on realm and group name
+func (gs *groupStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), gs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := gs.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "realm", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "realm", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	return err
+}
+
+// FindGroup returns the group of the realm or nil if there is none
+func (gs *groupStorage) FindGroup(realm string, id string) (*dto.Group, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gs.queryTimeout*time.Second)
+	defer cancel()
+
+	var group dto.Group
+	err := gs.collection.FindOne(ctx, bson.M{"realm": realm, "id": id}).Decode(&group)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// FindGroups returns the page of groups of the realm matching the query and the number of all matching groups
+func (gs *groupStorage) FindGroups(realm string, query db.Query) ([]*dto.Group, int64, error) {
+	groups := []*dto.Group{}
+	total, err := db.FindPage(gs.collection, gs.queryTimeout, query.Match(bson.M{"realm": realm}, "name"), "name", query, &groups)
+	return groups, total, err
+}
+
+// CreateGroup stores a new group under a generated id
+func (gs *groupStorage) CreateGroup(group *dto.Group) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gs.queryTimeout*time.Second)
+	defer cancel()
+
+	group.ID = primitive.NewObjectID().Hex()
+	group.CreatedAt = time.Now().UTC()
+	group.UpdatedAt = group.CreatedAt
+	_, err := gs.collection.InsertOne(ctx, group)
+	return err
+}
+
+// UpdateGroup overwrites the name and roles of the group
+func (gs *groupStorage) UpdateGroup(group *dto.Group) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gs.queryTimeout*time.Second)
+	defer cancel()
+
+	group.UpdatedAt = time.Now().UTC()
+	update := bson.M{"$set": bson.M{"name": group.Name, "realmRoles": group.RealmRoles, "updatedAt": group.UpdatedAt}}
+	result, err := gs.collection.UpdateOne(ctx, bson.M{"realm": group.Realm, "id": group.ID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RemoveRealmRole takes the role away from all groups of the realm
+func (gs *groupStorage) RemoveRealmRole(realm string, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := gs.collection.UpdateMany(ctx, bson.M{"realm": realm, "realmRoles": role}, bson.M{"$pull": bson.M{"realmRoles": role}})
+	return err
+}
+
+// DeleteGroup removes the group
+func (gs *groupStorage) DeleteGroup(realm string, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gs.queryTimeout*time.Second)
+	defer cancel()
+
+	result, err := gs.collection.DeleteOne(ctx, bson.M{"realm": realm, "id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteGroups removes all groups of the realm
+func (gs *groupStorage) DeleteGroups(realm string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := gs.collection.DeleteMany(ctx, bson.M{"realm": realm})
+	return err
+}
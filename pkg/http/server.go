@@ -2,8 +2,9 @@ package rest
 
 import (
 	"encoding/json"
-	"fmt"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
 	moduleDto "github.com/NerdShoreDev/YEP/server/pkg/module/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/oidc"
 	registryDto "github.com/NerdShoreDev/YEP/server/pkg/registry/dto"
 	"net/http"
 	"time"
@@ -18,6 +19,7 @@ import (
 
 const CONTENT_TYPE_JSON = "application/json"
 const CONTENT_TYPE_KEY = "Content-Type"
+const ADMIN_API_ROUTE_PREFIX = "/admin/v1"
 
 type ServiceHandler interface {
 	DeleteModule(name string) error
@@ -26,12 +28,48 @@ type ServiceHandler interface {
 	GetRegistryServerConfig() (*registryDto.RegistryServerConfig, error)
 	GetClientConfig() (*registryDto.RegistryClientConfig, error)
 	ValidateAuthorizedUserForDeletion(token string) bool
-	ValidateJWTToken(tokenString string) error
 	ValidateUpsertModule(moduleProspect *moduleDto.RequestModule) error
 }
 
+type AuthorizationHandler interface {
+	Authorize(w http.ResponseWriter, r *http.Request)
+	PushAuthorizationRequest(w http.ResponseWriter, r *http.Request)
+	Login(w http.ResponseWriter, r *http.Request)
+	Consent(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	Static(w http.ResponseWriter, r *http.Request)
+}
+
+type TokenHandler interface {
+	Token(w http.ResponseWriter, r *http.Request)
+	UserInfo(w http.ResponseWriter, r *http.Request)
+	Introspect(w http.ResponseWriter, r *http.Request)
+	Discovery(w http.ResponseWriter, r *http.Request)
+	Certs(w http.ResponseWriter, r *http.Request)
+}
+
+type KeyManager interface {
+	Rotate(realm string) error
+	Revoke(realm string, kid string) error
+}
+
+// RealmLoader loads the realm of the {realm} route variable into the request context, rejecting unknown realms
+type RealmLoader interface {
+	Load(next http.Handler) http.Handler
+}
+
+// BearerMiddleware protects routes with a bearer token, the handlers find the principal in the request context
+type BearerMiddleware interface {
+	Protect(next http.Handler, requirement auth.Requirement) http.Handler
+}
+
+// AdminHandler adds the admin API to a router authenticating its callers
+type AdminHandler interface {
+	RegisterRoutes(router *mux.Router)
+}
+
 type WebServer interface {
-	StartWebServer(serviceHandler ServiceHandler)
+	StartWebServer(serviceHandler ServiceHandler, adminAuthenticator auth.Authenticator, realmLoader RealmLoader, authorizationHandler AuthorizationHandler, tokenHandler TokenHandler, keyManager KeyManager, adminHandler AdminHandler)
 }
 
 type webServer struct {
@@ -42,10 +80,10 @@ func NewWebServer(allowedOrigins string) *webServer {
 	return &webServer{allowedOrigins: allowedOrigins}
 }
 
-func (wS *webServer) StartWebServer(serviceHandler ServiceHandler) {
+func (wS *webServer) StartWebServer(serviceHandler ServiceHandler, adminAuthenticator auth.Authenticator, realmLoader RealmLoader, authorizationHandler AuthorizationHandler, tokenHandler TokenHandler, keyManager KeyManager, adminHandler AdminHandler) {
 	middlewareManager := negroni.New()
 	middlewareManager.Use(sentrynegroni.New(sentrynegroni.Options{}))
-	middlewareManager.UseHandler(wS.getRouter(serviceHandler))
+	middlewareManager.UseHandler(wS.getRouter(serviceHandler, auth.NewBearerMiddleware(adminAuthenticator, "admin"), realmLoader, authorizationHandler, tokenHandler, keyManager, adminHandler))
 
 	srv := &http.Server{
 		Handler: middlewareManager,
@@ -58,14 +96,29 @@ func (wS *webServer) StartWebServer(serviceHandler ServiceHandler) {
 	log.Fatal(srv.ListenAndServe())
 }
 
-func (wS *webServer) getRouter(s ServiceHandler) *mux.Router {
+func (wS *webServer) getRouter(s ServiceHandler, adminBearer BearerMiddleware, realms RealmLoader, a AuthorizationHandler, t TokenHandler, k KeyManager, admin AdminHandler) *mux.Router {
 	router := mux.NewRouter()
-	router.HandleFunc("/auth/realm/:realm/.well-known/openid-configuration", errorBump).Methods(http.MethodGet)
-	router.HandleFunc("/auth/realm/:realm/protocol/openid-connect/auth", errorBump).Methods(http.MethodGet)
-	router.HandleFunc("/auth/realm/:realm/protocol/openid-connect/token", errorBump).Methods(http.MethodGet)
-	router.HandleFunc("/auth/realm/:realm/protocol/openid-connect/userinfo", errorBump).Methods(http.MethodGet)
-	router.HandleFunc("/auth/realm/:realm/protocol/openid-connect/logout", errorBump).Methods(http.MethodGet)
-	router.HandleFunc("/auth/realm/:realm/protocol/openid-connect/certs", errorBump).Methods(http.MethodGet)
+	realmRouter := router.PathPrefix("/auth/realm/{realm}").Subrouter()
+	realmRouter.Use(realms.Load)
+	realmRouter.HandleFunc("/.well-known/openid-configuration", t.Discovery).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/protocol/openid-connect/auth", a.Authorize).Methods(http.MethodGet, http.MethodPost)
+	realmRouter.HandleFunc("/protocol/openid-connect/par", a.PushAuthorizationRequest).Methods(http.MethodPost)
+	realmRouter.HandleFunc("/protocol/openid-connect/login", a.Login).Methods(http.MethodGet, http.MethodPost)
+	realmRouter.HandleFunc("/protocol/openid-connect/consent", a.Consent).Methods(http.MethodGet, http.MethodPost)
+	realmRouter.HandleFunc("/protocol/openid-connect/token", t.Token).Methods(http.MethodPost)
+	realmRouter.HandleFunc("/protocol/openid-connect/token/introspect", t.Introspect).Methods(http.MethodPost)
+	realmRouter.HandleFunc("/protocol/openid-connect/userinfo", t.UserInfo).Methods(http.MethodGet, http.MethodPost)
+	realmRouter.HandleFunc("/protocol/openid-connect/logout", a.Logout).Methods(http.MethodGet, http.MethodPost)
+	realmRouter.HandleFunc("/protocol/openid-connect/certs", t.Certs).Methods(http.MethodGet)
+	realmRouter.HandleFunc("/static/{file:.+}", a.Static).Methods(http.MethodGet)
+	adminRouter := router.PathPrefix(ADMIN_API_ROUTE_PREFIX).Subrouter()
+	adminRouter.Use(func(next http.Handler) http.Handler {
+		return adminBearer.Protect(next, auth.Requirement{})
+	})
+	// The middleware of the admin handler requires the admin role for the key routes as well
+	adminRouter.HandleFunc("/realms/{realm}/keys/rotate", rotateKeys(k)).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/realms/{realm}/keys/{kid}", revokeKey(k)).Methods(http.MethodDelete)
+	admin.RegisterRoutes(adminRouter)
 	router.Handle(INTERNAL_API_ROUTE_PREFIX+"/metrics", promhttp.Handler())
 	router.HandleFunc("/api/health", healthCheck).Methods(http.MethodGet)
 	return router
@@ -80,33 +133,16 @@ func (wS *webServer) setupResponse(w *http.ResponseWriter, req *http.Request) {
 	(*w).Header().Set(CONTENT_TYPE_KEY, CONTENT_TYPE_JSON)
 }
 
-func errorBump(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
-	var message string
-	if subject, ok := r.URL.Query()["subject"]; ok {
-		message = fmt.Sprintf("%s requested with subject '%s'", r.URL.Path, subject[0])
-	} else {
-		message = fmt.Sprintf("%s requested without subject", r.URL.Path)
-	}
-	panic(message)
-}
-
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
 }
 
+// The module and registry handlers below are not routed. They leave token validation to BearerMiddleware.Protect,
+// which has to guard them once they are.
 func upsertModule(s ServiceHandler) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(CONTENT_TYPE_KEY, CONTENT_TYPE_JSON)
 
-		// Validate JWT access token
-		if err := s.ValidateJWTToken(r.Header.Get("Authorization")); err != nil {
-			log.Debugf("upsertModule: JWT validation error: %v", err)
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": fmt.Sprint(err)})
-			return
-		}
-
 		// Decode request body
 		decoder := json.NewDecoder(r.Body)
 
@@ -139,14 +175,6 @@ func readModule(s ServiceHandler) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(CONTENT_TYPE_KEY, CONTENT_TYPE_JSON)
 
-		// Validate JWT access token
-		if err := s.ValidateJWTToken(r.Header.Get("Authorization")); err != nil {
-			log.Debugf("readModule: JWT validation error: %v", err)
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": fmt.Sprint(err)})
-			return
-		}
-
 		name := r.URL.Query()["name"]
 		if len(name) == 0 {
 			w.WriteHeader(http.StatusBadRequest)
@@ -173,14 +201,6 @@ func deleteModule(s ServiceHandler) func(w http.ResponseWriter, r *http.Request)
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(CONTENT_TYPE_KEY, CONTENT_TYPE_JSON)
 
-		// Validate JWT access token
-		if err := s.ValidateJWTToken(r.Header.Get("Authorization")); err != nil {
-			log.Debugf("deleteModule: JWT validation error: %v", err)
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": fmt.Sprint(err)})
-			return
-		}
-
 		// Validate user token in header for authorization
 		if authorized := s.ValidateAuthorizedUserForDeletion(r.Header.Get("Authorized-User")); !authorized {
 			log.Debugf("user not allowed to delete a module")
@@ -219,14 +239,6 @@ func readRegistryConfig(s ServiceHandler) func(w http.ResponseWriter, r *http.Re
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(CONTENT_TYPE_KEY, CONTENT_TYPE_JSON)
 
-		// Validate JWT access token
-		if err := s.ValidateJWTToken(r.Header.Get("Authorization")); err != nil {
-			log.Debugf("readRegistryConfig: JWT validation error: %v", err)
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": fmt.Sprint(err)})
-			return
-		}
-
 		registryConfig, err := s.GetRegistryServerConfig()
 
 		if err != nil {
@@ -266,3 +278,39 @@ func (wS *webServer) readClientConfig(s ServiceHandler) func(w http.ResponseWrit
 		json.NewEncoder(w).Encode(clientConfig)
 	}
 }
+
+func rotateKeys(k KeyManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(CONTENT_TYPE_KEY, CONTENT_TYPE_JSON)
+
+		realm := mux.Vars(r)["realm"]
+		if err := k.Rotate(realm); err != nil {
+			log.Errorf("signing keys of realm %s could not be rotated: %v", realm, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": "signing keys could not be rotated"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+	}
+}
+
+func revokeKey(k KeyManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(CONTENT_TYPE_KEY, CONTENT_TYPE_JSON)
+
+		realm := mux.Vars(r)["realm"]
+		kid := mux.Vars(r)["kid"]
+		if err := k.Revoke(realm, kid); err != nil {
+			if err == oidc.ErrKeyNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": "signing key " + kid + " could not be found."})
+				return
+			}
+			log.Errorf("signing key %s of realm %s could not be revoked: %v", kid, realm, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "message": "signing key could not be revoked"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+	}
+}
@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/envelope"
+	"time"
+)
+
+// Backends keeping the private keys
+const (
+	// BackendLocal keys are sealed with the key encryption key and stored with the key
+	BackendLocal = "local"
+	// BackendRemote keys stay in the remote signing service
+	BackendRemote = "remote"
+)
+
+// Lifecycle states of a realm signing key
+const (
+	// StatusActive keys sign new tokens
+	StatusActive = "active"
+	// StatusPassive keys no longer sign but stay published until the tokens they signed have expired
+	StatusPassive = "passive"
+	// StatusRetired keys are neither used nor published
+	StatusRetired = "retired"
+)
+
+// SigningKey is a generated signing key of a realm
+type SigningKey struct {
+	Realm     string `bson:"realm" json:"realm"`
+	Kid       string `bson:"kid" json:"kid"`
+	Algorithm string `bson:"algorithm" json:"algorithm"`
+	Status    string `bson:"status" json:"status"`
+	Backend   string `bson:"backend" json:"backend"`
+	// PublicKey is the JSON encoded public JWK
+	PublicKey []byte `bson:"publicKey" json:"-"`
+	// PrivateKey is the PKCS #8 DER encoded private key sealed with the key encryption key, dropped once the key is retired
+	PrivateKey *envelope.Envelope `bson:"privateKey,omitempty" json:"-"`
+	// RemoteKeyID names the key in the remote signing service
+	RemoteKeyID string    `bson:"remoteKeyId,omitempty" json:"-"`
+	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
+	// RetireAt is set once the key turns passive
+	RetireAt *time.Time `bson:"retireAt,omitempty" json:"retireAt,omitempty"`
+}
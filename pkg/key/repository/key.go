@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/envelope"
+	"github.com/NerdShoreDev/YEP/server/pkg/key/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const keyCollection = "signing_keys"
+
+type keyStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewKeyStorage creates the Mongo backed storage of realm signing keys
+func NewKeyStorage(dbWrapper *db.DatabaseWrapper) *keyStorage {
+	return &keyStorage{
+		collection:   dbWrapper.Database.Collection(keyCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique index on realm and kid
+func (ks *keyStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ks.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := ks.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "realm", Value: 1}, {Key: "kid", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// FindKeys returns the active and passive keys of the realm, newest first
+func (ks *keyStorage) FindKeys(realm string) ([]*dto.SigningKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ks.queryTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"realm": realm, "status": bson.M{"$in": []string{dto.StatusActive, dto.StatusPassive}}}
+	cursor, err := ks.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	keys := []*dto.SigningKey{}
+	err = cursor.All(ctx, &keys)
+	return keys, err
+}
+
+// FindKey returns the key of the realm in any state or nil if there is none
+func (ks *keyStorage) FindKey(realm string, kid string) (*dto.SigningKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ks.queryTimeout*time.Second)
+	defer cancel()
+
+	var key dto.SigningKey
+	err := ks.collection.FindOne(ctx, bson.M{"realm": realm, "kid": kid}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindRealms returns the realms having keys that are not retired
+func (ks *keyStorage) FindRealms() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ks.queryTimeout*time.Second)
+	defer cancel()
+
+	values, err := ks.collection.Distinct(ctx, "realm", bson.M{"status": bson.M{"$ne": dto.StatusRetired}})
+	if err != nil {
+		return nil, err
+	}
+	realms := []string{}
+	for _, value := range values {
+		if realm, ok := value.(string); ok {
+			realms = append(realms, realm)
+		}
+	}
+	return realms, nil
+}
+
+// SaveKey stores a newly generated key
+func (ks *keyStorage) SaveKey(key *dto.SigningKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ks.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := ks.collection.InsertOne(ctx, key)
+	return err
+}
+
+// UpdateKeyStatus moves the key to another lifecycle state. Retired keys lose their private key.
+func (ks *keyStorage) UpdateKeyStatus(realm string, kid string, status string, retireAt *time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ks.queryTimeout*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"status": status, "retireAt": retireAt}}
+	if status == dto.StatusRetired {
+		update["$unset"] = bson.M{"privateKey": ""}
+	}
+	result, err := ks.collection.UpdateOne(ctx, bson.M{"realm": realm, "kid": kid}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// FindKeysToRewrap returns the keys whose private key is sealed with another than the given key encryption key
+func (ks *keyStorage) FindKeysToRewrap(kekID string) ([]*dto.SigningKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ks.queryTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"privateKey": bson.M{"$exists": true}, "privateKey.kekId": bson.M{"$ne": kekID}}
+	cursor, err := ks.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	keys := []*dto.SigningKey{}
+	err = cursor.All(ctx, &keys)
+	return keys, err
+}
+
+// UpdatePrivateKey replaces the sealed private key, provided it is still sealed with the expected key encryption key
+func (ks *keyStorage) UpdatePrivateKey(realm string, kid string, previousKekID string, privateKey *envelope.Envelope) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ks.queryTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"realm": realm, "kid": kid, "privateKey.kekId": previousKekID}
+	_, err := ks.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"privateKey": privateKey}})
+	return err
+}
@@ -0,0 +1,35 @@
+package dto
+
+import "time"
+
+// Kinds of login failure counters
+const (
+	// KindUser counts failures per user id, whether the user logged in with the username or the email
+	KindUser = "user"
+	// KindLogin counts failures per normalized login name of unknown users, so they are locked out like existing ones
+	KindLogin = "login"
+	// KindIPAddress counts failures per source address across all users
+	KindIPAddress = "ip"
+)
+
+// LoginFailures counts the failed logins of a user or source address and tracks its lockout
+type LoginFailures struct {
+	Realm         string    `bson:"realm" json:"realm"`
+	Kind          string    `bson:"kind" json:"kind"`
+	Key           string    `bson:"key" json:"key"`
+	Failures      int       `bson:"failures" json:"failures"`
+	LastFailureAt time.Time `bson:"lastFailureAt" json:"lastFailureAt"`
+	// LockedUntil is the end of a temporary lockout
+	LockedUntil *time.Time `bson:"lockedUntil,omitempty" json:"lockedUntil,omitempty"`
+	// Permanent lockouts last until an admin unlocks the user
+	Permanent bool `bson:"permanent" json:"permanent"`
+	// Lockouts counts the temporary lockouts since the last successful login
+	Lockouts int `bson:"lockouts" json:"lockouts"`
+	// ExpireAt lets Mongo drop counters which no longer matter, permanent lockouts do not expire
+	ExpireAt *time.Time `bson:"expireAt,omitempty" json:"-"`
+}
+
+// Locked reports whether the lockout is permanent or lasts beyond now
+func (lf *LoginFailures) Locked(now time.Time) bool {
+	return lf.Permanent || lf.LockedUntil != nil && now.Before(*lf.LockedUntil)
+}
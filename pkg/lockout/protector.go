@@ -0,0 +1,233 @@
+package lockout
+
+import (
+	"errors"
+	"fmt"
+	eventDto "github.com/NerdShoreDev/YEP/server/pkg/event/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/lockout/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/password"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"strings"
+	"time"
+)
+
+// counterRetention keeps failure counters a day beyond their window and lockout, so lockouts in a row are noticed
+const counterRetention = 24 * time.Hour
+
+// ErrLocked is returned for users locked out until an admin unlocks them
+var ErrLocked = errors.New("account locked, contact your administrator")
+
+// ThrottledError is returned while a user has to wait after a failed login or is locked out for a while, or while the
+// source address is blocked
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (te *ThrottledError) Error() string {
+	return fmt.Sprintf("too many failed logins, try again in %d seconds", int64(math.Ceil(te.RetryAfter.Seconds())))
+}
+
+type RealmSource interface {
+	FindRealm(name string) (*realmDto.Realm, error)
+}
+
+type UserFinder interface {
+	FindUserByUsername(realm string, username string) (*userDto.User, error)
+	FindUserByEmail(realm string, email string) (*userDto.User, error)
+}
+
+type FailureStore interface {
+	FindFailures(realm string, kind string, key string) (*dto.LoginFailures, error)
+	RecordFailure(realm string, kind string, key string, now time.Time, window time.Duration, expireAt time.Time) (*dto.LoginFailures, error)
+	Lock(realm string, kind string, key string, until *time.Time, expireAt time.Time) error
+	DeleteFailures(realm string, kind string, keys ...string) error
+}
+
+type EventLog interface {
+	RecordEvent(event *eventDto.Event) error
+}
+
+type Authenticator interface {
+	Authenticate(realm string, username string, password string) (*userDto.User, error)
+}
+
+type bruteForceProtector struct {
+	realms        RealmSource
+	users         UserFinder
+	failures      FailureStore
+	events        EventLog
+	authenticator Authenticator
+	now           func() time.Time
+}
+
+// NewBruteForceProtector guards the authenticator against password guessing with the thresholds of each realm
+func NewBruteForceProtector(realms RealmSource, users UserFinder, failures FailureStore, events EventLog, authenticator Authenticator) *bruteForceProtector {
+	return &bruteForceProtector{
+		realms:        realms,
+		users:         users,
+		failures:      failures,
+		events:        events,
+		authenticator: authenticator,
+		now:           time.Now,
+	}
+}
+
+// Authenticate checks the password unless the source address is blocked or the user is locked out or has to wait
+// after a failure. Failures are counted per user, whether it logs in with its username or email. Failures of unknown
+// users are counted per login name, so locking them out looks the same as locking out existing ones.
+func (bp *bruteForceProtector) Authenticate(realm string, username string, secret string, ipAddress string) (*userDto.User, error) {
+	settings, err := bp.realms.FindRealm(realm)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil || !settings.BruteForceProtection.Enabled {
+		return bp.authenticator.Authenticate(realm, username, secret)
+	}
+	protection := settings.BruteForceProtection
+	now := bp.now().UTC()
+	target, err := bp.target(realm, username)
+	if err != nil {
+		return nil, err
+	}
+	if ipAddress != "" {
+		if err := bp.check(realm, dto.KindIPAddress, ipAddress, protection, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := bp.check(realm, target.kind, target.key, protection, now); err != nil {
+		return nil, err
+	}
+
+	user, err := bp.authenticator.Authenticate(realm, username, secret)
+	switch err {
+	case password.ErrInvalidCredentials:
+		bp.fail(realm, target, ipAddress, protection, now)
+	case nil, password.ErrPasswordExpired:
+		if err := bp.failures.DeleteFailures(realm, target.kind, target.key); err != nil {
+			log.Errorf("unable to reset failed logins of %s of realm %s: %v", target.key, realm, err)
+		}
+	}
+	return user, err
+}
+
+// Unlock lifts the lockout of the user
+func (bp *bruteForceProtector) Unlock(realm string, user *userDto.User, actor string) error {
+	if err := bp.failures.DeleteFailures(realm, dto.KindUser, user.ID); err != nil {
+		return err
+	}
+	return bp.events.RecordEvent(&eventDto.Event{Realm: realm, Type: eventDto.TypeUserUnlocked, UserID: user.ID, Username: user.Username, Actor: actor})
+}
+
+// failureTarget is what the failed logins of a login name are counted for
+type failureTarget struct {
+	kind string
+	key  string
+	user *userDto.User
+}
+
+// target resolves the login like the authenticator does, to the user with the username or else the email. Unknown
+// logins are counted by their normalized name.
+func (bp *bruteForceProtector) target(realm string, login string) (*failureTarget, error) {
+	user, err := bp.users.FindUserByUsername(realm, login)
+	if err == nil && user == nil && strings.Contains(login, "@") {
+		user, err = bp.users.FindUserByEmail(realm, login)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return &failureTarget{kind: dto.KindLogin, key: userDto.Normalize(login)}, nil
+	}
+	return &failureTarget{kind: dto.KindUser, key: user.ID, user: user}, nil
+}
+
+// check returns an error while the user or address is locked out or has to wait after its last failure
+func (bp *bruteForceProtector) check(realm string, kind string, key string, protection realmDto.BruteForceProtection, now time.Time) error {
+	failures, err := bp.failures.FindFailures(realm, kind, key)
+	if err != nil || failures == nil {
+		return err
+	}
+	if failures.Permanent {
+		return ErrLocked
+	}
+	if failures.Locked(now) {
+		return &ThrottledError{RetryAfter: failures.LockedUntil.Sub(now)}
+	}
+	if kind != dto.KindIPAddress && failures.Failures > 0 {
+		if retryAt := failures.LastFailureAt.Add(delay(protection, failures.Failures)); now.Before(retryAt) {
+			return &ThrottledError{RetryAfter: retryAt.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// delay is the wait after the failures, doubling from the minimum delay up to the maximum
+func delay(protection realmDto.BruteForceProtection, failures int) time.Duration {
+	wait := time.Duration(protection.MinDelay) * time.Second
+	limit := time.Duration(protection.MaxDelay) * time.Second
+	for i := 1; i < failures && wait > 0 && (limit == 0 || wait < limit); i++ {
+		wait *= 2
+	}
+	if limit > 0 && wait > limit {
+		return limit
+	}
+	return wait
+}
+
+// fail counts the failure for the user or login name and the address and locks them out once they reach the
+// thresholds. Errors are only logged, the login failed anyway.
+func (bp *bruteForceProtector) fail(realm string, target *failureTarget, ipAddress string, protection realmDto.BruteForceProtection, now time.Time) {
+	window := time.Duration(protection.FailureWindow) * time.Second
+	lockout := time.Duration(protection.LockoutDuration) * time.Second
+	expireAt := now.Add(window + lockout + counterRetention)
+
+	failures, err := bp.failures.RecordFailure(realm, target.kind, target.key, now, window, expireAt)
+	if err != nil {
+		log.Errorf("unable to count failed login of %s of realm %s: %v", target.key, realm, err)
+	} else if protection.MaxFailures > 0 && failures.Failures >= protection.MaxFailures {
+		event := &eventDto.Event{Realm: realm, Username: target.key, IPAddress: ipAddress, Details: map[string]string{"failures": fmt.Sprint(failures.Failures)}}
+		if target.user != nil {
+			event.UserID = target.user.ID
+			event.Username = target.user.Username
+		}
+		if protection.MaxLockouts > 0 && failures.Lockouts+1 >= protection.MaxLockouts {
+			event.Type = eventDto.TypeUserLockedPermanently
+			bp.lock(realm, target.kind, target.key, nil, expireAt, event)
+		} else if lockout > 0 {
+			until := now.Add(lockout)
+			event.Type = eventDto.TypeUserLocked
+			event.Details["lockedUntil"] = until.Format(time.RFC3339)
+			bp.lock(realm, target.kind, target.key, &until, expireAt, event)
+		}
+	}
+
+	if ipAddress == "" {
+		return
+	}
+	failures, err = bp.failures.RecordFailure(realm, dto.KindIPAddress, ipAddress, now, window, expireAt)
+	if err != nil {
+		log.Errorf("unable to count failed login from %s in realm %s: %v", ipAddress, realm, err)
+	} else if protection.MaxIPFailures > 0 && failures.Failures >= protection.MaxIPFailures && lockout > 0 {
+		until := now.Add(lockout)
+		bp.lock(realm, dto.KindIPAddress, ipAddress, &until, expireAt, &eventDto.Event{
+			Realm:     realm,
+			Type:      eventDto.TypeIPAddressBlocked,
+			IPAddress: ipAddress,
+			Details:   map[string]string{"failures": fmt.Sprint(failures.Failures), "lockedUntil": until.Format(time.RFC3339)},
+		})
+	}
+}
+
+func (bp *bruteForceProtector) lock(realm string, kind string, key string, until *time.Time, expireAt time.Time, event *eventDto.Event) {
+	if err := bp.failures.Lock(realm, kind, key, until, expireAt); err != nil {
+		log.Errorf("unable to lock out %s of realm %s: %v", key, realm, err)
+		return
+	}
+	log.Warnf("%s %s in realm %s", event.Type, key, realm)
+	if err := bp.events.RecordEvent(event); err != nil {
+		log.Errorf("unable to record event %s of realm %s: %v", event.Type, realm, err)
+	}
+}
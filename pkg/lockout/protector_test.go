@@ -0,0 +1,243 @@
+package lockout
+
+import (
+	eventDto "github.com/NerdShoreDev/YEP/server/pkg/event/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/lockout/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/password"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+	"time"
+)
+
+type staticRealms map[string]*realmDto.Realm
+
+func (s staticRealms) FindRealm(name string) (*realmDto.Realm, error) {
+	return s[name], nil
+}
+
+var testRealms = staticRealms{
+	"YEP": {Name: "YEP", Enabled: true, BruteForceProtection: realmDto.BruteForceProtection{
+		Enabled: true, FailureWindow: 3600, MinDelay: 1, MaxDelay: 4, MaxFailures: 5, LockoutDuration: 900, MaxLockouts: 2, MaxIPFailures: 8,
+	}},
+	"open": {Name: "open", Enabled: true},
+}
+
+// memoryFailures keeps the failure counters like the Mongo storage
+type memoryFailures map[string]*dto.LoginFailures
+
+func (m memoryFailures) FindFailures(realm string, kind string, key string) (*dto.LoginFailures, error) {
+	return m[realm+"/"+kind+"/"+key], nil
+}
+
+func (m memoryFailures) RecordFailure(realm string, kind string, key string, now time.Time, window time.Duration, expireAt time.Time) (*dto.LoginFailures, error) {
+	failures, ok := m[realm+"/"+kind+"/"+key]
+	if !ok {
+		failures = &dto.LoginFailures{Realm: realm, Kind: kind, Key: key}
+		m[realm+"/"+kind+"/"+key] = failures
+	}
+	if window > 0 && failures.LastFailureAt.Before(now.Add(-window)) {
+		failures.Failures = 0
+	}
+	failures.Failures++
+	failures.LastFailureAt = now
+	return failures, nil
+}
+
+func (m memoryFailures) Lock(realm string, kind string, key string, until *time.Time, expireAt time.Time) error {
+	failures, ok := m[realm+"/"+kind+"/"+key]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	failures.Failures = 0
+	failures.Lockouts++
+	failures.LockedUntil = until
+	failures.Permanent = until == nil
+	return nil
+}
+
+func (m memoryFailures) DeleteFailures(realm string, kind string, keys ...string) error {
+	for _, key := range keys {
+		delete(m, realm+"/"+kind+"/"+key)
+	}
+	return nil
+}
+
+type memoryEvents []*eventDto.Event
+
+func (m *memoryEvents) RecordEvent(event *eventDto.Event) error {
+	*m = append(*m, event)
+	return nil
+}
+
+// staticUsers finds anna and bob by username or email
+type staticUsers []*userDto.User
+
+var testUsers = staticUsers{
+	{ID: "user-1", Username: "anna", Email: "anna@example.com", Enabled: true},
+	{ID: "user-2", Username: "bob", Email: "bob@example.com", Enabled: true},
+}
+
+func (s staticUsers) FindUserByUsername(realm string, username string) (*userDto.User, error) {
+	for _, user := range s {
+		if user.Username == userDto.Normalize(username) {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s staticUsers) FindUserByEmail(realm string, email string) (*userDto.User, error) {
+	for _, user := range s {
+		if user.Email == userDto.Normalize(email) {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+// staticPasswords knows the password of anna only
+type staticPasswords struct{}
+
+func (staticPasswords) Authenticate(realm string, username string, secret string) (*userDto.User, error) {
+	if login := userDto.Normalize(username); (login == "anna" || login == "anna@example.com") && secret == "s3cret" {
+		return &userDto.User{ID: "user-1", Username: "anna", Enabled: true}, nil
+	}
+	return nil, password.ErrInvalidCredentials
+}
+
+type protectorTest struct {
+	protector *bruteForceProtector
+	failures  memoryFailures
+	events    *memoryEvents
+	now       time.Time
+}
+
+func newProtectorTest() *protectorTest {
+	pt := &protectorTest{failures: memoryFailures{}, events: &memoryEvents{}, now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	pt.protector = NewBruteForceProtector(testRealms, testUsers, pt.failures, pt.events, staticPasswords{})
+	pt.protector.now = func() time.Time { return pt.now }
+	return pt
+}
+
+// failAfter waits for the delay and fails a login
+func (pt *protectorTest) failAfter(wait time.Duration, username string, ipAddress string) error {
+	pt.now = pt.now.Add(wait)
+	_, err := pt.protector.Authenticate("YEP", username, "wrong", ipAddress)
+	return err
+}
+
+func TestBruteForceProtector_whenLoginFails_thenDelayNextAttemptProgressively(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	pt := newProtectorTest()
+	a.Equal(password.ErrInvalidCredentials, pt.failAfter(0, "anna", "10.0.0.1"))
+	a.Equal(password.ErrInvalidCredentials, pt.failAfter(time.Second, "anna", "10.0.0.1"))
+
+	// act
+	_, early := pt.protector.Authenticate("YEP", "Anna", "s3cret", "10.0.0.1")
+	pt.now = pt.now.Add(2 * time.Second)
+	user, err := pt.protector.Authenticate("YEP", "anna", "s3cret", "10.0.0.1")
+
+	// assert
+	a.Equal(&ThrottledError{RetryAfter: 2 * time.Second}, early)
+	a.Equal("too many failed logins, try again in 2 seconds", early.Error())
+	a.NoError(err)
+	a.Equal("user-1", user.ID)
+	a.Nil(pt.failures["YEP/user/user-1"])
+}
+
+func TestBruteForceProtector_whenMaxFailuresReached_thenLockTemporarilyThenPermanently(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	pt := newProtectorTest()
+	for i := 0; i < 5; i++ {
+		pt.failAfter(5*time.Second, "bob", "")
+	}
+
+	// act
+	locked := pt.failAfter(5*time.Second, "bob", "")
+	pt.now = pt.now.Add(15 * time.Minute)
+	for i := 0; i < 5; i++ {
+		pt.failAfter(5*time.Second, "bob", "")
+	}
+	permanent := pt.failAfter(24*time.Hour, "bob", "")
+	unlockErr := pt.protector.Unlock("YEP", &userDto.User{ID: "user-2", Username: "Bob"}, "admin-1")
+	unlocked := pt.failAfter(0, "bob", "")
+
+	// assert
+	a.IsType(&ThrottledError{}, locked)
+	a.Equal(ErrLocked, permanent)
+	a.NoError(unlockErr)
+	a.Equal(password.ErrInvalidCredentials, unlocked)
+	a.Len(*pt.events, 3)
+	a.Equal(eventDto.TypeUserLocked, (*pt.events)[0].Type)
+	a.Equal("user-2", (*pt.events)[0].UserID)
+	a.Equal("bob", (*pt.events)[0].Username)
+	a.Equal(eventDto.TypeUserLockedPermanently, (*pt.events)[1].Type)
+	a.Equal(eventDto.TypeUserUnlocked, (*pt.events)[2].Type)
+	a.Equal("admin-1", (*pt.events)[2].Actor)
+}
+
+func TestBruteForceProtector_whenUsernameLockedOut_thenEmailLoginLockedOutToo(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	pt := newProtectorTest()
+	for i := 0; i < 3; i++ {
+		pt.failAfter(5*time.Second, "anna", "")
+	}
+	for i := 0; i < 2; i++ {
+		pt.failAfter(5*time.Second, "Anna@Example.com", "")
+	}
+
+	// act
+	pt.now = pt.now.Add(5 * time.Second)
+	_, byEmail := pt.protector.Authenticate("YEP", "anna@example.com", "s3cret", "")
+	_, byUsername := pt.protector.Authenticate("YEP", "anna", "s3cret", "")
+	unknown := pt.failAfter(0, "nobody@example.com", "")
+
+	// assert
+	a.IsType(&ThrottledError{}, byEmail)
+	a.IsType(&ThrottledError{}, byUsername)
+	a.Equal(eventDto.TypeUserLocked, (*pt.events)[0].Type)
+	a.Equal("user-1", (*pt.events)[0].UserID)
+	a.Equal(password.ErrInvalidCredentials, unknown)
+	a.Equal(1, pt.failures["YEP/login/nobody@example.com"].Failures)
+}
+
+func TestBruteForceProtector_whenAddressFailsForManyUsers_thenBlockAddress(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	pt := newProtectorTest()
+	for i := 0; i < 8; i++ {
+		pt.failAfter(0, string(rune('a'+i))+"-user", "10.0.0.9")
+	}
+
+	// act
+	_, blocked := pt.protector.Authenticate("YEP", "anna", "s3cret", "10.0.0.9")
+	_, other := pt.protector.Authenticate("YEP", "anna", "s3cret", "10.0.0.10")
+
+	// assert
+	a.IsType(&ThrottledError{}, blocked)
+	a.NoError(other)
+	a.Equal(eventDto.TypeIPAddressBlocked, (*pt.events)[0].Type)
+	a.Equal("10.0.0.9", (*pt.events)[0].IPAddress)
+}
+
+func TestBruteForceProtector_whenRealmUnprotected_thenNeverThrottle(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	pt := newProtectorTest()
+
+	// act
+	for i := 0; i < 20; i++ {
+		pt.protector.Authenticate("open", "anna", "wrong", "10.0.0.1")
+	}
+	_, err := pt.protector.Authenticate("open", "anna", "s3cret", "10.0.0.1")
+
+	// assert
+	a.NoError(err)
+	a.Empty(pt.failures)
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/lockout/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const failureCollection = "loginFailures"
+
+type failureStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewFailureStorage creates the Mongo backed storage of failed login counters
+func NewFailureStorage(dbWrapper *db.DatabaseWrapper) *failureStorage {
+	return &failureStorage{
+		collection:   dbWrapper.Database.Collection(failureCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique index on realm, kind and key and the TTL index dropping expired counters
+func (fs *failureStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), fs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := fs.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "realm", Value: 1}, {Key: "kind", Value: 1}, {Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expireAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// FindFailures returns the failure counter of the user or address or nil if there is none
+func (fs *failureStorage) FindFailures(realm string, kind string, key string) (*dto.LoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fs.queryTimeout*time.Second)
+	defer cancel()
+
+	var failures dto.LoginFailures
+	err := fs.collection.FindOne(ctx, bson.M{"realm": realm, "kind": kind, "key": key}).Decode(&failures)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &failures, nil
+}
+
+// RecordFailure counts a failed login and returns the counter. Failures before the window are forgotten first, a
+// window of 0 keeps them until the counter expires.
+func (fs *failureStorage) RecordFailure(realm string, kind string, key string, now time.Time, window time.Duration, expireAt time.Time) (*dto.LoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fs.queryTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"realm": realm, "kind": kind, "key": key}
+	if window > 0 {
+		stale := bson.M{"realm": realm, "kind": kind, "key": key, "lastFailureAt": bson.M{"$lt": now.Add(-window)}}
+		if _, err := fs.collection.UpdateOne(ctx, stale, bson.M{"$set": bson.M{"failures": 0}}); err != nil {
+			return nil, err
+		}
+	}
+	update := bson.M{
+		"$inc":         bson.M{"failures": 1},
+		"$set":         bson.M{"lastFailureAt": now, "expireAt": expireAt},
+		"$setOnInsert": bson.M{"permanent": false, "lockouts": 0},
+	}
+	var failures dto.LoginFailures
+	err := fs.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&failures)
+	if err != nil {
+		return nil, err
+	}
+	return &failures, nil
+}
+
+// Lock locks the user or address out until the time, or permanently if it is nil, and starts counting failures anew
+func (fs *failureStorage) Lock(realm string, kind string, key string, until *time.Time, expireAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fs.queryTimeout*time.Second)
+	defer cancel()
+
+	update := bson.M{"$inc": bson.M{"lockouts": 1}}
+	if until == nil {
+		update["$set"] = bson.M{"failures": 0, "permanent": true}
+		update["$unset"] = bson.M{"lockedUntil": "", "expireAt": ""}
+	} else {
+		update["$set"] = bson.M{"failures": 0, "lockedUntil": until, "expireAt": expireAt}
+	}
+	result, err := fs.collection.UpdateOne(ctx, bson.M{"realm": realm, "kind": kind, "key": key}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteFailures forgets the failures and lifts the lockouts of the users or addresses
+func (fs *failureStorage) DeleteFailures(realm string, kind string, keys ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := fs.collection.DeleteMany(ctx, bson.M{"realm": realm, "kind": kind, "key": bson.M{"$in": keys}})
+	return err
+}
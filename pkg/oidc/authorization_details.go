@@ -0,0 +1,363 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	"github.com/dgrijalva/jwt-go"
+	"net/url"
+	"reflect"
+	"sort"
+)
+
+// ClaimAuthorizationDetails is the token claim and introspection member carrying granted authorization details
+const ClaimAuthorizationDetails = "authorization_details"
+
+// commonDetailFields are the members RFC 9396 defines for every authorization details type
+var commonDetailFields = map[string]bool{
+	"type":       true,
+	"locations":  true,
+	"actions":    true,
+	"datatypes":  true,
+	"identifier": true,
+	"privileges": true,
+}
+
+// AuthorizationDetail is a single entry of the authorization_details parameter (RFC 9396)
+type AuthorizationDetail struct {
+	Type       string
+	Locations  []string
+	Actions    []string
+	Datatypes  []string
+	Identifier string
+	Privileges []string
+	// Fields holds the type specific members, e.g. instructedAmount for payment_initiation
+	Fields map[string]interface{}
+}
+
+// AuthorizationDetails is the list of structured permissions of a request or token
+type AuthorizationDetails []AuthorizationDetail
+
+// AuthorizationDetailType describes the shape a realm accepts for one authorization details type
+type AuthorizationDetailType struct {
+	Type           string   `json:"type" bson:"type"`
+	Description    string   `json:"description,omitempty" bson:"description,omitempty"`
+	Actions        []string `json:"actions,omitempty" bson:"actions,omitempty"`
+	Locations      []string `json:"locations,omitempty" bson:"locations,omitempty"`
+	Datatypes      []string `json:"datatypes,omitempty" bson:"datatypes,omitempty"`
+	RequiredFields []string `json:"requiredFields,omitempty" bson:"requiredFields,omitempty"`
+	OptionalFields []string `json:"optionalFields,omitempty" bson:"optionalFields,omitempty"`
+}
+
+// AuthorizationDetailTypeSource provides the authorization details types a realm accepts
+type AuthorizationDetailTypeSource interface {
+	GetAuthorizationDetailTypes(realm string) ([]AuthorizationDetailType, error)
+}
+
+// StaticAuthorizationDetailTypes is an AuthorizationDetailTypeSource keyed by realm name
+type StaticAuthorizationDetailTypes map[string][]AuthorizationDetailType
+
+func (s StaticAuthorizationDetailTypes) GetAuthorizationDetailTypes(realm string) ([]AuthorizationDetailType, error) {
+	return s[realm], nil
+}
+
+func (ad AuthorizationDetail) MarshalJSON() ([]byte, error) {
+	raw := make(map[string]interface{}, len(ad.Fields)+6)
+	for name, value := range ad.Fields {
+		raw[name] = value
+	}
+	raw["type"] = ad.Type
+	if len(ad.Locations) > 0 {
+		raw["locations"] = ad.Locations
+	}
+	if len(ad.Actions) > 0 {
+		raw["actions"] = ad.Actions
+	}
+	if len(ad.Datatypes) > 0 {
+		raw["datatypes"] = ad.Datatypes
+	}
+	if ad.Identifier != "" {
+		raw["identifier"] = ad.Identifier
+	}
+	if len(ad.Privileges) > 0 {
+		raw["privileges"] = ad.Privileges
+	}
+	return json.Marshal(raw)
+}
+
+func (ad *AuthorizationDetail) UnmarshalJSON(data []byte) error {
+	var common struct {
+		Type       string   `json:"type"`
+		Locations  []string `json:"locations"`
+		Actions    []string `json:"actions"`
+		Datatypes  []string `json:"datatypes"`
+		Identifier string   `json:"identifier"`
+		Privileges []string `json:"privileges"`
+	}
+	if err := json.Unmarshal(data, &common); err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*ad = AuthorizationDetail{
+		Type:       common.Type,
+		Locations:  common.Locations,
+		Actions:    common.Actions,
+		Datatypes:  common.Datatypes,
+		Identifier: common.Identifier,
+		Privileges: common.Privileges,
+	}
+	for name, value := range raw {
+		if commonDetailFields[name] {
+			continue
+		}
+		if ad.Fields == nil {
+			ad.Fields = map[string]interface{}{}
+		}
+		ad.Fields[name] = value
+	}
+	return nil
+}
+
+// ParseAuthorizationDetails reads the authorization_details parameter of an authorization, PAR or token request
+func ParseAuthorizationDetails(values url.Values) (AuthorizationDetails, error) {
+	param := values.Get("authorization_details")
+	if param == "" {
+		return nil, nil
+	}
+
+	var details AuthorizationDetails
+	if err := json.Unmarshal([]byte(param), &details); err != nil {
+		return nil, NewError(ErrorInvalidAuthorizationDetails, "authorization_details must be a JSON array of objects")
+	}
+	for _, detail := range details {
+		if detail.Type == "" {
+			return nil, NewError(ErrorInvalidAuthorizationDetails, "authorization detail without type")
+		}
+	}
+	return details, nil
+}
+
+// AuthorizationDetailsFromClaims reads granted authorization details back from token claims
+func AuthorizationDetailsFromClaims(claims jwt.MapClaims) (AuthorizationDetails, error) {
+	value, ok := claims[ClaimAuthorizationDetails]
+	if !ok {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var details AuthorizationDetails
+	if err := json.Unmarshal(encoded, &details); err != nil {
+		return nil, fmt.Errorf("malformed authorization_details claim: %v", err)
+	}
+	return details, nil
+}
+
+// AddToClaims embeds the granted authorization details into token claims
+func (ads AuthorizationDetails) AddToClaims(claims jwt.MapClaims) {
+	if len(ads) == 0 {
+		return
+	}
+	claims[ClaimAuthorizationDetails] = ads
+}
+
+// Types returns the distinct types of the authorization details in sorted order
+func (ads AuthorizationDetails) Types() []string {
+	seen := map[string]bool{}
+	var types []string
+	for _, detail := range ads {
+		if !seen[detail.Type] {
+			seen[detail.Type] = true
+			types = append(types, detail.Type)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Covers reports whether every requested authorization detail is contained in one of the granted details.
+// The token endpoint uses it to allow clients to narrow down, but never widen, the granted permissions.
+func (ads AuthorizationDetails) Covers(requested AuthorizationDetails) bool {
+	for _, r := range requested {
+		covered := false
+		for _, granted := range ads {
+			if granted.covers(r) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+func (ad AuthorizationDetail) covers(requested AuthorizationDetail) bool {
+	if ad.Type != requested.Type || ad.Identifier != requested.Identifier {
+		return false
+	}
+	if !isSubset(requested.Locations, ad.Locations) ||
+		!isSubset(requested.Actions, ad.Actions) ||
+		!isSubset(requested.Datatypes, ad.Datatypes) ||
+		!isSubset(requested.Privileges, ad.Privileges) {
+		return false
+	}
+	for name, value := range requested.Fields {
+		if !reflect.DeepEqual(ad.Fields[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks the authorization detail against the type schema of the realm
+func (adt AuthorizationDetailType) Validate(detail AuthorizationDetail) error {
+	if len(adt.Actions) > 0 && !isSubset(detail.Actions, adt.Actions) {
+		return NewError(ErrorInvalidAuthorizationDetails, "unsupported actions %v for type %s", detail.Actions, adt.Type)
+	}
+	if len(adt.Locations) > 0 && !isSubset(detail.Locations, adt.Locations) {
+		return NewError(ErrorInvalidAuthorizationDetails, "unsupported locations %v for type %s", detail.Locations, adt.Type)
+	}
+	if len(adt.Datatypes) > 0 && !isSubset(detail.Datatypes, adt.Datatypes) {
+		return NewError(ErrorInvalidAuthorizationDetails, "unsupported datatypes %v for type %s", detail.Datatypes, adt.Type)
+	}
+	for _, field := range adt.RequiredFields {
+		if _, ok := detail.Fields[field]; !ok {
+			return NewError(ErrorInvalidAuthorizationDetails, "missing %s for type %s", field, adt.Type)
+		}
+	}
+	allowed := append(append([]string{}, adt.RequiredFields...), adt.OptionalFields...)
+	for field := range detail.Fields {
+		if !contains(allowed, field) {
+			return NewError(ErrorInvalidAuthorizationDetails, "unknown member %s for type %s", field, adt.Type)
+		}
+	}
+	return nil
+}
+
+// ValidateAuthorizationDetailTypes checks the authorization details types of a realm before they are stored
+func ValidateAuthorizationDetailTypes(types []realmDto.AuthorizationDetailType) error {
+	seen := map[string]bool{}
+	for _, detailType := range types {
+		if detailType.Type == "" {
+			return fmt.Errorf("authorization details type without name")
+		}
+		if seen[detailType.Type] {
+			return fmt.Errorf("authorization details type %s is defined twice", detailType.Type)
+		}
+		seen[detailType.Type] = true
+		fields := map[string]bool{}
+		for _, field := range append(append([]string{}, detailType.RequiredFields...), detailType.OptionalFields...) {
+			if field == "" || commonDetailFields[field] {
+				return fmt.Errorf("invalid field %q of authorization details type %s", field, detailType.Type)
+			}
+			if fields[field] {
+				return fmt.Errorf("field %s of authorization details type %s is listed twice", field, detailType.Type)
+			}
+			fields[field] = true
+		}
+	}
+	return nil
+}
+
+type authorizationDetailsValidator struct {
+	source AuthorizationDetailTypeSource
+}
+
+// NewAuthorizationDetailsValidator creates a validator checking authorization details against per-realm type schemas
+func NewAuthorizationDetailsValidator(source AuthorizationDetailTypeSource) *authorizationDetailsValidator {
+	return &authorizationDetailsValidator{source: source}
+}
+
+// Validate rejects authorization details of unknown types or not matching the type schema of the realm
+func (v *authorizationDetailsValidator) Validate(realm string, details AuthorizationDetails) error {
+	if len(details) == 0 {
+		return nil
+	}
+	types, err := v.lookup(realm)
+	if err != nil {
+		return err
+	}
+	for _, detail := range details {
+		detailType, ok := types[detail.Type]
+		if !ok {
+			return NewError(ErrorInvalidAuthorizationDetails, "unsupported type %s", detail.Type)
+		}
+		if err := detailType.Validate(detail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Describe pairs each authorization detail with the description of its type for the consent screen
+func (v *authorizationDetailsValidator) Describe(realm string, details AuthorizationDetails) ([]AuthorizationDetailDescription, error) {
+	types, err := v.lookup(realm)
+	if err != nil {
+		return nil, err
+	}
+	descriptions := make([]AuthorizationDetailDescription, 0, len(details))
+	for _, detail := range details {
+		descriptions = append(descriptions, AuthorizationDetailDescription{
+			AuthorizationDetail: detail,
+			Description:         types[detail.Type].Description,
+		})
+	}
+	return descriptions, nil
+}
+
+// SupportedTypes lists the authorization details types of the realm for the discovery document
+func (v *authorizationDetailsValidator) SupportedTypes(realm string) ([]string, error) {
+	types, err := v.lookup(realm)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (v *authorizationDetailsValidator) lookup(realm string) (map[string]AuthorizationDetailType, error) {
+	list, err := v.source.GetAuthorizationDetailTypes(realm)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load authorization details types of realm %s: %v", realm, err)
+	}
+	types := make(map[string]AuthorizationDetailType, len(list))
+	for _, t := range list {
+		types[t.Type] = t
+	}
+	return types, nil
+}
+
+// AuthorizationDetailDescription is an authorization detail as shown on the consent screen
+type AuthorizationDetailDescription struct {
+	AuthorizationDetail
+	Description string
+}
+
+func isSubset(values []string, allowed []string) bool {
+	for _, value := range values {
+		if !contains(allowed, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
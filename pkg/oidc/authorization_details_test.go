@@ -0,0 +1,176 @@
+package oidc
+
+import (
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+const paymentDetails = `[{"type":"payment_initiation","actions":["initiate","status"],"locations":["https://example.com/payments"],"instructedAmount":{"currency":"EUR","amount":"123.50"},"creditorName":"Merchant A"}]`
+
+var paymentTypes = StaticAuthorizationDetailTypes{
+	"YEP": {
+		{
+			Type:           "payment_initiation",
+			Description:    "Initiate a payment",
+			Actions:        []string{"initiate", "status", "cancel"},
+			Locations:      []string{"https://example.com/payments"},
+			RequiredFields: []string{"instructedAmount"},
+			OptionalFields: []string{"creditorName", "creditorAccount"},
+		},
+	},
+}
+
+func TestParseAuthorizationDetails(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	values := url.Values{"authorization_details": {paymentDetails}}
+
+	// act
+	details, err := ParseAuthorizationDetails(values)
+
+	// assert
+	a.NoError(err)
+	a.Len(details, 1)
+	a.Equal("payment_initiation", details[0].Type)
+	a.Equal([]string{"initiate", "status"}, details[0].Actions)
+	a.Equal("Merchant A", details[0].Fields["creditorName"])
+	a.NotContains(details[0].Fields, "type")
+}
+
+func TestParseAuthorizationDetails_whenNotAnArray_thenFail(t *testing.T) {
+	// arrange
+	values := url.Values{"authorization_details": {`{"type":"payment_initiation"}`}}
+
+	// act
+	_, err := ParseAuthorizationDetails(values)
+
+	// assert
+	assert.EqualError(t, err, "invalid_authorization_details: authorization_details must be a JSON array of objects")
+}
+
+func TestAuthorizationDetailsValidation(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	details, _ := ParseAuthorizationDetails(url.Values{"authorization_details": {paymentDetails}})
+	validator := NewAuthorizationDetailsValidator(paymentTypes)
+
+	// act
+	err := validator.Validate("YEP", details)
+
+	// assert
+	a.NoError(err)
+}
+
+func TestAuthorizationDetailsValidation_whenTypeUnknownInRealm_thenFail(t *testing.T) {
+	// arrange
+	details, _ := ParseAuthorizationDetails(url.Values{"authorization_details": {paymentDetails}})
+	validator := NewAuthorizationDetailsValidator(paymentTypes)
+
+	// act
+	err := validator.Validate("Fielmann", details)
+
+	// assert
+	assert.EqualError(t, err, "invalid_authorization_details: unsupported type payment_initiation")
+}
+
+func TestAuthorizationDetailsValidation_whenRequiredFieldMissing_thenFail(t *testing.T) {
+	// arrange
+	details := AuthorizationDetails{{Type: "payment_initiation", Actions: []string{"initiate"}}}
+	validator := NewAuthorizationDetailsValidator(paymentTypes)
+
+	// act
+	err := validator.Validate("YEP", details)
+
+	// assert
+	assert.EqualError(t, err, "invalid_authorization_details: missing instructedAmount for type payment_initiation")
+}
+
+func TestAuthorizationDetailsValidation_whenActionNotAllowed_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	details := AuthorizationDetails{{
+		Type:    "payment_initiation",
+		Actions: []string{"refund"},
+		Fields:  map[string]interface{}{"instructedAmount": "1"},
+	}}
+	validator := NewAuthorizationDetailsValidator(paymentTypes)
+
+	// act
+	err := validator.Validate("YEP", details)
+
+	// assert
+	a.Error(err)
+	a.Contains(err.Error(), "unsupported actions [refund]")
+}
+
+func TestAuthorizationDetailsCovers(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	granted, _ := ParseAuthorizationDetails(url.Values{"authorization_details": {paymentDetails}})
+	narrowed := AuthorizationDetails{{
+		Type:    "payment_initiation",
+		Actions: []string{"status"},
+	}}
+	widened := AuthorizationDetails{{
+		Type:    "payment_initiation",
+		Actions: []string{"cancel"},
+	}}
+
+	// act & assert
+	a.True(granted.Covers(narrowed))
+	a.False(granted.Covers(widened))
+}
+
+func TestAuthorizationDetailsClaimRoundTrip(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	granted, _ := ParseAuthorizationDetails(url.Values{"authorization_details": {paymentDetails}})
+	claims := jwt.MapClaims{"sub": "f1351779"}
+
+	// act
+	granted.AddToClaims(claims)
+	response, err := NewIntrospectionResponse(claims)
+
+	// assert
+	a.NoError(err)
+	a.True(response.Active)
+	a.Equal(granted, response.AuthorizationDetails)
+}
+
+func TestAuthorizationDetailsValidation_whenTypesStoredInRealm_thenValidateAgainstThem(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	realms := staticRealms{"YEP": {Name: "YEP", Enabled: true, AuthorizationDetailTypes: []realmDto.AuthorizationDetailType{
+		{Type: "account_information", Actions: []string{"read"}, OptionalFields: []string{"iban"}},
+	}}}
+	validator := NewAuthorizationDetailsValidator(NewRealmAuthorizationDetailTypes(realms))
+
+	// act
+	valid := validator.Validate("YEP", AuthorizationDetails{{Type: "account_information", Actions: []string{"read"}, Fields: map[string]interface{}{"iban": "DE02"}}})
+	unknown := validator.Validate("YEP", AuthorizationDetails{{Type: "payment_initiation"}})
+	otherRealm := validator.Validate("other", AuthorizationDetails{{Type: "account_information"}})
+	types, _ := validator.SupportedTypes("YEP")
+
+	// assert
+	a.NoError(valid)
+	a.Error(unknown)
+	a.Error(otherRealm)
+	a.Equal([]string{"account_information"}, types)
+}
+
+func TestValidateAuthorizationDetailTypes(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	valid := realmDto.AuthorizationDetailType{Type: "payment_initiation", RequiredFields: []string{"instructedAmount"}, OptionalFields: []string{"creditorName"}}
+
+	// act & assert
+	a.NoError(ValidateAuthorizationDetailTypes(nil))
+	a.NoError(ValidateAuthorizationDetailTypes([]realmDto.AuthorizationDetailType{valid}))
+	a.EqualError(ValidateAuthorizationDetailTypes([]realmDto.AuthorizationDetailType{valid, valid}), "authorization details type payment_initiation is defined twice")
+	a.EqualError(ValidateAuthorizationDetailTypes([]realmDto.AuthorizationDetailType{{}}), "authorization details type without name")
+	a.EqualError(ValidateAuthorizationDetailTypes([]realmDto.AuthorizationDetailType{{Type: "x", OptionalFields: []string{"actions"}}}), `invalid field "actions" of authorization details type x`)
+	a.EqualError(ValidateAuthorizationDetailTypes([]realmDto.AuthorizationDetailType{{Type: "x", RequiredFields: []string{"a"}, OptionalFields: []string{"a"}}}), "field a of authorization details type x is listed twice")
+}
@@ -0,0 +1,292 @@
+package oidc
+
+import (
+	"fmt"
+	"github.com/NerdShoreDev/YEP/server/pkg/consent/dto"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	interactionTTL       = 10 * time.Minute
+	authorizationCodeTTL = time.Minute
+	pushedRequestTTL     = time.Minute
+)
+
+// ConsentStore persists the scopes and claims users granted to clients
+type ConsentStore interface {
+	FindConsent(realm string, userID string, clientID string) (*dto.Consent, error)
+	SaveConsent(realm string, userID string, clientID string, scopes []string, claims []string) error
+}
+
+// SessionStore keeps the browser sessions of logged in users
+type SessionStore interface {
+	CurrentSession(r *http.Request, realm string) (*Session, error)
+	Create(w http.ResponseWriter, session *Session) error
+	Reauthenticate(session *Session, acr string, authTime time.Time) (*Session, error)
+	Delete(w http.ResponseWriter, session *Session)
+}
+
+// Grant is what an authorization code stands for
+type Grant struct {
+	Request              *AuthorizationRequest
+	Subject              string
+	SessionID            string
+	AuthTime             time.Time
+	ACR                  string
+	Scopes               []string
+	AuthorizationDetails AuthorizationDetails
+}
+
+// interaction is an authorization request waiting for the user to log in or consent
+type interaction struct {
+	ID      string
+	Request *AuthorizationRequest
+	Client  *Client
+	// Subject is the end-user the request is bound to by its id_token_hint
+	Subject string
+	// Browser is the value of the browser cookie of the browser which started the interaction
+	Browser string
+	// CSRF is the token the login and consent forms post back
+	CSRF string
+}
+
+type authorizationHandler struct {
+	clients      ClientLookup
+	consents     ConsentStore
+	sessions     SessionStore
+	passwords    PasswordAuthenticator
+	pages        PageRenderer
+	details      *authorizationDetailsValidator
+	claims       *claimsEngine
+	subjects     *subjectResolver
+	acrLevels    ACRLevels
+	interactions *expiringStore
+	codes        *expiringStore
+	// pushed holds the pushed authorization requests by their request_uri
+	pushed *expiringStore
+	// logouts holds the confirmations of the logout page by the session they end
+	logouts *expiringStore
+}
+
+// NewAuthorizationHandler creates the handler of the authorization endpoint and its login, consent and logout pages
+func NewAuthorizationHandler(clients ClientLookup, consents ConsentStore, sessions SessionStore, passwords PasswordAuthenticator, pages PageRenderer, details *authorizationDetailsValidator, claims *claimsEngine, subjects *subjectResolver) *authorizationHandler {
+	return &authorizationHandler{
+		clients:      clients,
+		consents:     consents,
+		sessions:     sessions,
+		passwords:    passwords,
+		pages:        pages,
+		details:      details,
+		claims:       claims,
+		subjects:     subjects,
+		acrLevels:    DefaultACRLevels,
+		interactions: newExpiringStore(interactionTTL),
+		codes:        newExpiringStore(authorizationCodeTTL),
+		pushed:       newExpiringStore(pushedRequestTTL),
+		logouts:      newExpiringStore(interactionTTL),
+	}
+}
+
+// Authorize handles the authorization endpoint
+func (ah *authorizationHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	if err := r.ParseForm(); err != nil {
+		ah.renderError(w, r, http.StatusBadRequest, NewError(ErrorInvalidRequest, "malformed request"))
+		return
+	}
+
+	request, err := ah.authorizationRequest(realm, r.Form)
+	if err != nil {
+		ah.renderError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Errors are only redirected back to the client once the redirect URI is known to be registered
+	client, err := ah.clients.GetClient(realm, request.ClientID)
+	if err != nil {
+		log.Debugf("Authorize: client lookup failed: %v", err)
+		ah.renderError(w, r, http.StatusBadRequest, NewError(ErrorUnauthorizedClient, "unknown client"))
+		return
+	}
+	if !client.AllowsRedirectURI(request.RedirectURI) {
+		ah.renderError(w, r, http.StatusBadRequest, NewError(ErrorInvalidRequest, "redirect_uri not registered"))
+		return
+	}
+
+	if err := ah.checkRequest(client, request); err != nil {
+		redirectError(w, r, request, err)
+		return
+	}
+
+	hint, err := parseIDTokenHint(request.IDTokenHint)
+	if err != nil {
+		redirectError(w, r, request, err)
+		return
+	}
+	if hint != nil {
+		// Clients with pairwise subjects know the user by another identifier than the session
+		if hint["sub"], err = ah.subjects.LocalSubject(realm, stringClaim(hint, "sub")); err != nil {
+			redirectError(w, r, request, err)
+			return
+		}
+	}
+
+	in := &interaction{Request: request, Client: client, Subject: stringClaim(hint, "sub")}
+	if err := bindToBrowser(w, r, in); err != nil {
+		redirectError(w, r, request, err)
+		return
+	}
+	if in.ID, err = ah.interactions.put(in); err != nil {
+		redirectError(w, r, request, err)
+		return
+	}
+
+	session, err := ah.sessions.CurrentSession(r, realm)
+	if err != nil {
+		redirectError(w, r, request, err)
+		return
+	}
+	if !ah.sessionSatisfies(request, session, hint, time.Now()) {
+		if request.HasPrompt("none") {
+			ah.interactions.delete(in.ID)
+			redirectError(w, r, request, NewError(ErrorLoginRequired, "end-user authentication required"))
+			return
+		}
+		// Users should not log in for nothing when the login cannot reach any of the requested strengths
+		if !ah.acrLevels.Satisfies(passwordACR, request.ACRValues) {
+			ah.interactions.delete(in.ID)
+			redirectError(w, r, request, NewError(ErrorUnmetAuthenticationRequirements, "none of the acr_values %v can be met", request.ACRValues))
+			return
+		}
+		http.Redirect(w, r, loginURL(in), http.StatusFound)
+		return
+	}
+
+	ah.proceed(w, r, in, session)
+}
+
+// checkRequest applies the checks of requests from known clients with registered redirect URIs
+func (ah *authorizationHandler) checkRequest(client *Client, request *AuthorizationRequest) error {
+	if request.ResponseType != "code" {
+		return NewError(ErrorUnsupportedResponseType, "only response_type code is supported")
+	}
+	if !client.AllowsGrantType(GrantTypeAuthorizationCode) {
+		return NewError(ErrorUnauthorizedClient, "client may not use the authorization code grant")
+	}
+	// Public clients cannot prove that they requested the code, so the code must be bound to their PKCE verifier
+	if client.Public && request.CodeChallenge == "" {
+		return NewError(ErrorInvalidRequest, "public clients must send a code_challenge with method %s", CodeChallengeMethodS256)
+	}
+	return ah.details.Validate(request.Realm, request.AuthorizationDetails)
+}
+
+// proceed asks for consent where required and otherwise completes the authorization
+func (ah *authorizationHandler) proceed(w http.ResponseWriter, r *http.Request, in *interaction, session *Session) {
+	request := in.Request
+	consent, err := ah.consents.FindConsent(request.Realm, session.Subject, request.ClientID)
+	if err != nil {
+		log.Errorf("unable to read consent: %v", err)
+		redirectError(w, r, request, NewError(ErrorServerError, "unable to read consent"))
+		return
+	}
+	if consentRequired(request, in.Client, consent) {
+		if request.HasPrompt("none") {
+			ah.interactions.delete(in.ID)
+			redirectError(w, r, request, NewError(ErrorConsentRequired, "end-user consent required"))
+			return
+		}
+		http.Redirect(w, r, endpointPath(request.Realm, "consent")+"?interaction="+url.QueryEscape(in.ID), http.StatusFound)
+		return
+	}
+
+	ah.complete(w, r, in, session)
+}
+
+// complete issues the authorization code and sends the user back to the client
+func (ah *authorizationHandler) complete(w http.ResponseWriter, r *http.Request, in *interaction, session *Session) {
+	ah.interactions.delete(in.ID)
+	request := in.Request
+	// The code must not claim a weaker authentication than the client asked for, whichever way the user got here
+	if !ah.acrLevels.Satisfies(session.ACR, request.ACRValues) {
+		redirectError(w, r, request, NewError(ErrorUnmetAuthenticationRequirements, "none of the acr_values %v was met", request.ACRValues))
+		return
+	}
+
+	code, err := ah.codes.put(&Grant{
+		Request:              request,
+		Subject:              session.Subject,
+		SessionID:            session.ID,
+		AuthTime:             session.AuthTime,
+		ACR:                  session.ACR,
+		Scopes:               request.Scopes,
+		AuthorizationDetails: request.AuthorizationDetails,
+	})
+	if err != nil {
+		redirectError(w, r, request, err)
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	http.Redirect(w, r, appendQuery(request.RedirectURI, params), http.StatusFound)
+}
+
+// RedeemCode exchanges an authorization code for its grant. Codes can be redeemed only once.
+func (ah *authorizationHandler) RedeemCode(code string) (*Grant, bool) {
+	value, ok := ah.codes.take(code)
+	if !ok {
+		return nil, false
+	}
+	return value.(*Grant), true
+}
+
+func (ah *authorizationHandler) lookupInteraction(id string) (*interaction, bool) {
+	value, ok := ah.interactions.get(id)
+	if !ok {
+		return nil, false
+	}
+	return value.(*interaction), true
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, request *AuthorizationRequest, err error) {
+	oauthErr, ok := err.(*Error)
+	if !ok {
+		log.Errorf("authorization request failed: %v", err)
+		oauthErr = &Error{Code: ErrorServerError}
+	}
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	http.Redirect(w, r, appendQuery(request.RedirectURI, params), http.StatusFound)
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := parsed.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+func realmPath(realm string) string {
+	return fmt.Sprintf("/auth/realm/%s", url.PathEscape(realm))
+}
+
+func endpointPath(realm string, endpoint string) string {
+	return realmPath(realm) + "/protocol/openid-connect/" + endpoint
+}
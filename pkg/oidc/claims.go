@@ -0,0 +1,382 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Targets of released claims
+const (
+	TargetIDToken  = "id_token"
+	TargetUserInfo = "userinfo"
+)
+
+// protocolClaims are set by the token issuer and can not be requested or mapped
+var protocolClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "iat": true, "nbf": true, "jti": true,
+	"auth_time": true, "nonce": true, "acr": true, "amr": true, "azp": true, "sid": true,
+}
+
+// ClaimsRequest is the claims request parameter of OpenID Connect
+type ClaimsRequest struct {
+	UserInfo map[string]*ClaimRequest `json:"userinfo,omitempty"`
+	IDToken  map[string]*ClaimRequest `json:"id_token,omitempty"`
+}
+
+// ClaimRequest holds the constraints of an individually requested claim. A nil ClaimRequest requests a voluntary claim.
+type ClaimRequest struct {
+	Essential bool          `json:"essential,omitempty"`
+	Value     interface{}   `json:"value,omitempty"`
+	Values    []interface{} `json:"values,omitempty"`
+}
+
+// ClaimMapping releases a user attribute as claim
+type ClaimMapping struct {
+	Claim     string `json:"claim" bson:"claim"`
+	Attribute string `json:"attribute" bson:"attribute"`
+	IDToken   bool   `json:"idToken" bson:"idToken"`
+	UserInfo  bool   `json:"userInfo" bson:"userInfo"`
+}
+
+// ScopeMapping lists the claims a scope releases
+type ScopeMapping struct {
+	Scope       string         `json:"scope" bson:"scope"`
+	Description string         `json:"description,omitempty" bson:"description,omitempty"`
+	Claims      []ClaimMapping `json:"claims" bson:"claims"`
+}
+
+// ScopeMappingSource provides the scope-to-claim mappings configured for a realm
+type ScopeMappingSource interface {
+	GetScopeMappings(realm string) ([]ScopeMapping, error)
+}
+
+// UserClaimsSource provides the attributes of a user which can be released as claims
+type UserClaimsSource interface {
+	GetUserClaims(realm string, subject string) (map[string]interface{}, error)
+}
+
+// StaticScopeMappings is a ScopeMappingSource keyed by realm name
+type StaticScopeMappings map[string][]ScopeMapping
+
+func (s StaticScopeMappings) GetScopeMappings(realm string) ([]ScopeMapping, error) {
+	return s[realm], nil
+}
+
+// StaticUserClaims is a UserClaimsSource keyed by realm name and subject
+type StaticUserClaims map[string]map[string]map[string]interface{}
+
+func (s StaticUserClaims) GetUserClaims(realm string, subject string) (map[string]interface{}, error) {
+	return s[realm][subject], nil
+}
+
+// UserFinder looks up the user a subject stands for
+type UserFinder interface {
+	FindUser(realm string, id string) (*userDto.User, error)
+}
+
+type userClaims struct {
+	users UserFinder
+}
+
+// NewUserClaims creates the UserClaimsSource reading the attributes of the stored users
+func NewUserClaims(users UserFinder) *userClaims {
+	return &userClaims{users: users}
+}
+
+// GetUserClaims returns the custom attributes of the user together with the standard claims of its profile. Custom
+// attributes with one value are released as string, others as array. The profile wins over custom attributes of the
+// same name, so an attribute cannot claim a verified email.
+func (uc *userClaims) GetUserClaims(realm string, subject string) (map[string]interface{}, error) {
+	user, err := uc.users.FindUser(realm, subject)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	attributes := map[string]interface{}{}
+	for name, values := range user.Attributes {
+		if len(values) == 1 {
+			attributes[name] = values[0]
+		} else if len(values) > 1 {
+			attributes[name] = values
+		}
+	}
+	profile := map[string]string{
+		"preferred_username": user.Username,
+		"given_name":         user.FirstName,
+		"family_name":        user.LastName,
+		"name":               strings.TrimSpace(user.FirstName + " " + user.LastName),
+		"email":              user.Email,
+		"phone_number":       user.PhoneNumber,
+	}
+	for name, value := range profile {
+		if value != "" {
+			attributes[name] = value
+		} else {
+			delete(attributes, name)
+		}
+	}
+	if user.Email != "" {
+		attributes["email_verified"] = user.EmailVerified
+	}
+	if user.PhoneNumber != "" {
+		attributes["phone_number_verified"] = user.PhoneNumberVerified
+	}
+	if !user.UpdatedAt.IsZero() {
+		attributes["updated_at"] = user.UpdatedAt.Unix()
+	}
+	return attributes, nil
+}
+
+// ValidateScopeMappings checks the scope mappings of a realm
+func ValidateScopeMappings(mappings []realmDto.ScopeMapping) error {
+	scopes := map[string]bool{}
+	for _, scopeMapping := range mappings {
+		if scopeMapping.Scope == "" || strings.ContainsAny(scopeMapping.Scope, " \t\n\"\\") {
+			return fmt.Errorf("invalid scope %q", scopeMapping.Scope)
+		}
+		if scopes[scopeMapping.Scope] {
+			return fmt.Errorf("scope %s is mapped twice", scopeMapping.Scope)
+		}
+		scopes[scopeMapping.Scope] = true
+		for _, claimMapping := range scopeMapping.Claims {
+			if claimMapping.Claim == "" || claimMapping.Attribute == "" {
+				return fmt.Errorf("claims of scope %s need a claim and an attribute", scopeMapping.Scope)
+			}
+			if protocolClaims[claimMapping.Claim] {
+				return fmt.Errorf("claim %s of scope %s is set by the server and cannot be mapped", claimMapping.Claim, scopeMapping.Scope)
+			}
+			if !claimMapping.IDToken && !claimMapping.UserInfo {
+				return fmt.Errorf("claim %s of scope %s is released neither to ID tokens nor to userinfo", claimMapping.Claim, scopeMapping.Scope)
+			}
+		}
+	}
+	return nil
+}
+
+// DefaultScopeMappings are the standard OpenID Connect scopes. Realms can override each of them.
+var DefaultScopeMappings = []ScopeMapping{
+	{Scope: "openid", Description: "Sign you in"},
+	{Scope: "profile", Description: "Read your basic profile", Claims: identityMappings("name", "family_name", "given_name",
+		"middle_name", "nickname", "preferred_username", "profile", "picture", "website", "gender", "birthdate",
+		"zoneinfo", "locale", "updated_at")},
+	{Scope: "email", Description: "Read your email address", Claims: identityMappings("email", "email_verified")},
+	{Scope: "address", Description: "Read your postal address", Claims: identityMappings("address")},
+	{Scope: "phone", Description: "Read your phone number", Claims: identityMappings("phone_number", "phone_number_verified")},
+	{Scope: "offline_access", Description: "Access your data while you are offline"},
+}
+
+func identityMappings(claims ...string) []ClaimMapping {
+	mappings := make([]ClaimMapping, 0, len(claims))
+	for _, claim := range claims {
+		mappings = append(mappings, ClaimMapping{Claim: claim, Attribute: claim, IDToken: true, UserInfo: true})
+	}
+	return mappings
+}
+
+// ParseClaimsRequest reads the claims request parameter
+func ParseClaimsRequest(values url.Values) (*ClaimsRequest, error) {
+	param := values.Get("claims")
+	if param == "" {
+		return nil, nil
+	}
+	var request ClaimsRequest
+	if err := json.Unmarshal([]byte(param), &request); err != nil {
+		return nil, NewError(ErrorInvalidRequest, "claims must be a JSON object")
+	}
+	return &request, nil
+}
+
+// Requested returns the individually requested claims for the target
+func (cr *ClaimsRequest) Requested(target string) map[string]*ClaimRequest {
+	if cr == nil {
+		return nil
+	}
+	if target == TargetIDToken {
+		return cr.IDToken
+	}
+	return cr.UserInfo
+}
+
+// Names lists the individually requested claims of both targets in sorted order
+func (cr *ClaimsRequest) Names() []string {
+	if cr == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, requested := range []map[string]*ClaimRequest{cr.IDToken, cr.UserInfo} {
+		for name := range requested {
+			if !protocolClaims[name] {
+				seen[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Matches reports whether value satisfies the value or values constraint of the claim request
+func (cr *ClaimRequest) Matches(value interface{}) bool {
+	if cr == nil {
+		return true
+	}
+	if cr.Value != nil && !reflect.DeepEqual(normalizeJSON(cr.Value), normalizeJSON(value)) {
+		return false
+	}
+	if len(cr.Values) > 0 {
+		for _, v := range cr.Values {
+			if reflect.DeepEqual(normalizeJSON(v), normalizeJSON(value)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// stringValues returns the string values of the value or values constraint
+func (cr *ClaimRequest) stringValues() []string {
+	var values []string
+	for _, v := range append([]interface{}{cr.Value}, cr.Values...) {
+		if s, ok := v.(string); ok && s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// normalizeJSON brings values into the shape encoding/json decodes them to, so they can be compared
+func normalizeJSON(value interface{}) interface{} {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+type claimsEngine struct {
+	mappings ScopeMappingSource
+	users    UserClaimsSource
+}
+
+// NewClaimsEngine creates the engine releasing user attributes as claims for ID tokens and the userinfo endpoint
+func NewClaimsEngine(mappings ScopeMappingSource, users UserClaimsSource) *claimsEngine {
+	return &claimsEngine{
+		mappings: mappings,
+		users:    users,
+	}
+}
+
+// Resolve returns the claims released to the target by the granted scopes and the individually requested claims
+func (ce *claimsEngine) Resolve(realm string, subject string, scopes []string, requested map[string]*ClaimRequest, target string) (map[string]interface{}, error) {
+	mappings, err := ce.scopeMappings(realm)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := ce.users.GetUserClaims(realm, subject)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load claims of user %s: %v", subject, err)
+	}
+
+	claims := map[string]interface{}{}
+	for _, scope := range scopes {
+		for _, mapping := range mappings[scope].Claims {
+			if !mapping.appliesTo(target) || protocolClaims[mapping.Claim] {
+				continue
+			}
+			if value, ok := attributes[mapping.Attribute]; ok && requested[mapping.Claim].Matches(value) {
+				claims[mapping.Claim] = value
+			}
+		}
+	}
+
+	// Individually requested claims are released if the realm maps them for the target, whichever scope maps them.
+	// Attributes no mapping releases stay internal.
+	for name, request := range requested {
+		if _, ok := claims[name]; ok || protocolClaims[name] {
+			continue
+		}
+		mapping, ok := mappingOf(mappings, name, target)
+		if !ok {
+			continue
+		}
+		if value, ok := attributes[mapping.Attribute]; ok && request.Matches(value) {
+			claims[name] = value
+		}
+	}
+	return claims, nil
+}
+
+// ScopeDescriptions returns the consent screen description and released claim names of each scope
+func (ce *claimsEngine) ScopeDescriptions(realm string, scopes []string) ([]consentScope, error) {
+	mappings, err := ce.scopeMappings(realm)
+	if err != nil {
+		return nil, err
+	}
+	descriptions := make([]consentScope, 0, len(scopes))
+	for _, scope := range scopes {
+		mapping, ok := mappings[scope]
+		description := mapping.Description
+		if !ok || description == "" {
+			description = scope
+		}
+		var claims []string
+		for _, claim := range mapping.Claims {
+			claims = append(claims, claim.Claim)
+		}
+		descriptions = append(descriptions, consentScope{Name: scope, Description: description, Claims: claims})
+	}
+	return descriptions, nil
+}
+
+// scopeMappings merges the realm mappings over the default mappings
+func (ce *claimsEngine) scopeMappings(realm string) (map[string]ScopeMapping, error) {
+	realmMappings, err := ce.mappings.GetScopeMappings(realm)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load scope mappings of realm %s: %v", realm, err)
+	}
+	mappings := make(map[string]ScopeMapping, len(DefaultScopeMappings)+len(realmMappings))
+	for _, mapping := range DefaultScopeMappings {
+		mappings[mapping.Scope] = mapping
+	}
+	for _, mapping := range realmMappings {
+		mappings[mapping.Scope] = mapping
+	}
+	return mappings, nil
+}
+
+// mappingOf finds the mapping releasing the claim to the target, looking through the scopes in sorted order
+func mappingOf(mappings map[string]ScopeMapping, claim string, target string) (ClaimMapping, bool) {
+	scopes := make([]string, 0, len(mappings))
+	for scope := range mappings {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		for _, claimMapping := range mappings[scope].Claims {
+			if claimMapping.Claim == claim && claimMapping.appliesTo(target) {
+				return claimMapping, true
+			}
+		}
+	}
+	return ClaimMapping{}, false
+}
+
+func (cm ClaimMapping) appliesTo(target string) bool {
+	if target == TargetIDToken {
+		return cm.IDToken
+	}
+	return cm.UserInfo
+}
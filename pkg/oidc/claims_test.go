@@ -0,0 +1,220 @@
+package oidc
+
+import (
+	"encoding/json"
+	clientDto "github.com/NerdShoreDev/YEP/server/pkg/client/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/consent/dto"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var testUserClaims = StaticUserClaims{
+	"YEP": {
+		"user-1": {
+			"email":          "jane@example.com",
+			"email_verified": true,
+			"name":           "Jane Doe",
+			"department":     "payments",
+			"cost_center":    "4711",
+			"risk_score":     "high",
+		},
+	},
+}
+
+var testScopeMappings = StaticScopeMappings{
+	"YEP": {
+		{Scope: "org", Description: "Read your organisation", Claims: []ClaimMapping{
+			{Claim: "department", Attribute: "department", IDToken: false, UserInfo: true},
+		}},
+		{Scope: "billing", Description: "Read your cost center", Claims: []ClaimMapping{
+			{Claim: "cost_center", Attribute: "cost_center", IDToken: true, UserInfo: true},
+		}},
+	},
+}
+
+func TestClaimsEngine_whenScopeGranted_thenReleaseMappedClaims(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	engine := NewClaimsEngine(testScopeMappings, testUserClaims)
+
+	// act
+	idToken, err := engine.Resolve("YEP", "user-1", []string{"openid", "email", "org"}, nil, TargetIDToken)
+	userInfo, _ := engine.Resolve("YEP", "user-1", []string{"openid", "email", "org"}, nil, TargetUserInfo)
+
+	// assert
+	a.NoError(err)
+	a.Equal(map[string]interface{}{"email": "jane@example.com", "email_verified": true}, idToken)
+	a.Equal("payments", userInfo["department"])
+	a.NotContains(userInfo, "name")
+}
+
+func TestClaimsEngine_whenClaimRequested_thenReleaseMatchingValues(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	engine := NewClaimsEngine(testScopeMappings, testUserClaims)
+	request, err := ParseClaimsRequest(url.Values{"claims": {`{"id_token":{"cost_center":null,"email":{"essential":true,"value":"john@example.com"},"sub":{"value":"x"}}}`}})
+
+	// act
+	claims, _ := engine.Resolve("YEP", "user-1", []string{"openid", "email"}, request.Requested(TargetIDToken), TargetIDToken)
+
+	// assert
+	a.NoError(err)
+	a.Equal(map[string]interface{}{"cost_center": "4711", "email_verified": true}, claims)
+	a.Equal([]string{"cost_center", "email"}, request.Names())
+}
+
+func TestClaimsEngine_whenClaimRequestedWithoutMapping_thenWithhold(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	engine := NewClaimsEngine(testScopeMappings, testUserClaims)
+	request, _ := ParseClaimsRequest(url.Values{"claims": {`{"id_token":{"risk_score":null,"department":null},"userinfo":{"risk_score":null,"department":null}}`}})
+
+	// act
+	idToken, _ := engine.Resolve("YEP", "user-1", []string{"openid"}, request.Requested(TargetIDToken), TargetIDToken)
+	userInfo, _ := engine.Resolve("YEP", "user-1", []string{"openid"}, request.Requested(TargetUserInfo), TargetUserInfo)
+
+	// assert
+	a.Empty(idToken)
+	a.Equal(map[string]interface{}{"department": "payments"}, userInfo)
+}
+
+type staticUsers map[string]*userDto.User
+
+func (s staticUsers) FindUser(realm string, id string) (*userDto.User, error) {
+	return s[id], nil
+}
+
+func TestClaimsEngine_whenBackedByStoredRealmsAndUsers_thenReleaseMappedAttributes(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	realms := staticRealms{"YEP": {Name: "YEP", Enabled: true, ScopeMappings: []realmDto.ScopeMapping{
+		{Scope: "org", Claims: []realmDto.ClaimMapping{{Claim: "department", Attribute: "department", UserInfo: true}, {Claim: "teams", Attribute: "teams", UserInfo: true}}},
+	}}}
+	users := staticUsers{"user-1": {
+		ID:            "user-1",
+		Username:      "jane",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		FirstName:     "Jane",
+		LastName:      "Doe",
+		Attributes:    map[string][]string{"department": {"payments"}, "teams": {"core", "api"}, "email_verified": {"false"}},
+	}}
+	engine := NewClaimsEngine(NewRealmScopeMappings(realms), NewUserClaims(users))
+
+	// act
+	claims, err := engine.Resolve("YEP", "user-1", []string{"openid", "email", "profile", "org"}, nil, TargetUserInfo)
+
+	// assert
+	a.NoError(err)
+	a.Equal(map[string]interface{}{
+		"email":              "jane@example.com",
+		"email_verified":     true,
+		"preferred_username": "jane",
+		"given_name":         "Jane",
+		"family_name":        "Doe",
+		"name":               "Jane Doe",
+		"department":         "payments",
+		"teams":              []string{"core", "api"},
+	}, claims)
+}
+
+func TestValidateScopeMappings(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	valid := []realmDto.ScopeMapping{{Scope: "org", Claims: []realmDto.ClaimMapping{{Claim: "department", Attribute: "department", IDToken: true}}}}
+	twice := append(valid, valid[0])
+	protocol := []realmDto.ScopeMapping{{Scope: "org", Claims: []realmDto.ClaimMapping{{Claim: "sub", Attribute: "id", IDToken: true}}}}
+	unreleased := []realmDto.ScopeMapping{{Scope: "org", Claims: []realmDto.ClaimMapping{{Claim: "department", Attribute: "department"}}}}
+
+	// act & assert
+	a.NoError(ValidateScopeMappings(valid))
+	a.EqualError(ValidateScopeMappings(twice), "scope org is mapped twice")
+	a.EqualError(ValidateScopeMappings(protocol), "claim sub of scope org is set by the server and cannot be mapped")
+	a.Error(ValidateScopeMappings(unreleased))
+	a.Error(ValidateScopeMappings([]realmDto.ScopeMapping{{Scope: "two words"}}))
+}
+
+func TestParseAuthorizationRequest_whenACRRequestedAsClaim_thenUseAsACRValues(t *testing.T) {
+	// arrange
+	values := url.Values{"client_id": {"c"}, "response_type": {"code"}, "claims": {`{"id_token":{"acr":{"essential":true,"values":["2"]}}}`}}
+
+	// act
+	request, err := ParseAuthorizationRequest("YEP", values)
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, request.ACRValues)
+}
+
+func TestTokenAndUserInfo_useSameClaimsEngine(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	issuer := newTestIssuer(StaticSigningAlgorithms{})
+	engine := NewClaimsEngine(testScopeMappings, testUserClaims)
+	clients := StaticClients{"YEP": {"app": {ID: "app", Secrets: []clientDto.ClientSecret{{Hash: HashClientSecret("s3cret")}}, RedirectURIs: []string{"https://app.example.com/cb"}, Trusted: true}}}
+	consents := &MockConsentStore{}
+	consents.On("FindConsent", "YEP", "user-1", "app").Return((*dto.Consent)(nil), nil)
+	authorization := NewAuthorizationHandler(clients, consents, staticSession{testSession}, nil, testPages, NewAuthorizationDetailsValidator(paymentTypes), engine, newTestSubjectResolver())
+	tokens := NewTokenHandler(authorization, clients, engine, issuer, newTestSubjectResolver())
+
+	w := httptest.NewRecorder()
+	authorization.Authorize(w, authorizeRequest(url.Values{
+		"response_type": {"code"},
+		"client_id":     {"app"},
+		"redirect_uri":  {"https://app.example.com/cb"},
+		"scope":         {"openid email org"},
+		"nonce":         {"n-0S6"},
+		"claims":        {`{"userinfo":{"cost_center":null}}`},
+	}))
+	location, _ := url.Parse(w.Header().Get("Location"))
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {location.Query().Get("code")}, "redirect_uri": {"https://app.example.com/cb"}}
+	r := httptest.NewRequest(http.MethodPost, "/auth/realm/YEP/protocol/openid-connect/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("app", "s3cret")
+	w = httptest.NewRecorder()
+
+	// act
+	tokens.Token(w, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+	var response TokenResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	r = httptest.NewRequest(http.MethodGet, "/auth/realm/YEP/protocol/openid-connect/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+response.AccessToken)
+	userInfo := httptest.NewRecorder()
+	tokens.UserInfo(userInfo, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+
+	// assert
+	a.Equal(http.StatusOK, w.Code)
+	idToken, err := issuer.parse("YEP", response.IDToken, TokenTypeID)
+	a.NoError(err)
+	a.Equal("https://sso.example.com/auth/realm/YEP", idToken["iss"])
+	a.Equal("user-1", idToken["sub"])
+	a.Equal("n-0S6", idToken["nonce"])
+	a.Equal("jane@example.com", idToken["email"])
+	a.NotContains(idToken, "department")
+	a.Equal(http.StatusOK, userInfo.Code)
+	a.JSONEq(`{"sub":"user-1","email":"jane@example.com","email_verified":true,"department":"payments","cost_center":"4711"}`, userInfo.Body.String())
+}
+
+func TestToken_whenClientSecretWrong_thenFail(t *testing.T) {
+	// arrange
+	clients := StaticClients{"YEP": {"app": {ID: "app", Secrets: []clientDto.ClientSecret{{Hash: HashClientSecret("s3cret")}}}}}
+	tokens := NewTokenHandler(nil, clients, nil, newTestIssuer(StaticSigningAlgorithms{}), nil)
+	form := url.Values{"grant_type": {"authorization_code"}, "client_id": {"app"}, "client_secret": {"wrong"}}
+	r := httptest.NewRequest(http.MethodPost, "/auth/realm/YEP/protocol/openid-connect/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	// act
+	tokens.Token(w, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+
+	// assert
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_client")
+}
@@ -0,0 +1,265 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	clientDto "github.com/NerdShoreDev/YEP/server/pkg/client/dto"
+	"gopkg.in/square/go-jose.v2"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Grant types of the token endpoint
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+)
+
+// Client authentication methods of the token endpoint
+const (
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+	AuthMethodNone              = "none"
+)
+
+// SupportedGrantTypes are the grant types clients can be registered for
+var SupportedGrantTypes = []string{GrantTypeAuthorizationCode}
+
+// Client is a relying party as seen by the protocol endpoints
+type Client struct {
+	ID   string
+	Name string
+	// Public clients cannot keep a secret and only identify themselves
+	Public bool
+	// Secrets of confidential clients, any of them which has not expired authenticates the client
+	Secrets []clientDto.ClientSecret
+	// TokenEndpointAuthMethod restricts confidential clients to one way of presenting the secret, both are allowed when empty
+	TokenEndpointAuthMethod string
+	// GrantTypes the client may use, only the authorization code grant when empty
+	GrantTypes          []string
+	RedirectURIs        []string
+	RedirectURIPatterns []*regexp.Regexp
+	WebOrigins          []string
+	// AccessTokenLifetime and IDTokenLifetime shorten the realm's lifetimes when set
+	AccessTokenLifetime time.Duration
+	IDTokenLifetime     time.Duration
+	// Trusted first-party clients are not asked for user consent
+	Trusted bool
+	// SubjectType is public or pairwise
+	SubjectType         string
+	SectorIdentifierURI string
+	// JWKS holds the public keys the client registered, used to encrypt tokens for it
+	JWKS *jose.JSONWebKeySet
+	// Signing algorithm of ID tokens, the realm's preferred one when empty
+	IDTokenSignedResponseAlg string
+	// Encryption of ID tokens, no encryption when the alg is empty
+	IDTokenEncryptedResponseAlg string
+	IDTokenEncryptedResponseEnc string
+	// Signing and encryption of userinfo responses, plain JSON when both algs are empty
+	UserInfoSignedResponseAlg    string
+	UserInfoEncryptedResponseAlg string
+	UserInfoEncryptedResponseEnc string
+}
+
+// ClientLookup resolves the client of a protocol request
+type ClientLookup interface {
+	GetClient(realm string, clientID string) (*Client, error)
+}
+
+// StaticClients is a ClientLookup keyed by realm and client id
+type StaticClients map[string]map[string]*Client
+
+func (s StaticClients) GetClient(realm string, clientID string) (*Client, error) {
+	client, ok := s[realm][clientID]
+	if !ok {
+		return nil, NewError(ErrorUnauthorizedClient, "unknown client %s", clientID)
+	}
+	return client, nil
+}
+
+// ClientStore looks up a registered client, nil if there is none
+type ClientStore interface {
+	FindClient(realm string, clientID string) (*clientDto.Client, error)
+}
+
+type clientRegistry struct {
+	clients ClientStore
+}
+
+// NewClientRegistry creates the ClientLookup of the registered clients, disabled clients are treated as unknown
+func NewClientRegistry(clients ClientStore) *clientRegistry {
+	return &clientRegistry{clients: clients}
+}
+
+func (cr *clientRegistry) GetClient(realm string, clientID string) (*Client, error) {
+	registered, err := cr.clients.FindClient(realm, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if registered == nil || !registered.Enabled {
+		return nil, NewError(ErrorUnauthorizedClient, "unknown client %s", clientID)
+	}
+	return NewClient(registered)
+}
+
+// NewClient creates the protocol view of a registered client
+func NewClient(registered *clientDto.Client) (*Client, error) {
+	client := &Client{
+		ID:                           registered.ClientID,
+		Name:                         registered.Name,
+		Public:                       registered.Type == clientDto.TypePublic,
+		Secrets:                      registered.Secrets,
+		TokenEndpointAuthMethod:      registered.TokenEndpointAuthMethod,
+		GrantTypes:                   registered.GrantTypes,
+		RedirectURIs:                 registered.RedirectURIs,
+		AccessTokenLifetime:          time.Duration(registered.AccessTokenLifetime) * time.Second,
+		IDTokenLifetime:              time.Duration(registered.IDTokenLifetime) * time.Second,
+		Trusted:                      registered.Trusted,
+		SubjectType:                  registered.SubjectType,
+		SectorIdentifierURI:          registered.SectorIdentifierURI,
+		IDTokenSignedResponseAlg:     registered.IDTokenSignedResponseAlg,
+		IDTokenEncryptedResponseAlg:  registered.IDTokenEncryptedResponseAlg,
+		IDTokenEncryptedResponseEnc:  registered.IDTokenEncryptedResponseEnc,
+		UserInfoSignedResponseAlg:    registered.UserInfoSignedResponseAlg,
+		UserInfoEncryptedResponseAlg: registered.UserInfoEncryptedResponseAlg,
+		UserInfoEncryptedResponseEnc: registered.UserInfoEncryptedResponseEnc,
+	}
+	for _, pattern := range registered.RedirectURIPatterns {
+		compiled, err := CompileRedirectURIPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		client.RedirectURIPatterns = append(client.RedirectURIPatterns, compiled)
+	}
+	for _, origin := range registered.WebOrigins {
+		if origin != "+" {
+			client.WebOrigins = append(client.WebOrigins, origin)
+			continue
+		}
+		for _, redirectURI := range registered.RedirectURIs {
+			if redirectOrigin := originOf(redirectURI); redirectOrigin != "" {
+				client.WebOrigins = append(client.WebOrigins, redirectOrigin)
+			}
+		}
+	}
+	if len(registered.JWKS) > 0 {
+		client.JWKS = &jose.JSONWebKeySet{}
+		if err := json.Unmarshal(registered.JWKS, client.JWKS); err != nil {
+			return nil, fmt.Errorf("invalid JWKS of client %s: %v", registered.ClientID, err)
+		}
+	}
+	return client, nil
+}
+
+// CompileRedirectURIPattern turns a redirect URI pattern into a regular expression matching the whole URI. A * stands
+// for any characters but / ? # @ and :, so it cannot move the match to another host, port or path segment.
+func CompileRedirectURIPattern(pattern string) (*regexp.Regexp, error) {
+	if err := ValidateRedirectURI(strings.ReplaceAll(pattern, "*", "x")); err != nil {
+		return nil, err
+	}
+	if scheme := strings.SplitN(pattern, "://", 2)[0]; strings.Contains(scheme, "*") {
+		return nil, fmt.Errorf("redirect URI pattern %s has a wildcard in the scheme", pattern)
+	}
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.Compile("^" + strings.Join(parts, `[^/?#@:]*`) + "$")
+}
+
+// ValidateRedirectURI checks that the redirect URI is absolute and has neither user info nor fragment (RFC 6749 section 3.1.2)
+func ValidateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || !parsed.IsAbs() || (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host == "" {
+		return fmt.Errorf("redirect URI %s is not absolute", redirectURI)
+	}
+	if parsed.User != nil || parsed.Fragment != "" || strings.Contains(redirectURI, "#") {
+		return fmt.Errorf("redirect URI %s must not have user info or a fragment", redirectURI)
+	}
+	return nil
+}
+
+// AllowsRedirectURI reports whether redirectURI is registered for the client or matches one of its patterns
+func (c *Client) AllowsRedirectURI(redirectURI string) bool {
+	if contains(c.RedirectURIs, redirectURI) {
+		return true
+	}
+	if ValidateRedirectURI(redirectURI) != nil {
+		return false
+	}
+	for _, pattern := range c.RedirectURIPatterns {
+		if pattern.MatchString(redirectURI) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGrantType reports whether the client may use the grant type
+func (c *Client) AllowsGrantType(grantType string) bool {
+	if len(c.GrantTypes) == 0 {
+		return grantType == GrantTypeAuthorizationCode
+	}
+	return contains(c.GrantTypes, grantType)
+}
+
+// AllowsOrigin reports whether browsers may hand the client's token responses to scripts of the origin
+func (c *Client) AllowsOrigin(origin string) bool {
+	return origin != "" && contains(c.WebOrigins, origin)
+}
+
+// VerifySecret compares the secret with the client's secrets which have not expired in constant time
+func (c *Client) VerifySecret(secret string, now time.Time) bool {
+	hash := HashClientSecret(secret)
+	valid := 0
+	for _, stored := range c.Secrets {
+		matches := subtle.ConstantTimeCompare(stored.Hash, hash)
+		if stored.ExpiresAt == nil || now.Before(*stored.ExpiresAt) {
+			valid |= matches
+		}
+	}
+	return valid == 1
+}
+
+// HashClientSecret hashes a client secret for storage. Generated secrets have 256 bits of entropy, so a fast hash suffices.
+func HashClientSecret(secret string) []byte {
+	hash := sha256.Sum256([]byte(secret))
+	return hash[:]
+}
+
+// RotateClientSecret generates a new secret. The newest of the previous secrets stays valid for the grace period,
+// older ones are dropped, so a client has at most two secrets.
+func RotateClientSecret(secrets []clientDto.ClientSecret, gracePeriod time.Duration, now time.Time) (string, []clientDto.ClientSecret, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(random)
+
+	rotated := []clientDto.ClientSecret{{Hash: HashClientSecret(secret), CreatedAt: now}}
+	if len(secrets) > 0 && gracePeriod > 0 {
+		previous := secrets[0]
+		expiresAt := now.Add(gracePeriod)
+		if previous.ExpiresAt == nil || previous.ExpiresAt.After(expiresAt) {
+			previous.ExpiresAt = &expiresAt
+		}
+		if previous.ExpiresAt.After(now) {
+			rotated = append(rotated, previous)
+		}
+	}
+	return secret, rotated, nil
+}
+
+// originOf returns the scheme, host and port of the URL
+func originOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
@@ -0,0 +1,102 @@
+package oidc
+
+import (
+	clientDto "github.com/NerdShoreDev/YEP/server/pkg/client/dto"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type staticClientStore map[string]*clientDto.Client
+
+func (s staticClientStore) FindClient(realm string, clientID string) (*clientDto.Client, error) {
+	return s[realm+"/"+clientID], nil
+}
+
+func TestClientRegistry_whenClientRegistered_thenConvertForProtocolEndpoints(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	registry := NewClientRegistry(staticClientStore{
+		"YEP/app": {
+			Realm:               "YEP",
+			ClientID:            "app",
+			Enabled:             true,
+			Type:                clientDto.TypePublic,
+			RedirectURIs:        []string{"https://app.example.com/cb"},
+			RedirectURIPatterns: []string{"https://*.preview.example.com/cb"},
+			WebOrigins:          []string{"+", "https://other.example.com"},
+			AccessTokenLifetime: 60,
+		},
+		"YEP/disabled": {Realm: "YEP", ClientID: "disabled"},
+	})
+
+	// act
+	client, err := registry.GetClient("YEP", "app")
+	_, disabledErr := registry.GetClient("YEP", "disabled")
+	_, unknownErr := registry.GetClient("other", "app")
+
+	// assert
+	a.NoError(err)
+	a.True(client.Public)
+	a.Equal(time.Minute, client.AccessTokenLifetime)
+	a.Equal([]string{"https://app.example.com", "https://other.example.com"}, client.WebOrigins)
+	a.True(client.AllowsGrantType(GrantTypeAuthorizationCode))
+	a.Error(disabledErr)
+	a.Error(unknownErr)
+}
+
+func TestClient_whenRedirectURIMatchesPattern_thenAllowOnlyWithinSegment(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	pattern, err := CompileRedirectURIPattern("https://*.preview.example.com/cb/*")
+	a.NoError(err)
+	client := &Client{RedirectURIs: []string{"myapp://callback"}, RedirectURIPatterns: []*regexp.Regexp{pattern}}
+
+	// act & assert
+	a.True(client.AllowsRedirectURI("myapp://callback"))
+	a.True(client.AllowsRedirectURI("https://pr-12.preview.example.com/cb/login"))
+	a.False(client.AllowsRedirectURI("https://evil.com/.preview.example.com/cb/login"))
+	a.False(client.AllowsRedirectURI("https://evil.com#.preview.example.com/cb/login"))
+	a.False(client.AllowsRedirectURI("https://a@evil.com:.preview.example.com/cb/x"))
+	a.False(client.AllowsRedirectURI("https://pr-12.preview.example.com/cb/a/b"))
+}
+
+func TestCompileRedirectURIPattern_whenPatternInvalid_thenError(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+
+	// act
+	_, relative := CompileRedirectURIPattern("/cb/*")
+	_, scheme := CompileRedirectURIPattern("http*://app.example.com/cb")
+	_, fragment := CompileRedirectURIPattern("https://app.example.com/cb#*")
+
+	// assert
+	a.Error(relative)
+	a.Error(scheme)
+	a.Error(fragment)
+}
+
+func TestRotateClientSecret_whenRotated_thenPreviousSecretValidDuringGracePeriod(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	now := time.Now()
+	first, secrets, err := RotateClientSecret(nil, 0, now)
+	a.NoError(err)
+
+	// act
+	second, rotated, err := RotateClientSecret(secrets, time.Hour, now)
+	third, again, _ := RotateClientSecret(rotated, time.Hour, now)
+
+	// assert
+	a.NoError(err)
+	a.NotEqual(first, second)
+	client := &Client{Secrets: rotated}
+	a.True(client.VerifySecret(first, now.Add(59*time.Minute)))
+	a.False(client.VerifySecret(first, now.Add(61*time.Minute)))
+	a.True(client.VerifySecret(second, now.Add(24*time.Hour)))
+	a.False(client.VerifySecret("wrong", now))
+	a.Len(again, 2)
+	a.False((&Client{Secrets: again}).VerifySecret(first, now))
+	a.True((&Client{Secrets: again}).VerifySecret(third, now))
+}
@@ -0,0 +1,113 @@
+package oidc
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/consent/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/theme"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// consentPage is the view model of the consent screen
+type consentPage struct {
+	page
+	Interaction          string
+	CSRF                 string
+	ClientName           string
+	Scopes               []consentScope
+	Claims               []string
+	AuthorizationDetails []AuthorizationDetailDescription
+}
+
+type consentScope struct {
+	Name        string
+	Description string
+	Claims      []string
+}
+
+// consentRequired decides whether the user has to be asked for consent
+func consentRequired(request *AuthorizationRequest, client *Client, consent *dto.Consent) bool {
+	if request.HasPrompt("consent") {
+		return true
+	}
+	if client.Trusted {
+		return false
+	}
+	// Authorization details describe one-off permissions like a single payment and are never remembered
+	if len(request.AuthorizationDetails) > 0 {
+		return true
+	}
+	return consent == nil || !consent.Covers(request.Scopes, request.Claims.Names())
+}
+
+// Consent handles the consent screen of the authorization endpoint
+func (ah *authorizationHandler) Consent(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	in, err := ah.currentInteraction(r, realm)
+	if err != nil {
+		ah.renderError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	session, err := ah.sessions.CurrentSession(r, realm)
+	if err != nil || session == nil {
+		ah.renderError(w, r, http.StatusUnauthorized, NewError(ErrorAccessDenied, "login required"))
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		ah.decideConsent(w, r, in, session)
+		return
+	}
+
+	form, err := ah.newConsentPage(r, in)
+	if err != nil {
+		log.Errorf("unable to prepare consent page: %v", err)
+		ah.renderError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	ah.render(w, r, theme.PageConsent, http.StatusOK, form)
+}
+
+func (ah *authorizationHandler) decideConsent(w http.ResponseWriter, r *http.Request, in *interaction, session *Session) {
+	request := in.Request
+	if r.FormValue("decision") != "allow" {
+		ah.interactions.delete(in.ID)
+		redirectError(w, r, request, NewError(ErrorAccessDenied, "consent denied"))
+		return
+	}
+
+	if err := ah.consents.SaveConsent(request.Realm, session.Subject, request.ClientID, request.Scopes, request.Claims.Names()); err != nil {
+		log.Errorf("unable to save consent: %v", err)
+		redirectError(w, r, request, NewError(ErrorServerError, "unable to save consent"))
+		return
+	}
+
+	ah.complete(w, r, in, session)
+}
+
+func (ah *authorizationHandler) newConsentPage(r *http.Request, in *interaction) (*consentPage, error) {
+	details, err := ah.details.Describe(in.Request.Realm, in.Request.AuthorizationDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := ah.claims.ScopeDescriptions(in.Request.Realm, in.Request.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	clientName := in.Client.Name
+	if clientName == "" {
+		clientName = in.Client.ID
+	}
+	return &consentPage{
+		page:                 newPage(r),
+		Interaction:          in.ID,
+		CSRF:                 in.CSRF,
+		ClientName:           clientName,
+		Scopes:               scopes,
+		Claims:               in.Request.Claims.Names(),
+		AuthorizationDetails: details,
+	}, nil
+}
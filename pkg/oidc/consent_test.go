@@ -0,0 +1,198 @@
+package oidc
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/consent/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/theme"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockConsentStore struct {
+	mock.Mock
+}
+
+func (mock *MockConsentStore) FindConsent(realm string, userID string, clientID string) (*dto.Consent, error) {
+	args := mock.Called(realm, userID, clientID)
+	return args.Get(0).(*dto.Consent), args.Error(1)
+}
+
+func (mock *MockConsentStore) SaveConsent(realm string, userID string, clientID string, scopes []string, claims []string) error {
+	args := mock.Called(realm, userID, clientID, scopes, claims)
+	return args.Error(0)
+}
+
+type staticSession struct {
+	session *Session
+}
+
+func (s staticSession) CurrentSession(r *http.Request, realm string) (*Session, error) {
+	return s.session, nil
+}
+
+func (s staticSession) Create(w http.ResponseWriter, session *Session) error {
+	return nil
+}
+
+func (s staticSession) Reauthenticate(session *Session, acr string, authTime time.Time) (*Session, error) {
+	return session, nil
+}
+
+func (s staticSession) Delete(w http.ResponseWriter, session *Session) {
+}
+
+var testPages = theme.NewThemes("")
+
+var testClients = StaticClients{
+	"YEP": {
+		"third-party": {ID: "third-party", Name: "Third Party", RedirectURIs: []string{"https://client.example.com/cb"}},
+		"first-party": {ID: "first-party", RedirectURIs: []string{"https://yep.example.com/cb"}, Trusted: true},
+	},
+}
+
+var testSession = &Session{ID: "session-1", Realm: "YEP", Subject: "user-1", AuthTime: time.Now()}
+
+func newTestAuthorizationHandler(consents ConsentStore) *authorizationHandler {
+	return NewAuthorizationHandler(testClients, consents, staticSession{testSession}, nil, testPages, NewAuthorizationDetailsValidator(paymentTypes), NewClaimsEngine(StaticScopeMappings{}, StaticUserClaims{}), newTestSubjectResolver())
+}
+
+func authorizeRequest(params url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/auth/realm/YEP/protocol/openid-connect/auth?"+params.Encode(), nil)
+	return mux.SetURLVars(r, map[string]string{"realm": "YEP"})
+}
+
+func TestConsentRequired(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	thirdParty := testClients["YEP"]["third-party"]
+	firstParty := testClients["YEP"]["first-party"]
+	request := &AuthorizationRequest{Scopes: []string{"openid", "email"}}
+	promptConsent := &AuthorizationRequest{Scopes: []string{"openid"}, Prompt: []string{"consent"}}
+	granted := &dto.Consent{Scopes: []string{"openid", "email", "profile"}}
+	partial := &dto.Consent{Scopes: []string{"openid"}}
+	claimsRequest, _ := ParseClaimsRequest(url.Values{"claims": {`{"userinfo":{"cost_center":null}}`}})
+	withClaims := &AuthorizationRequest{Scopes: []string{"openid", "email"}, Claims: claimsRequest}
+	grantedClaims := &dto.Consent{Scopes: []string{"openid", "email"}, Claims: []string{"cost_center"}}
+
+	// act & assert
+	a.True(consentRequired(request, thirdParty, nil))
+	a.True(consentRequired(request, thirdParty, partial))
+	a.False(consentRequired(request, thirdParty, granted))
+	a.False(consentRequired(request, firstParty, nil))
+	a.True(consentRequired(promptConsent, thirdParty, granted))
+	a.True(consentRequired(promptConsent, firstParty, granted))
+	a.True(consentRequired(withClaims, thirdParty, granted))
+	a.False(consentRequired(withClaims, thirdParty, grantedClaims))
+}
+
+func TestAuthorize_whenConsentMissing_thenRedirectToConsent(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	consents := &MockConsentStore{}
+	consents.On("FindConsent", "YEP", "user-1", "third-party").Return((*dto.Consent)(nil), nil)
+	handler := newTestAuthorizationHandler(consents)
+	w := httptest.NewRecorder()
+
+	// act
+	handler.Authorize(w, authorizeRequest(url.Values{
+		"response_type": {"code"},
+		"client_id":     {"third-party"},
+		"redirect_uri":  {"https://client.example.com/cb"},
+		"scope":         {"openid email"},
+	}))
+
+	// assert
+	consents.AssertExpectations(t)
+	a.Equal(http.StatusFound, w.Code)
+	a.True(strings.HasPrefix(w.Header().Get("Location"), "/auth/realm/YEP/protocol/openid-connect/consent?interaction="))
+}
+
+func TestAuthorize_whenClientTrusted_thenIssueCode(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	consents := &MockConsentStore{}
+	consents.On("FindConsent", "YEP", "user-1", "first-party").Return((*dto.Consent)(nil), nil)
+	handler := newTestAuthorizationHandler(consents)
+	w := httptest.NewRecorder()
+
+	// act
+	handler.Authorize(w, authorizeRequest(url.Values{
+		"response_type": {"code"},
+		"client_id":     {"first-party"},
+		"redirect_uri":  {"https://yep.example.com/cb"},
+		"scope":         {"openid"},
+		"state":         {"xyz"},
+	}))
+
+	// assert
+	a.Equal(http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	a.Equal("yep.example.com", location.Host)
+	a.Equal("xyz", location.Query().Get("state"))
+	grant, ok := handler.RedeemCode(location.Query().Get("code"))
+	a.True(ok)
+	a.Equal("user-1", grant.Subject)
+	_, ok = handler.RedeemCode(location.Query().Get("code"))
+	a.False(ok)
+}
+
+func TestAuthorize_whenRedirectURINotRegistered_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	handler := newTestAuthorizationHandler(&MockConsentStore{})
+	w := httptest.NewRecorder()
+
+	// act
+	handler.Authorize(w, authorizeRequest(url.Values{
+		"response_type": {"code"},
+		"client_id":     {"third-party"},
+		"redirect_uri":  {"https://evil.example.com/cb"},
+	}))
+
+	// assert
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Contains(w.Body.String(), "redirect_uri not registered")
+}
+
+func TestConsent_whenAllowed_thenSaveConsentAndIssueCode(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	consents := &MockConsentStore{}
+	consents.On("FindConsent", "YEP", "user-1", "third-party").Return((*dto.Consent)(nil), nil)
+	consents.On("SaveConsent", "YEP", "user-1", "third-party", []string{"openid", "email"}, []string(nil)).Return(nil)
+	handler := newTestAuthorizationHandler(consents)
+	w := httptest.NewRecorder()
+	handler.Authorize(w, authorizeRequest(url.Values{
+		"response_type": {"code"},
+		"client_id":     {"third-party"},
+		"redirect_uri":  {"https://client.example.com/cb"},
+		"scope":         {"openid email"},
+	}))
+	consentURL, _ := url.Parse(w.Header().Get("Location"))
+	interactionID := consentURL.Query().Get("interaction")
+	browser := browserCookie(w)
+
+	r := httptest.NewRequest(http.MethodGet, consentURL.String(), nil)
+	r.AddCookie(browser)
+	page := httptest.NewRecorder()
+	handler.Consent(page, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+	form := url.Values{"interaction": {interactionID}, "csrf": {hiddenField(page.Body.String(), "csrf")}, "decision": {"allow"}}
+
+	// act
+	w = post(handler.Consent, consentURL.Path, form, "10.0.0.1:4711", browser)
+
+	// assert
+	consents.AssertExpectations(t)
+	a.Equal(http.StatusOK, page.Code)
+	a.Contains(page.Body.String(), "Third Party wants to access your account")
+	a.Contains(page.Body.String(), "Read your email address (email, email_verified)")
+	a.Equal(http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	a.NotEmpty(location.Query().Get("code"))
+}
@@ -0,0 +1,59 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// browserCookiePrefix names the cookie binding interactions to the browser which started them
+const browserCookiePrefix = "YEP_BROWSER_"
+
+// bindToBrowser ties the interaction to the browser of the request and gives it the CSRF token of its forms. Browsers
+// keep their cookie for further interactions, so authorization requests in several tabs do not replace each other.
+func bindToBrowser(w http.ResponseWriter, r *http.Request, in *interaction) error {
+	name := browserCookiePrefix + in.Request.Realm
+	if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+		in.Browser = cookie.Value
+	} else {
+		browser, err := randomToken()
+		if err != nil {
+			return err
+		}
+		in.Browser = browser
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    browser,
+			Path:     realmPath(in.Request.Realm),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return err
+	}
+	in.CSRF = csrf
+	return nil
+}
+
+// currentInteraction returns the interaction of a login or consent request. Only the browser which started it may
+// continue it, and posted forms have to carry its CSRF token, so other sites cannot submit them for the user.
+func (ah *authorizationHandler) currentInteraction(r *http.Request, realm string) (*interaction, error) {
+	in, ok := ah.lookupInteraction(r.FormValue("interaction"))
+	if !ok || in.Request.Realm != realm {
+		return nil, NewError(ErrorInvalidRequest, "unknown or expired authorization request, go back to the application and try again")
+	}
+	cookie, err := r.Cookie(browserCookiePrefix + realm)
+	if err != nil || !equalTokens(cookie.Value, in.Browser) {
+		return nil, NewError(ErrorInvalidRequest, "the authorization request was started in another browser, go back to the application and try again")
+	}
+	if r.Method == http.MethodPost && !equalTokens(r.PostFormValue("csrf"), in.CSRF) {
+		return nil, NewError(ErrorInvalidRequest, "the form has expired, go back to the application and try again")
+	}
+	return in, nil
+}
+
+func equalTokens(given string, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
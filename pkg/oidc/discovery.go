@@ -0,0 +1,89 @@
+package oidc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// ProviderMetadata is the OpenID Connect discovery document of a realm
+type ProviderMetadata struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	PushedAuthorizationEndpoint      string   `json:"pushed_authorization_request_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	ResponseModesSupported           []string `json:"response_modes_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	IDTokenEncryptionAlgValues       []string `json:"id_token_encryption_alg_values_supported"`
+	IDTokenEncryptionEncValues       []string `json:"id_token_encryption_enc_values_supported"`
+	UserInfoSigningAlgValues         []string `json:"userinfo_signing_alg_values_supported"`
+	UserInfoEncryptionAlgValues      []string `json:"userinfo_encryption_alg_values_supported"`
+	UserInfoEncryptionEncValues      []string `json:"userinfo_encryption_enc_values_supported"`
+	TokenEndpointAuthMethods         []string `json:"token_endpoint_auth_methods_supported"`
+	ClaimsParameterSupported         bool     `json:"claims_parameter_supported"`
+	PromptValuesSupported            []string `json:"prompt_values_supported"`
+	ACRValuesSupported               []string `json:"acr_values_supported"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported"`
+}
+
+// Discovery handles the OpenID Connect discovery endpoint
+func (th *tokenHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	issuer := th.issuer.Issuer(realm)
+	algorithms, err := th.issuer.keys.Algorithms(realm)
+	if err != nil {
+		log.Errorf("unable to read signing algorithms of realm %s: %v", realm, err)
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	endpoint := func(name string) string {
+		return issuer + "/protocol/openid-connect/" + name
+	}
+
+	metadata := &ProviderMetadata{
+		Issuer:                           issuer,
+		AuthorizationEndpoint:            endpoint("auth"),
+		PushedAuthorizationEndpoint:      endpoint("par"),
+		TokenEndpoint:                    endpoint("token"),
+		UserInfoEndpoint:                 endpoint("userinfo"),
+		IntrospectionEndpoint:            endpoint("token/introspect"),
+		JWKSURI:                          endpoint("certs"),
+		GrantTypesSupported:              SupportedGrantTypes,
+		ResponseTypesSupported:           []string{"code"},
+		ResponseModesSupported:           []string{"query"},
+		SubjectTypesSupported:            []string{SubjectTypePublic, SubjectTypePairwise},
+		IDTokenSigningAlgValuesSupported: algorithms,
+		IDTokenEncryptionAlgValues:       supportedKeyAlgorithms,
+		IDTokenEncryptionEncValues:       supportedContentEncryptions,
+		UserInfoSigningAlgValues:         algorithms,
+		UserInfoEncryptionAlgValues:      supportedKeyAlgorithms,
+		UserInfoEncryptionEncValues:      supportedContentEncryptions,
+		TokenEndpointAuthMethods:         []string{AuthMethodClientSecretBasic, AuthMethodClientSecretPost, AuthMethodNone},
+		ClaimsParameterSupported:         true,
+		PromptValuesSupported:            []string{"none", "login", "consent", "select_account"},
+		ACRValuesSupported:               []string{passwordACR},
+		CodeChallengeMethodsSupported:    []string{CodeChallengeMethodS256},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metadata)
+}
+
+// Certs handles the JWKS endpoint publishing the active and passive signing keys of the realm
+func (th *tokenHandler) Certs(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	jwks, err := th.issuer.keys.PublicKeys(realm)
+	if err != nil {
+		log.Errorf("unable to read signing keys of realm %s: %v", realm, err)
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jwks)
+}
@@ -0,0 +1,91 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// Key management algorithms clients may choose for encrypted ID tokens and userinfo responses
+var supportedKeyAlgorithms = []string{
+	string(jose.RSA_OAEP),
+	string(jose.RSA_OAEP_256),
+	string(jose.ECDH_ES),
+	string(jose.ECDH_ES_A128KW),
+	string(jose.ECDH_ES_A256KW),
+}
+
+// Content encryption algorithms clients may choose for encrypted ID tokens and userinfo responses
+var supportedContentEncryptions = []string{
+	string(jose.A128CBC_HS256),
+	string(jose.A256CBC_HS512),
+	string(jose.A128GCM),
+	string(jose.A256GCM),
+}
+
+// defaultContentEncryption applies when a client registered an alg without an enc (OpenID Connect Registration 2)
+const defaultContentEncryption = string(jose.A128CBC_HS256)
+
+// encrypt wraps the payload into a compact JWE for the client's registered encryption key.
+// Nested JWTs carry the content type JWT so clients know to verify the signature inside.
+func encrypt(client *Client, alg string, enc string, payload []byte, nested bool) (string, error) {
+	if enc == "" {
+		enc = defaultContentEncryption
+	}
+	if !contains(supportedKeyAlgorithms, alg) {
+		return "", fmt.Errorf("unsupported key management algorithm %s for client %s", alg, client.ID)
+	}
+	if !contains(supportedContentEncryptions, enc) {
+		return "", fmt.Errorf("unsupported content encryption %s for client %s", enc, client.ID)
+	}
+	key, err := encryptionKey(client, alg)
+	if err != nil {
+		return "", err
+	}
+
+	options := &jose.EncrypterOptions{}
+	if nested {
+		options = options.WithContentType("JWT")
+	}
+	encrypter, err := jose.NewEncrypter(jose.ContentEncryption(enc), jose.Recipient{
+		Algorithm: jose.KeyAlgorithm(alg),
+		Key:       key.Key,
+		KeyID:     key.KeyID,
+	}, options)
+	if err != nil {
+		return "", err
+	}
+	object, err := encrypter.Encrypt(payload)
+	if err != nil {
+		return "", err
+	}
+	return object.CompactSerialize()
+}
+
+// encryptionKey picks the first key of the client's JWKS meant for encryption that fits the algorithm
+func encryptionKey(client *Client, alg string) (*jose.JSONWebKey, error) {
+	if client.JWKS == nil {
+		return nil, fmt.Errorf("client %s has no registered JWKS", client.ID)
+	}
+	for i := range client.JWKS.Keys {
+		key := &client.JWKS.Keys[i]
+		if key.Use != "" && key.Use != "enc" {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != alg {
+			continue
+		}
+		switch key.Key.(type) {
+		case *rsa.PublicKey:
+			if alg == string(jose.RSA_OAEP) || alg == string(jose.RSA_OAEP_256) {
+				return key, nil
+			}
+		case *ecdsa.PublicKey:
+			if alg != string(jose.RSA_OAEP) && alg != string(jose.RSA_OAEP_256) {
+				return key, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("client %s has no encryption key for %s", client.ID, alg)
+}
@@ -0,0 +1,86 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEncrypt_whenClientHasRSAKey_thenDecryptableNestedJWT(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	client := &Client{ID: "app", JWKS: &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &key.PublicKey, KeyID: "enc-1", Use: "enc"},
+	}}}
+
+	// act
+	encrypted, err := encrypt(client, "RSA-OAEP", "", []byte("header.payload.signature"), true)
+
+	// assert
+	a.NoError(err)
+	object, err := jose.ParseEncrypted(encrypted)
+	a.NoError(err)
+	a.Equal("enc-1", object.Header.KeyID)
+	a.Equal("JWT", object.Header.ExtraHeaders[jose.HeaderContentType])
+	plaintext, err := object.Decrypt(key)
+	a.NoError(err)
+	a.Equal("header.payload.signature", string(plaintext))
+}
+
+func TestEncrypt_whenNoKeyFitsAlgorithm_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	signingOnly := &Client{ID: "app", JWKS: &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, Use: "sig"}}}}
+	rsaOnly := &Client{ID: "app", JWKS: &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey}}}}
+
+	// act
+	_, signingErr := encrypt(signingOnly, "RSA-OAEP", "A128GCM", []byte("payload"), false)
+	_, curveErr := encrypt(rsaOnly, "ECDH-ES", "A128GCM", []byte("payload"), false)
+	_, withoutJWKSErr := encrypt(&Client{ID: "app"}, "RSA-OAEP", "A128GCM", []byte("payload"), false)
+
+	// assert
+	a.Error(signingErr)
+	a.Error(curveErr)
+	a.Error(withoutJWKSErr)
+}
+
+func TestUserInfo_whenClientRegisteredEncryption_thenRespondWithJWT(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	issuer := newTestIssuer(StaticSigningAlgorithms{})
+	clients := StaticClients{"YEP": {"app": {ID: "app", JWKS: &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &clientKey.PublicKey}}},
+		UserInfoSignedResponseAlg: "RS256", UserInfoEncryptedResponseAlg: "ECDH-ES", UserInfoEncryptedResponseEnc: "A256GCM"}}}
+	tokens := NewTokenHandler(nil, clients, NewClaimsEngine(testScopeMappings, testUserClaims), issuer, newTestSubjectResolver())
+	accessToken, _ := issuer.sign("YEP", jwt.MapClaims{"iss": issuer.Issuer("YEP"), "sub": "user-1", "azp": "app", "typ": TokenTypeBearer, "scope": "openid email"})
+	r := httptest.NewRequest(http.MethodGet, "/auth/realm/YEP/protocol/openid-connect/userinfo", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+
+	// act
+	tokens.UserInfo(w, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+
+	// assert
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("application/jwt", w.Header().Get("Content-Type"))
+	object, err := jose.ParseEncrypted(w.Body.String())
+	a.NoError(err)
+	signed, err := object.Decrypt(clientKey)
+	a.NoError(err)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(string(signed), claims, issuer.verificationKey("YEP"))
+	a.NoError(err)
+	a.Equal("user-1", claims["sub"])
+	a.Equal("app", claims["aud"])
+	a.Equal("jane@example.com", claims["email"])
+}
@@ -0,0 +1,62 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// OAuth 2.0 and OpenID Connect error codes
+const (
+	ErrorInvalidRequest              = "invalid_request"
+	ErrorInvalidClient               = "invalid_client"
+	ErrorUnsupportedGrantType        = "unsupported_grant_type"
+	ErrorInvalidScope                = "invalid_scope"
+	ErrorInvalidGrant                = "invalid_grant"
+	ErrorUnauthorizedClient          = "unauthorized_client"
+	ErrorAccessDenied                = "access_denied"
+	ErrorUnsupportedResponseType     = "unsupported_response_type"
+	ErrorServerError                 = "server_error"
+	ErrorInvalidAuthorizationDetails = "invalid_authorization_details"
+	ErrorLoginRequired               = "login_required"
+	ErrorConsentRequired             = "consent_required"
+	ErrorInteractionRequired         = "interaction_required"
+	ErrorInvalidRequestURI           = "invalid_request_uri"
+	// ErrorUnmetAuthenticationRequirements tells the client that none of its acr_values could be met
+	ErrorUnmetAuthenticationRequirements = "unmet_authentication_requirements"
+)
+
+// Error is an OAuth 2.0 error response
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	State       string `json:"state,omitempty"`
+}
+
+// NewError creates an OAuth 2.0 error with a formatted description
+func NewError(code string, format string, args ...interface{}) *Error {
+	return &Error{
+		Code:        code,
+		Description: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// WriteError writes err as JSON error response. Errors which are not OAuth 2.0 errors are reported as server_error.
+func WriteError(w http.ResponseWriter, status int, err error) {
+	oauthErr, ok := err.(*Error)
+	if !ok {
+		oauthErr = &Error{Code: ErrorServerError}
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(oauthErr)
+}
@@ -0,0 +1,110 @@
+package oidc
+
+import (
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// IntrospectionResponse is the token introspection response (RFC 7662)
+type IntrospectionResponse struct {
+	Active               bool                 `json:"active"`
+	Scope                string               `json:"scope,omitempty"`
+	ClientID             string               `json:"client_id,omitempty"`
+	Username             string               `json:"username,omitempty"`
+	TokenType            string               `json:"token_type,omitempty"`
+	Exp                  int64                `json:"exp,omitempty"`
+	Iat                  int64                `json:"iat,omitempty"`
+	Nbf                  int64                `json:"nbf,omitempty"`
+	Sub                  string               `json:"sub,omitempty"`
+	Aud                  interface{}          `json:"aud,omitempty"`
+	Iss                  string               `json:"iss,omitempty"`
+	Jti                  string               `json:"jti,omitempty"`
+	AuthorizationDetails AuthorizationDetails `json:"authorization_details,omitempty"`
+}
+
+// NewIntrospectionResponse describes an active token by its validated claims
+func NewIntrospectionResponse(claims jwt.MapClaims) (*IntrospectionResponse, error) {
+	details, err := AuthorizationDetailsFromClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IntrospectionResponse{
+		Active:               true,
+		Scope:                stringClaim(claims, "scope"),
+		ClientID:             stringClaim(claims, "azp"),
+		Username:             stringClaim(claims, "preferred_username"),
+		TokenType:            stringClaim(claims, "typ"),
+		Exp:                  int64Claim(claims, "exp"),
+		Iat:                  int64Claim(claims, "iat"),
+		Nbf:                  int64Claim(claims, "nbf"),
+		Sub:                  stringClaim(claims, "sub"),
+		Aud:                  claims["aud"],
+		Iss:                  stringClaim(claims, "iss"),
+		Jti:                  stringClaim(claims, "jti"),
+		AuthorizationDetails: details,
+	}, nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func int64Claim(claims jwt.MapClaims, name string) int64 {
+	switch value := claims[name].(type) {
+	case float64:
+		return int64(value)
+	case int64:
+		return value
+	case int:
+		return int64(value)
+	}
+	return 0
+}
+
+// Introspect handles the token introspection endpoint for authenticated clients
+func (th *tokenHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	if err := r.ParseForm(); err != nil {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidRequest, "malformed request"))
+		return
+	}
+	// Public clients cannot prove who they are, so they may not learn about tokens
+	if client, err := authenticateClient(th.clients, realm, r); err != nil || client.Public {
+		log.Debugf("Introspect: client authentication failed: %v", err)
+		WriteError(w, http.StatusUnauthorized, NewError(ErrorInvalidClient, "client authentication failed"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	claims, err := th.issuer.parse(realm, r.PostForm.Get("token"), TokenTypeBearer)
+	if err != nil {
+		log.Debugf("Introspect: inactive token: %v", err)
+		json.NewEncoder(w).Encode(&IntrospectionResponse{Active: false})
+		return
+	}
+	response, err := NewIntrospectionResponse(claims)
+	if err != nil {
+		log.Errorf("unable to describe token: %v", err)
+		json.NewEncoder(w).Encode(&IntrospectionResponse{Active: false})
+		return
+	}
+
+	// The token carries the subject the client sees, the username belongs to the user behind it
+	localSubject, err := th.subjects.LocalSubject(realm, response.Sub)
+	if err != nil {
+		log.Errorf("unable to resolve subject: %v", err)
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if attributes, err := th.claims.users.GetUserClaims(realm, localSubject); err == nil {
+		response.Username, _ = attributes["preferred_username"].(string)
+	}
+	json.NewEncoder(w).Encode(response)
+}
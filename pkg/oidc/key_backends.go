@@ -0,0 +1,181 @@
+package oidc
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	"github.com/NerdShoreDev/YEP/server/pkg/envelope"
+	keyDto "github.com/NerdShoreDev/YEP/server/pkg/key/dto"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// KeyBackend creates the signers of realm keys and restores them from their stored form
+type KeyBackend interface {
+	// Generate creates a key and describes it for storage. Realm, status and creation time are up to the caller.
+	Generate(algorithm string) (auth.Signer, *keyDto.SigningKey, error)
+	// Import describes a key loaded from a file for storage
+	Import(signer auth.Signer) (*keyDto.SigningKey, error)
+	Restore(stored *keyDto.SigningKey) (auth.Signer, error)
+	// Destroy drops the private key of a retired key
+	Destroy(stored *keyDto.SigningKey) error
+}
+
+// KeyWrapper seals private keys with the key encryption key before they are stored
+type KeyWrapper interface {
+	ActiveKekID() string
+	Seal(plaintext []byte) (*envelope.Envelope, error)
+	Open(envelope *envelope.Envelope) ([]byte, error)
+	Rewrap(envelope *envelope.Envelope) (*envelope.Envelope, bool, error)
+}
+
+// SigningService creates and uses keys that never leave a remote signing service
+type SigningService interface {
+	CreateKey(algorithm string) (auth.RemoteSigner, error)
+	Signer(remoteID string, algorithm string, public crypto.PublicKey) (auth.RemoteSigner, error)
+	DeleteKey(remoteID string) error
+}
+
+// privateKeyMarshaler is implemented by signers holding their private key in memory
+type privateKeyMarshaler interface {
+	MarshalPrivateKey() ([]byte, error)
+}
+
+type localKeyBackend struct {
+	wrapper KeyWrapper
+}
+
+// NewLocalKeyBackend creates the backend generating keys in process and storing them sealed with the KEK
+func NewLocalKeyBackend(wrapper KeyWrapper) *localKeyBackend {
+	return &localKeyBackend{wrapper: wrapper}
+}
+
+func (lb *localKeyBackend) Generate(algorithm string) (auth.Signer, *keyDto.SigningKey, error) {
+	signer, err := auth.GenerateLocalSigner(algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	stored, err := lb.Import(signer)
+	return signer, stored, err
+}
+
+func (lb *localKeyBackend) Import(signer auth.Signer) (*keyDto.SigningKey, error) {
+	local, ok := signer.(privateKeyMarshaler)
+	if !ok {
+		return nil, errors.New("only keys held in memory can be imported")
+	}
+	der, err := local.MarshalPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := lb.wrapper.Seal(der)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := describeKey(signer, keyDto.BackendLocal)
+	if err != nil {
+		return nil, err
+	}
+	stored.PrivateKey = sealed
+	return stored, nil
+}
+
+func (lb *localKeyBackend) Restore(stored *keyDto.SigningKey) (auth.Signer, error) {
+	der, err := lb.wrapper.Open(stored.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open signing key %s: %v", stored.Kid, err)
+	}
+	return auth.ParseLocalSigner(der, stored.Algorithm)
+}
+
+func (lb *localKeyBackend) Destroy(stored *keyDto.SigningKey) error {
+	// the key store drops the sealed private key of retired keys
+	return nil
+}
+
+// RewrapKeys seals the stored private keys again with the active key encryption key after a KEK rotation.
+// The previous KEK must stay configured until this has finished, keys are readable with either meanwhile.
+func (lb *localKeyBackend) RewrapKeys(store KeyStore) error {
+	keys, err := store.FindKeysToRewrap(lb.wrapper.ActiveKekID())
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		rewrapped, changed, err := lb.wrapper.Rewrap(key.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("unable to rewrap signing key %s: %v", key.Kid, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := store.UpdatePrivateKey(key.Realm, key.Kid, key.PrivateKey.KekID, rewrapped); err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		log.Infof("Rewrapped %d signing keys with key encryption key %s", len(keys), lb.wrapper.ActiveKekID())
+	}
+	return nil
+}
+
+type remoteKeyBackend struct {
+	service SigningService
+}
+
+// NewRemoteKeyBackend creates the backend keeping the private keys in a remote signing service
+func NewRemoteKeyBackend(service SigningService) *remoteKeyBackend {
+	return &remoteKeyBackend{service: service}
+}
+
+func (rb *remoteKeyBackend) Generate(algorithm string) (auth.Signer, *keyDto.SigningKey, error) {
+	signer, err := rb.service.CreateKey(algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	stored, err := describeKey(signer, keyDto.BackendRemote)
+	if err != nil {
+		return nil, nil, err
+	}
+	stored.RemoteKeyID = signer.RemoteID()
+	return signer, stored, nil
+}
+
+func (rb *remoteKeyBackend) Import(signer auth.Signer) (*keyDto.SigningKey, error) {
+	return nil, errors.New("keys cannot be imported into the remote signing service")
+}
+
+func (rb *remoteKeyBackend) Restore(stored *keyDto.SigningKey) (auth.Signer, error) {
+	public, err := storedPublicKey(stored)
+	if err != nil {
+		return nil, err
+	}
+	return rb.service.Signer(stored.RemoteKeyID, stored.Algorithm, public)
+}
+
+func (rb *remoteKeyBackend) Destroy(stored *keyDto.SigningKey) error {
+	return rb.service.DeleteKey(stored.RemoteKeyID)
+}
+
+// describeKey fills the backend independent fields of a key to be stored
+func describeKey(signer auth.Signer, backend string) (*keyDto.SigningKey, error) {
+	publicKey, err := json.Marshal(jose.JSONWebKey{Key: signer.Public(), KeyID: signer.KeyID(), Algorithm: signer.Algorithm(), Use: "sig"})
+	if err != nil {
+		return nil, err
+	}
+	return &keyDto.SigningKey{
+		Kid:       signer.KeyID(),
+		Algorithm: signer.Algorithm(),
+		Backend:   backend,
+		PublicKey: publicKey,
+	}, nil
+}
+
+func storedPublicKey(stored *keyDto.SigningKey) (crypto.PublicKey, error) {
+	var jwk jose.JSONWebKey
+	if err := json.Unmarshal(stored.PublicKey, &jwk); err != nil {
+		return nil, fmt.Errorf("malformed public key of signing key %s: %v", stored.Kid, err)
+	}
+	return jwk.Key, nil
+}
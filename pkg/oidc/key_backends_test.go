@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth/authtest"
+	"github.com/NerdShoreDev/YEP/server/pkg/key/dto"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestKeyManager_whenRemoteBackend_thenSignRotateAndPublish(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	service := authtest.NewSigningService()
+	defer service.Close()
+	store := newMemoryKeyStore()
+	backend := NewRemoteKeyBackend(auth.NewRemoteSigningService(http.DefaultClient, service.URL, "test-token"))
+	keys := NewKeyManager(store, backend, StaticSigningAlgorithms{"YEP": {"ES256"}}, time.Hour, -time.Second)
+	issuer := NewTokenIssuer("https://sso.example.com", keys, time.Minute, time.Minute)
+	token, signErr := issuer.sign("YEP", jwt.MapClaims{"iss": issuer.Issuer("YEP"), "typ": TokenTypeBearer})
+	oldKey, _ := keys.ActiveKey("YEP", "ES256")
+	// a second instance restores the key from the store
+	restarted := NewTokenIssuer("https://sso.example.com", NewKeyManager(store, backend, StaticSigningAlgorithms{"YEP": {"ES256"}}, time.Hour, time.Hour), time.Minute, time.Minute)
+
+	// act
+	_, parseErr := restarted.parse("YEP", token, TokenTypeBearer)
+	rotateErr := keys.Rotate("YEP")
+	published, _ := keys.PublicKeys("YEP")
+	dueErr := keys.RotateDue()
+
+	// assert
+	a.NoError(signErr)
+	a.NoError(parseErr)
+	a.NoError(rotateErr)
+	a.Len(published.Keys, 2)
+	a.NoError(dueErr)
+	a.Equal(dto.StatusRetired, store.status(oldKey.KeyID()))
+	a.Equal(1, service.KeyCount())
+	a.Empty(store.keys[0].PrivateKey)
+	a.Equal(dto.BackendRemote, store.keys[0].Backend)
+}
+
+func TestKeyManager_whenKeyImported_thenItSignsAndImportIsIdempotent(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	store := newMemoryKeyStore()
+	keys := NewKeyManager(store, NewLocalKeyBackend(newTestKeyWrapper(testKEK)), StaticSigningAlgorithms{}, time.Hour, time.Hour)
+	generated, _ := keys.ActiveKey("YEP", "RS256")
+	imported, _ := auth.GenerateLocalSigner("RS256")
+
+	// act
+	err := keys.ImportKey("YEP", imported)
+	againErr := keys.ImportKey("YEP", imported)
+	active, _ := keys.ActiveKey("YEP", "RS256")
+
+	// assert
+	a.NoError(err)
+	a.NoError(againErr)
+	a.Equal(imported.KeyID(), active.KeyID())
+	a.Equal(dto.StatusPassive, store.status(generated.KeyID()))
+	a.Len(store.keys, 2)
+}
+
+func TestRemoteKeyBackend_whenImporting_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	backend := NewRemoteKeyBackend(auth.NewRemoteSigningService(http.DefaultClient, "http://localhost", ""))
+	signer, _ := auth.GenerateLocalSigner("ES256")
+
+	// act
+	_, err := backend.Import(signer)
+
+	// assert
+	a.Error(err)
+}
@@ -0,0 +1,352 @@
+package oidc
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	"github.com/NerdShoreDev/YEP/server/pkg/envelope"
+	keyDto "github.com/NerdShoreDev/YEP/server/pkg/key/dto"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/square/go-jose.v2"
+	"sync"
+	"time"
+)
+
+// ErrKeyNotFound is returned when revoking a key the realm does not have
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// KeyStore persists the signing keys of the realms
+type KeyStore interface {
+	FindKeys(realm string) ([]*keyDto.SigningKey, error)
+	FindKey(realm string, kid string) (*keyDto.SigningKey, error)
+	FindRealms() ([]string, error)
+	SaveKey(key *keyDto.SigningKey) error
+	UpdateKeyStatus(realm string, kid string, status string, retireAt *time.Time) error
+	FindKeysToRewrap(kekID string) ([]*keyDto.SigningKey, error)
+	UpdatePrivateKey(realm string, kid string, previousKekID string, privateKey *envelope.Envelope) error
+}
+
+type keyManager struct {
+	store          KeyStore
+	backend        KeyBackend
+	algorithms     SigningAlgorithmSource
+	rotationPeriod time.Duration
+	retention      time.Duration
+	// mutex serialises key generation so concurrent requests do not create several active keys
+	mutex   sync.Mutex
+	signers sync.Map
+}
+
+// NewKeyManager creates the manager generating and rotating realm signing keys.
+// Active keys are replaced after the rotation period, replaced keys stay published for the retention, which must cover the longest token lifetime.
+func NewKeyManager(store KeyStore, backend KeyBackend, algorithms SigningAlgorithmSource, rotationPeriod time.Duration, retention time.Duration) *keyManager {
+	return &keyManager{
+		store:          store,
+		backend:        backend,
+		algorithms:     algorithms,
+		rotationPeriod: rotationPeriod,
+		retention:      retention,
+	}
+}
+
+// Algorithms returns the signing algorithms of the realm allowlist that keys can be generated for
+func (km *keyManager) Algorithms(realm string) ([]string, error) {
+	allowed, err := km.algorithms.GetSigningAlgorithms(realm)
+	if err != nil {
+		return nil, err
+	}
+	algorithms := []string{}
+	for _, algorithm := range allowed {
+		if contains(supportedSigningAlgorithms, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	return algorithms, nil
+}
+
+// ActiveKey returns the key signing new tokens of the realm with the algorithm, generating the first one on demand
+func (km *keyManager) ActiveKey(realm string, algorithm string) (auth.Signer, error) {
+	if key, err := km.findActiveKey(realm, algorithm); key != nil || err != nil {
+		return key, err
+	}
+
+	km.mutex.Lock()
+	defer km.mutex.Unlock()
+	if key, err := km.findActiveKey(realm, algorithm); key != nil || err != nil {
+		return key, err
+	}
+	return km.generate(realm, algorithm)
+}
+
+// VerificationKey returns an active or passive key of the realm
+func (km *keyManager) VerificationKey(realm string, kid string) (auth.Signer, error) {
+	keys, err := km.store.FindKeys(realm)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Kid == kid {
+			return km.signer(key)
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %s", kid)
+}
+
+// PublicKeys returns the JWKS of the realm, holding its active and passive keys
+func (km *keyManager) PublicKeys(realm string) (*jose.JSONWebKeySet, error) {
+	keys, err := km.store.FindKeys(realm)
+	if err != nil {
+		return nil, err
+	}
+	jwks := &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	for _, key := range keys {
+		public, err := km.publicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, jose.JSONWebKey{
+			Key:       public,
+			KeyID:     key.Kid,
+			Algorithm: key.Algorithm,
+			Use:       "sig",
+		})
+	}
+	return jwks, nil
+}
+
+// Rotate replaces the active keys of every algorithm the realm allows
+func (km *keyManager) Rotate(realm string) error {
+	algorithms, err := km.Algorithms(realm)
+	if err != nil {
+		return err
+	}
+
+	km.mutex.Lock()
+	defer km.mutex.Unlock()
+	keys, err := km.store.FindKeys(realm)
+	if err != nil {
+		return err
+	}
+	for _, algorithm := range algorithms {
+		if err := km.rotate(realm, algorithm, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Revoke retires a compromised key at once, so it is neither used nor published any more
+func (km *keyManager) Revoke(realm string, kid string) error {
+	km.mutex.Lock()
+	defer km.mutex.Unlock()
+
+	keys, err := km.store.FindKeys(realm)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.Kid != kid {
+			continue
+		}
+		if err := km.retire(key); err != nil {
+			return err
+		}
+		log.Warnf("Revoked signing key %s of realm %s", kid, realm)
+		if key.Status == keyDto.StatusActive {
+			_, err = km.generate(realm, key.Algorithm)
+		}
+		return err
+	}
+	return ErrKeyNotFound
+}
+
+// RotateDue rotates the active keys older than the rotation period and retires passive keys past their retention
+func (km *keyManager) RotateDue() error {
+	realms, err := km.store.FindRealms()
+	if err != nil {
+		return err
+	}
+
+	km.mutex.Lock()
+	defer km.mutex.Unlock()
+	now := time.Now()
+	for _, realm := range realms {
+		keys, err := km.store.FindKeys(realm)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			switch {
+			case key.Status == keyDto.StatusActive && now.Sub(key.CreatedAt) >= km.rotationPeriod:
+				if err := km.rotate(realm, key.Algorithm, keys); err != nil {
+					return err
+				}
+			case key.Status == keyDto.StatusPassive && key.RetireAt != nil && now.After(*key.RetireAt):
+				if err := km.retire(key); err != nil {
+					return err
+				}
+				log.Infof("Retired signing key %s of realm %s", key.Kid, realm)
+			}
+		}
+	}
+	return nil
+}
+
+// ImportKey stores a key loaded from a file as the active key of its algorithm, turning the previous one passive.
+// Importing a key the realm already has is a no-op, so the same files can be imported on every start.
+func (km *keyManager) ImportKey(realm string, signer auth.Signer) error {
+	km.mutex.Lock()
+	defer km.mutex.Unlock()
+
+	existing, err := km.store.FindKey(realm, signer.KeyID())
+	if err != nil || existing != nil {
+		return err
+	}
+	keys, err := km.store.FindKeys(realm)
+	if err != nil {
+		return err
+	}
+	stored, err := km.backend.Import(signer)
+	if err != nil {
+		return err
+	}
+	if err := km.save(realm, stored, signer); err != nil {
+		return err
+	}
+	log.Infof("Imported %s signing key %s into realm %s", stored.Algorithm, stored.Kid, realm)
+	return km.deactivate(realm, stored.Algorithm, stored.Kid, keys)
+}
+
+// StartRotation checks for due rotations in the background
+func (km *keyManager) StartRotation(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := km.RotateDue(); err != nil {
+				log.Errorf("Unable to rotate signing keys: %v", err)
+			}
+		}
+	}()
+}
+
+func (km *keyManager) findActiveKey(realm string, algorithm string) (auth.Signer, error) {
+	keys, err := km.store.FindKeys(realm)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Status == keyDto.StatusActive && key.Algorithm == algorithm {
+			return km.signer(key)
+		}
+	}
+	return nil, nil
+}
+
+// rotate generates a new active key for the algorithm and turns the previous ones passive. The caller holds the mutex.
+func (km *keyManager) rotate(realm string, algorithm string, keys []*keyDto.SigningKey) error {
+	signer, err := km.generate(realm, algorithm)
+	if err != nil {
+		return err
+	}
+	log.Infof("Rotated %s signing key of realm %s", algorithm, realm)
+	return km.deactivate(realm, algorithm, signer.KeyID(), keys)
+}
+
+// deactivate turns the active keys of the algorithm passive except the given one
+func (km *keyManager) deactivate(realm string, algorithm string, kid string, keys []*keyDto.SigningKey) error {
+	retireAt := time.Now().UTC().Add(km.retention)
+	for _, key := range keys {
+		if key.Status != keyDto.StatusActive || key.Algorithm != algorithm || key.Kid == kid {
+			continue
+		}
+		if err := km.store.UpdateKeyStatus(realm, key.Kid, keyDto.StatusPassive, &retireAt); err != nil {
+			return err
+		}
+		key.Status = keyDto.StatusPassive
+	}
+	return nil
+}
+
+// retire stops publishing the key and lets the backend drop its private part
+func (km *keyManager) retire(key *keyDto.SigningKey) error {
+	if err := km.store.UpdateKeyStatus(key.Realm, key.Kid, keyDto.StatusRetired, nil); err != nil {
+		return err
+	}
+	km.signers.Delete(key.Realm + "/" + key.Kid)
+	if err := km.backend.Destroy(key); err != nil {
+		log.Errorf("Unable to destroy retired signing key %s of realm %s: %v", key.Kid, key.Realm, err)
+	}
+	return nil
+}
+
+func (km *keyManager) generate(realm string, algorithm string) (auth.Signer, error) {
+	signer, stored, err := km.backend.Generate(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := km.save(realm, stored, signer); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+func (km *keyManager) save(realm string, stored *keyDto.SigningKey, signer auth.Signer) error {
+	stored.Realm = realm
+	stored.Status = keyDto.StatusActive
+	stored.CreatedAt = time.Now().UTC()
+	if err := km.store.SaveKey(stored); err != nil {
+		return fmt.Errorf("unable to save signing key: %v", err)
+	}
+	km.signers.Store(realm+"/"+stored.Kid, signer)
+	return nil
+}
+
+// publicKey reads the stored public key, keys stored before it was kept are restored instead
+func (km *keyManager) publicKey(stored *keyDto.SigningKey) (interface{}, error) {
+	if len(stored.PublicKey) > 0 {
+		return storedPublicKey(stored)
+	}
+	signer, err := km.signer(stored)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
+
+// signer restores the stored key through the backend, caching the result as stored keys never change
+func (km *keyManager) signer(stored *keyDto.SigningKey) (auth.Signer, error) {
+	cacheKey := stored.Realm + "/" + stored.Kid
+	if signer, ok := km.signers.Load(cacheKey); ok {
+		return signer.(auth.Signer), nil
+	}
+
+	signer, err := km.backend.Restore(stored)
+	if err != nil {
+		return nil, err
+	}
+	km.signers.Store(cacheKey, signer)
+	return signer, nil
+}
+
+type realmKeyClient struct {
+	keys  *keyManager
+	realm string
+}
+
+// NewRealmKeyClient creates the auth.OIDClient of a realm's keys, so the server validates tokens it issued itself without fetching its own JWKS
+func NewRealmKeyClient(keys *keyManager, realm string) *realmKeyClient {
+	return &realmKeyClient{keys: keys, realm: realm}
+}
+
+func (rc *realmKeyClient) GetJWK(kid string) (*auth.JWK, error) {
+	jwk, _, err := rc.GetPublicKey(kid)
+	return jwk, err
+}
+
+func (rc *realmKeyClient) GetPublicKey(kid string) (*auth.JWK, crypto.PublicKey, error) {
+	signer, err := rc.keys.VerificationKey(rc.realm, kid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &auth.JWK{Kid: kid, Alg: signer.Algorithm(), Use: "sig"}, signer.Public(), nil
+}
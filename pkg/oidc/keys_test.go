@@ -0,0 +1,249 @@
+package oidc
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/NerdShoreDev/YEP/server/pkg/envelope"
+	"github.com/NerdShoreDev/YEP/server/pkg/key/dto"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	testKEK    = envelope.KEK{ID: "kek-1", Key: bytes.Repeat([]byte{1}, 32)}
+	rotatedKEK = envelope.KEK{ID: "kek-2", Key: bytes.Repeat([]byte{2}, 32)}
+)
+
+func newTestKeyWrapper(keks ...envelope.KEK) KeyWrapper {
+	wrapper, _ := envelope.NewEnvelopeCipher(keks)
+	return wrapper
+}
+
+type memoryKeyStore struct {
+	mutex sync.Mutex
+	keys  []*dto.SigningKey
+}
+
+func newMemoryKeyStore() *memoryKeyStore {
+	return &memoryKeyStore{}
+}
+
+func (store *memoryKeyStore) FindKeys(realm string) ([]*dto.SigningKey, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	keys := []*dto.SigningKey{}
+	for i := len(store.keys) - 1; i >= 0; i-- {
+		if key := store.keys[i]; key.Realm == realm && key.Status != dto.StatusRetired {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+func (store *memoryKeyStore) FindKey(realm string, kid string) (*dto.SigningKey, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, key := range store.keys {
+		if key.Realm == realm && key.Kid == kid {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (store *memoryKeyStore) FindRealms() ([]string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	realms := []string{}
+	for _, key := range store.keys {
+		if key.Status != dto.StatusRetired && !contains(realms, key.Realm) {
+			realms = append(realms, key.Realm)
+		}
+	}
+	return realms, nil
+}
+
+func (store *memoryKeyStore) SaveKey(key *dto.SigningKey) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	copied := *key
+	store.keys = append(store.keys, &copied)
+	return nil
+}
+
+func (store *memoryKeyStore) UpdateKeyStatus(realm string, kid string, status string, retireAt *time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, key := range store.keys {
+		if key.Realm == realm && key.Kid == kid {
+			key.Status = status
+			key.RetireAt = retireAt
+			if status == dto.StatusRetired {
+				key.PrivateKey = nil
+			}
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+func (store *memoryKeyStore) FindKeysToRewrap(kekID string) ([]*dto.SigningKey, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	keys := []*dto.SigningKey{}
+	for _, key := range store.keys {
+		if key.PrivateKey != nil && key.PrivateKey.KekID != kekID {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+func (store *memoryKeyStore) UpdatePrivateKey(realm string, kid string, previousKekID string, privateKey *envelope.Envelope) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, key := range store.keys {
+		if key.Realm == realm && key.Kid == kid && key.PrivateKey.KekID == previousKekID {
+			key.PrivateKey = privateKey
+		}
+	}
+	return nil
+}
+
+func (store *memoryKeyStore) status(kid string) string {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, key := range store.keys {
+		if key.Kid == kid {
+			return key.Status
+		}
+	}
+	return ""
+}
+
+func TestKeyManager_whenRotated_thenOldKeyStaysPublishedUntilRetention(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	store := newMemoryKeyStore()
+	keys := NewKeyManager(store, NewLocalKeyBackend(newTestKeyWrapper(testKEK)), StaticSigningAlgorithms{}, time.Hour, -time.Second)
+	issuer := NewTokenIssuer("https://sso.example.com", keys, time.Minute, time.Minute)
+	oldToken, _ := issuer.sign("YEP", jwt.MapClaims{"iss": issuer.Issuer("YEP"), "typ": TokenTypeBearer})
+	oldKey, _ := keys.ActiveKey("YEP", "RS256")
+
+	// act
+	err := keys.Rotate("YEP")
+	newKey, _ := keys.ActiveKey("YEP", "RS256")
+	published, _ := keys.PublicKeys("YEP")
+	_, parseErr := issuer.parse("YEP", oldToken, TokenTypeBearer)
+	dueErr := keys.RotateDue()
+	afterRetention, _ := keys.PublicKeys("YEP")
+
+	// assert
+	a.NoError(err)
+	a.NotEqual(oldKey.KeyID(), newKey.KeyID())
+	a.Len(published.Keys, 2)
+	a.NoError(parseErr)
+	a.NoError(dueErr)
+	a.Equal(dto.StatusRetired, store.status(oldKey.KeyID()))
+	a.Len(afterRetention.Keys, 1)
+	a.Equal(newKey.KeyID(), afterRetention.Keys[0].KeyID)
+}
+
+func TestKeyManager_whenActiveKeyExpired_thenRotateDue(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	store := newMemoryKeyStore()
+	keys := NewKeyManager(store, NewLocalKeyBackend(newTestKeyWrapper(testKEK)), StaticSigningAlgorithms{}, -time.Second, time.Hour)
+	oldKey, _ := keys.ActiveKey("YEP", "RS256")
+
+	// act
+	err := keys.RotateDue()
+	newKey, _ := keys.ActiveKey("YEP", "RS256")
+
+	// assert
+	a.NoError(err)
+	a.NotEqual(oldKey.KeyID(), newKey.KeyID())
+	a.Equal(dto.StatusPassive, store.status(oldKey.KeyID()))
+}
+
+func TestKeyManager_whenRevoked_thenRejectTokensAndReplaceKey(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	store := newMemoryKeyStore()
+	keys := NewKeyManager(store, NewLocalKeyBackend(newTestKeyWrapper(testKEK)), StaticSigningAlgorithms{}, time.Hour, time.Hour)
+	issuer := NewTokenIssuer("https://sso.example.com", keys, time.Minute, time.Minute)
+	token, _ := issuer.sign("YEP", jwt.MapClaims{"iss": issuer.Issuer("YEP"), "typ": TokenTypeBearer})
+	compromised, _ := keys.ActiveKey("YEP", "RS256")
+
+	// act
+	err := keys.Revoke("YEP", compromised.KeyID())
+	_, parseErr := issuer.parse("YEP", token, TokenTypeBearer)
+	replacement, _ := keys.ActiveKey("YEP", "RS256")
+	unknownErr := keys.Revoke("YEP", "unknown")
+
+	// assert
+	a.NoError(err)
+	a.Error(parseErr)
+	a.Equal(dto.StatusRetired, store.status(compromised.KeyID()))
+	a.NotEqual(compromised.KeyID(), replacement.KeyID())
+	a.Equal(ErrKeyNotFound, unknownErr)
+}
+
+func TestKeyManager_whenKEKRotated_thenRewrapStoredKeys(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	store := newMemoryKeyStore()
+	before := NewKeyManager(store, NewLocalKeyBackend(newTestKeyWrapper(testKEK)), StaticSigningAlgorithms{}, time.Hour, time.Hour)
+	key, _ := before.ActiveKey("YEP", "RS256")
+	duringBackend := NewLocalKeyBackend(newTestKeyWrapper(rotatedKEK, testKEK))
+	during := NewKeyManager(store, duringBackend, StaticSigningAlgorithms{}, time.Hour, time.Hour)
+	after := NewKeyManager(store, NewLocalKeyBackend(newTestKeyWrapper(rotatedKEK)), StaticSigningAlgorithms{}, time.Hour, time.Hour)
+
+	// act
+	_, duringErr := during.VerificationKey("YEP", key.KeyID())
+	err := duringBackend.RewrapKeys(store)
+	remaining, _ := store.FindKeysToRewrap(rotatedKEK.ID)
+	rewrapped, afterErr := after.VerificationKey("YEP", key.KeyID())
+
+	// assert
+	a.NoError(duringErr)
+	a.NoError(err)
+	a.Empty(remaining)
+	a.NoError(afterErr)
+	a.Equal(key.Public(), rewrapped.Public())
+	a.Equal(rotatedKEK.ID, store.keys[0].PrivateKey.KekID)
+}
+
+func TestCerts_publishesRealmKeys(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	issuer := newTestIssuer(StaticSigningAlgorithms{"YEP": {"ES256", "EdDSA"}})
+	active, _ := issuer.keys.ActiveKey("YEP", "ES256")
+	tokens := NewTokenHandler(nil, nil, nil, issuer, nil)
+	r := httptest.NewRequest(http.MethodGet, "/auth/realm/YEP/protocol/openid-connect/certs", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	tokens.Certs(w, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+
+	// assert
+	a.Equal(http.StatusOK, w.Code)
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	a.NoError(json.NewDecoder(w.Body).Decode(&jwks))
+	a.Len(jwks.Keys, 1)
+	a.Equal(active.KeyID(), jwks.Keys[0]["kid"])
+	a.Equal("EC", jwks.Keys[0]["kty"])
+	a.Equal("ES256", jwks.Keys[0]["alg"])
+	a.NotContains(jwks.Keys[0], "d")
+}
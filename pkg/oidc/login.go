@@ -0,0 +1,131 @@
+package oidc
+
+import (
+	"fmt"
+	"github.com/NerdShoreDev/YEP/server/pkg/lockout"
+	"github.com/NerdShoreDev/YEP/server/pkg/password"
+	"github.com/NerdShoreDev/YEP/server/pkg/theme"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"net"
+	"net/http"
+	"time"
+)
+
+// passwordACR is the authentication context class reference of logins with password only
+const passwordACR = "1"
+
+// PasswordAuthenticator checks the password of a login, throttling guessing from the address
+type PasswordAuthenticator interface {
+	Authenticate(realm string, username string, password string, ipAddress string) (*userDto.User, error)
+}
+
+// loginPage is the view model of the login page
+type loginPage struct {
+	page
+	Action      string
+	Interaction string
+	CSRF        string
+	Username    string
+	Error       string
+}
+
+// Login handles the login page of the authorization endpoint
+func (ah *authorizationHandler) Login(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	in, err := ah.currentInteraction(r, realm)
+	if err != nil {
+		ah.renderError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	form := &loginPage{page: newPage(r), Action: endpointPath(realm, "login"), Interaction: in.ID, CSRF: in.CSRF, Username: in.Request.LoginHint}
+	if r.Method != http.MethodPost {
+		ah.render(w, r, theme.PageLogin, http.StatusOK, form)
+		return
+	}
+
+	form.Username = r.PostFormValue("username")
+	user, err := ah.passwords.Authenticate(realm, form.Username, r.PostFormValue("password"), remoteAddress(r))
+	if err != nil {
+		ah.loginFailed(w, r, form, err)
+		return
+	}
+	if in.Subject != "" && in.Subject != user.ID {
+		form.Error = "The application asked for another user, log in as that user."
+		ah.render(w, r, theme.PageLogin, http.StatusForbidden, form)
+		return
+	}
+
+	session, err := ah.startSession(w, r, realm, user)
+	if err != nil {
+		log.Errorf("unable to start session of user %s of realm %s: %v", user.ID, realm, err)
+		ah.renderError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	ah.proceed(w, r, in, session)
+}
+
+// loginFailed shows the login page again with what went wrong
+func (ah *authorizationHandler) loginFailed(w http.ResponseWriter, r *http.Request, form *loginPage, err error) {
+	status := http.StatusUnauthorized
+	switch err := err.(type) {
+	case *lockout.ThrottledError:
+		retryAfter := int64(math.Ceil(err.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+		status = http.StatusTooManyRequests
+		form.Error = fmt.Sprintf("Too many failed logins, try again in %d seconds.", retryAfter)
+	default:
+		switch err {
+		case password.ErrInvalidCredentials:
+			form.Error = "Invalid username or password."
+		case password.ErrUserDisabled:
+			status = http.StatusForbidden
+			form.Error = "Your account is disabled."
+		case lockout.ErrLocked:
+			status = http.StatusForbidden
+			form.Error = "Your account is locked, contact your administrator."
+		case password.ErrPasswordExpired:
+			status = http.StatusForbidden
+			form.Error = "Your password has expired, contact your administrator for a new one."
+		default:
+			ah.renderError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	ah.render(w, r, theme.PageLogin, status, form)
+}
+
+// startSession records the login in the browser session. A session of the same user is kept, so tokens issued before
+// and after share their sid, the session of another user is replaced.
+func (ah *authorizationHandler) startSession(w http.ResponseWriter, r *http.Request, realm string, user *userDto.User) (*Session, error) {
+	now := time.Now()
+	current, err := ah.sessions.CurrentSession(r, realm)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Subject == user.ID {
+		if session, err := ah.sessions.Reauthenticate(current, passwordACR, now); err == nil {
+			return session, nil
+		}
+	}
+	if current != nil {
+		ah.sessions.Delete(w, current)
+	}
+	session := &Session{Realm: realm, Subject: user.ID, Username: user.Username, AuthTime: now, ACR: passwordACR}
+	if err := ah.sessions.Create(w, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// remoteAddress is the address the request came from. Forwarded headers are not trusted, as anyone could set them to
+// escape blocked addresses.
+func remoteAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,260 @@
+package oidc
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/consent/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/lockout"
+	"github.com/NerdShoreDev/YEP/server/pkg/password"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticPasswords knows the password of anna and throttles logins from 10.0.0.9
+type staticPasswords struct{}
+
+func (staticPasswords) Authenticate(realm string, username string, secret string, ipAddress string) (*userDto.User, error) {
+	if ipAddress == "10.0.0.9" {
+		return nil, &lockout.ThrottledError{RetryAfter: 1500 * time.Millisecond}
+	}
+	if username == "anna" && secret == "s3cret" {
+		return &userDto.User{ID: "user-1", Username: "anna", Enabled: true}, nil
+	}
+	return nil, password.ErrInvalidCredentials
+}
+
+type loginTest struct {
+	handler  *authorizationHandler
+	sessions *sessionStore
+	consents *MockConsentStore
+	// browser is the browser cookie set by the last authorization request
+	browser *http.Cookie
+}
+
+func newLoginTest() *loginTest {
+	lt := &loginTest{sessions: NewSessionStore(time.Hour), consents: &MockConsentStore{}}
+	lt.handler = NewAuthorizationHandler(testClients, lt.consents, lt.sessions, staticPasswords{}, testPages, NewAuthorizationDetailsValidator(paymentTypes), NewClaimsEngine(StaticScopeMappings{}, StaticUserClaims{}), newTestSubjectResolver())
+	return lt
+}
+
+// authorize starts an authorization request without session and returns the login page it redirects to
+func (lt *loginTest) authorize(params url.Values) *url.URL {
+	w := httptest.NewRecorder()
+	lt.handler.Authorize(w, authorizeRequest(params))
+	lt.browser = browserCookie(w)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	return location
+}
+
+// login posts the login form of the interaction from the browser which started it
+func (lt *loginTest) login(interactionID string, username string, password string, remoteAddr string) *httptest.ResponseRecorder {
+	csrf := ""
+	if in, ok := lt.handler.lookupInteraction(interactionID); ok {
+		csrf = in.CSRF
+	}
+	form := url.Values{"interaction": {interactionID}, "csrf": {csrf}, "username": {username}, "password": {password}}
+	return post(lt.handler.Login, endpointPath("YEP", "login"), form, remoteAddr, lt.browser)
+}
+
+func post(handler http.HandlerFunc, path string, form url.Values, remoteAddr string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = remoteAddr
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	handler(w, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+	return w
+}
+
+// browserCookie returns the browser cookie set by the response
+func browserCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == browserCookiePrefix+"YEP" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// hiddenField returns the value of the named hidden field of a rendered form
+func hiddenField(body string, name string) string {
+	prefix := `name="` + name + `" value="`
+	value := body[strings.Index(body, prefix)+len(prefix):]
+	return value[:strings.Index(value, `"`)]
+}
+
+func TestLogin_whenPasswordRight_thenStartSessionAndProceed(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	lt := newLoginTest()
+	lt.consents.On("FindConsent", "YEP", "user-1", "first-party").Return((*dto.Consent)(nil), nil)
+	login := lt.authorize(url.Values{
+		"response_type": {"code"},
+		"client_id":     {"first-party"},
+		"redirect_uri":  {"https://yep.example.com/cb"},
+		"login_hint":    {"anna"},
+	})
+	r := httptest.NewRequest(http.MethodGet, login.String(), nil)
+	r.AddCookie(lt.browser)
+	page := httptest.NewRecorder()
+	lt.handler.Login(page, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+	form := url.Values{"interaction": {login.Query().Get("interaction")}, "csrf": {hiddenField(page.Body.String(), "csrf")}, "username": {"anna"}, "password": {"s3cret"}}
+
+	// act
+	w := post(lt.handler.Login, login.Path, form, "10.0.0.1:4711", lt.browser)
+
+	// assert
+	a.Equal("/auth/realm/YEP/protocol/openid-connect/login", login.Path)
+	a.Equal(http.StatusOK, page.Code)
+	a.Contains(page.Body.String(), `value="anna"`)
+	a.Equal(http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	grant, ok := lt.handler.RedeemCode(location.Query().Get("code"))
+	a.True(ok)
+	a.Equal("user-1", grant.Subject)
+	a.Equal(passwordACR, grant.ACR)
+	cookie := w.Result().Cookies()[0]
+	a.Equal(sessionCookiePrefix+"YEP", cookie.Name)
+	a.Equal(grant.SessionID, cookie.Value)
+}
+
+func TestLogin_whenPasswordCannotMeetRequestedACR_thenUnmetAuthenticationRequirements(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	lt := newLoginTest()
+	lt.consents.On("FindConsent", "YEP", "user-1", "first-party").Return((*dto.Consent)(nil), nil)
+	params := func(acrValues string) url.Values {
+		return url.Values{"response_type": {"code"}, "client_id": {"first-party"}, "redirect_uri": {"https://yep.example.com/cb"}, "acr_values": {acrValues}, "state": {"xyz"}}
+	}
+	acceptable := lt.authorize(params("2 1"))
+	// An interaction asking for a strength the login cannot reach, as a session which ended since may have started it
+	request, _ := ParseAuthorizationRequest("YEP", params("2"))
+	stale := &interaction{Request: request, Client: testClients["YEP"]["first-party"], Browser: lt.browser.Value, CSRF: "csrf-token"}
+	stale.ID, _ = lt.handler.interactions.put(stale)
+
+	// act
+	met := lt.login(acceptable.Query().Get("interaction"), "anna", "s3cret", "10.0.0.1:4711")
+	unmet := lt.login(stale.ID, "anna", "s3cret", "10.0.0.1:4711")
+
+	// assert
+	metLocation, _ := url.Parse(met.Header().Get("Location"))
+	grant, ok := lt.handler.RedeemCode(metLocation.Query().Get("code"))
+	a.True(ok)
+	a.Equal(passwordACR, grant.ACR)
+	a.Equal(http.StatusFound, unmet.Code)
+	unmetLocation, _ := url.Parse(unmet.Header().Get("Location"))
+	a.Equal("yep.example.com", unmetLocation.Host)
+	a.Equal(ErrorUnmetAuthenticationRequirements, unmetLocation.Query().Get("error"))
+	a.Equal("xyz", unmetLocation.Query().Get("state"))
+	a.Empty(unmetLocation.Query().Get("code"))
+}
+
+func TestLogin_whenLoginFails_thenShowLoginPageAgain(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	lt := newLoginTest()
+	login := lt.authorize(url.Values{"response_type": {"code"}, "client_id": {"third-party"}, "redirect_uri": {"https://client.example.com/cb"}})
+	interaction := login.Query().Get("interaction")
+
+	// act
+	wrong := lt.login(interaction, "anna", "guess", "10.0.0.1:4711")
+	throttled := lt.login(interaction, "anna", "s3cret", "10.0.0.9:4711")
+	expired := lt.login("unknown", "anna", "s3cret", "10.0.0.1:4711")
+
+	// assert
+	a.Equal(http.StatusUnauthorized, wrong.Code)
+	a.Contains(wrong.Body.String(), "Invalid username or password.")
+	a.Contains(wrong.Body.String(), `value="`+interaction+`"`)
+	a.Equal(http.StatusTooManyRequests, throttled.Code)
+	a.Equal("2", throttled.Header().Get("Retry-After"))
+	a.Contains(throttled.Body.String(), "try again in 2 seconds")
+	a.Equal(http.StatusBadRequest, expired.Code)
+	a.Contains(expired.Body.String(), "unknown or expired authorization request")
+}
+
+func TestLogin_whenFormForgedOrPostedFromAnotherBrowser_thenReject(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	lt := newLoginTest()
+	login := lt.authorize(url.Values{"response_type": {"code"}, "client_id": {"first-party"}, "redirect_uri": {"https://yep.example.com/cb"}})
+	interaction := login.Query().Get("interaction")
+	in, _ := lt.handler.lookupInteraction(interaction)
+	credentials := func(csrf string) url.Values {
+		return url.Values{"interaction": {interaction}, "csrf": {csrf}, "username": {"anna"}, "password": {"s3cret"}}
+	}
+	otherBrowser := &http.Cookie{Name: browserCookiePrefix + "YEP", Value: "other-browser"}
+
+	// act
+	withoutToken := post(lt.handler.Login, login.Path, credentials(""), "10.0.0.1:4711", lt.browser)
+	wrongToken := post(lt.handler.Login, login.Path, credentials("forged"), "10.0.0.1:4711", lt.browser)
+	withoutCookie := post(lt.handler.Login, login.Path, credentials(in.CSRF), "10.0.0.1:4711")
+	fromOtherBrowser := post(lt.handler.Login, login.Path, credentials(in.CSRF), "10.0.0.1:4711", otherBrowser)
+
+	// assert
+	a.True(lt.browser.HttpOnly)
+	a.Equal(http.SameSiteLaxMode, lt.browser.SameSite)
+	a.Equal(http.StatusBadRequest, withoutToken.Code)
+	a.Contains(withoutToken.Body.String(), "the form has expired")
+	a.Equal(http.StatusBadRequest, wrongToken.Code)
+	a.Equal(http.StatusBadRequest, withoutCookie.Code)
+	a.Contains(withoutCookie.Body.String(), "started in another browser")
+	a.Equal(http.StatusBadRequest, fromOtherBrowser.Code)
+	_, ok := lt.handler.lookupInteraction(interaction)
+	a.True(ok)
+}
+
+func TestAuthorize_whenBrowserKnown_thenKeepItsCookie(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	lt := newLoginTest()
+	params := url.Values{"response_type": {"code"}, "client_id": {"first-party"}, "redirect_uri": {"https://yep.example.com/cb"}}
+	first := lt.authorize(params)
+	r := authorizeRequest(params)
+	r.AddCookie(lt.browser)
+	w := httptest.NewRecorder()
+
+	// act
+	lt.handler.Authorize(w, r)
+
+	// assert
+	a.Nil(browserCookie(w))
+	second, _ := url.Parse(w.Header().Get("Location"))
+	firstInteraction, _ := lt.handler.lookupInteraction(first.Query().Get("interaction"))
+	secondInteraction, _ := lt.handler.lookupInteraction(second.Query().Get("interaction"))
+	a.Equal(lt.browser.Value, firstInteraction.Browser)
+	a.Equal(lt.browser.Value, secondInteraction.Browser)
+	a.NotEqual(firstInteraction.CSRF, secondInteraction.CSRF)
+}
+
+func TestLogout_whenConfirmed_thenEndSession(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	lt := newLoginTest()
+	session := &Session{Realm: "YEP", Subject: "user-1", Username: "anna", AuthTime: time.Now(), ACR: passwordACR}
+	_ = lt.sessions.Create(httptest.NewRecorder(), session)
+	cookie := &http.Cookie{Name: sessionCookiePrefix + "YEP", Value: session.ID}
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/auth/realm/YEP/protocol/openid-connect/logout", nil), map[string]string{"realm": "YEP"})
+	r.AddCookie(cookie)
+	page := httptest.NewRecorder()
+	lt.handler.Logout(page, r)
+	confirmation := hiddenField(page.Body.String(), "confirmation")
+
+	// act
+	forged := post(lt.handler.Logout, "/auth/realm/YEP/protocol/openid-connect/logout", url.Values{"confirmation": {"forged"}}, "10.0.0.1:4711", cookie)
+	confirmed := post(lt.handler.Logout, "/auth/realm/YEP/protocol/openid-connect/logout", url.Values{"confirmation": {confirmation}}, "10.0.0.1:4711", cookie)
+	current, _ := lt.sessions.CurrentSession(r, "YEP")
+
+	// assert
+	a.Contains(page.Body.String(), "Do you want to log out anna?")
+	a.Equal(http.StatusBadRequest, forged.Code)
+	a.Equal(http.StatusOK, confirmed.Code)
+	a.Contains(confirmed.Body.String(), "You are logged out")
+	a.Nil(current)
+}
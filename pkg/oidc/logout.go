@@ -0,0 +1,52 @@
+package oidc
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/theme"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// logoutPage is the view model of the logout confirmation
+type logoutPage struct {
+	page
+	Action       string
+	Confirmation string
+	Username     string
+	LoggedOut    bool
+}
+
+// Logout asks the user to confirm ending the session of the realm and ends it once confirmed. The confirmation is
+// bound to the session, so other sites cannot log users out by posting the form.
+func (ah *authorizationHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	form := &logoutPage{page: newPage(r), Action: endpointPath(realm, "logout")}
+	session, err := ah.sessions.CurrentSession(r, realm)
+	if err != nil {
+		ah.renderError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if session == nil {
+		form.LoggedOut = true
+		ah.render(w, r, theme.PageLogout, http.StatusOK, form)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		if form.Confirmation, err = ah.logouts.put(session.ID); err != nil {
+			ah.renderError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		form.Username = session.Username
+		ah.render(w, r, theme.PageLogout, http.StatusOK, form)
+		return
+	}
+
+	sessionID, ok := ah.logouts.take(r.PostFormValue("confirmation"))
+	if !ok || sessionID != session.ID {
+		ah.renderError(w, r, http.StatusBadRequest, NewError(ErrorInvalidRequest, "unknown or expired logout confirmation, try to log out again"))
+		return
+	}
+	ah.sessions.Delete(w, session)
+	form.LoggedOut = true
+	ah.render(w, r, theme.PageLogout, http.StatusOK, form)
+}
@@ -0,0 +1,72 @@
+package oidc
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/theme"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// PageRenderer renders the HTML pages and serves the static files of the realms' themes
+type PageRenderer interface {
+	Render(w http.ResponseWriter, theme string, page string, status int, data interface{}) error
+	ServeStatic(w http.ResponseWriter, r *http.Request, theme string, file string)
+}
+
+// page is what every page shows besides its own content
+type page struct {
+	// Realm is the display name of the realm
+	Realm string
+	// Static is the path of the static files of the realm's theme
+	Static string
+}
+
+// errorPage is the view model of the error page
+type errorPage struct {
+	page
+	Code    string
+	Message string
+}
+
+// newPage returns the common view model of the request's realm
+func newPage(r *http.Request) page {
+	name := mux.Vars(r)["realm"]
+	displayName := name
+	if realm, ok := RealmFrom(r.Context()); ok && realm.DisplayName != "" {
+		displayName = realm.DisplayName
+	}
+	return page{Realm: displayName, Static: realmPath(name) + "/static"}
+}
+
+// themeOf returns the theme of the request's realm, empty for the built-in one
+func themeOf(r *http.Request) string {
+	if realm, ok := RealmFrom(r.Context()); ok {
+		return realm.Theme
+	}
+	return ""
+}
+
+// render writes the page of the realm's theme
+func (ah *authorizationHandler) render(w http.ResponseWriter, r *http.Request, name string, status int, data interface{}) {
+	if err := ah.pages.Render(w, themeOf(r), name, status, data); err != nil {
+		log.Errorf("unable to render %s page: %v", name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// renderError shows the error page for errors which cannot be sent back to the client. Errors which are not OAuth 2.0
+// errors are reported as server_error.
+func (ah *authorizationHandler) renderError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	oauthErr, ok := err.(*Error)
+	if !ok {
+		log.Errorf("%s failed: %v", r.URL.Path, err)
+		oauthErr = &Error{Code: ErrorServerError, Description: "the server was unable to process the request"}
+		status = http.StatusInternalServerError
+	}
+	ah.render(w, r, theme.PageError, status, &errorPage{page: newPage(r), Code: oauthErr.Code, Message: oauthErr.Description})
+}
+
+// Static serves the static files of the realm's theme, like its stylesheet and logo
+func (ah *authorizationHandler) Static(w http.ResponseWriter, r *http.Request) {
+	ah.pages.ServeStatic(w, r, themeOf(r), mux.Vars(r)["file"])
+}
@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Subject types of OpenID Connect
+const (
+	SubjectTypePublic   = "public"
+	SubjectTypePairwise = "pairwise"
+)
+
+const sectorDocumentTTL = time.Hour
+
+// PairwiseStore remembers which user a pairwise subject identifier stands for
+type PairwiseStore interface {
+	SavePairwiseSubject(realm string, sector string, subject string, pairwiseSubject string) error
+	FindSubject(realm string, pairwiseSubject string) (string, error)
+}
+
+type sectorDocument struct {
+	redirectURIs []string
+	fetched      time.Time
+}
+
+type subjectResolver struct {
+	salt       []byte
+	store      PairwiseStore
+	httpClient *http.Client
+	mutex      sync.Mutex
+	sectors    map[string]sectorDocument
+}
+
+// NewSubjectResolver creates the resolver computing pairwise subject identifiers from a secret salt
+func NewSubjectResolver(salt string, store PairwiseStore, httpClient *http.Client) *subjectResolver {
+	return &subjectResolver{
+		salt:       []byte(salt),
+		store:      store,
+		httpClient: httpClient,
+		sectors:    map[string]sectorDocument{},
+	}
+}
+
+// SubjectFor returns the subject identifier the client gets to see for the user
+func (sr *subjectResolver) SubjectFor(realm string, client *Client, subject string) (string, error) {
+	if client.SubjectType != SubjectTypePairwise {
+		return subject, nil
+	}
+	if len(sr.salt) == 0 {
+		return "", errors.New("pairwise subject identifiers require a salt")
+	}
+
+	sector, err := sr.sectorIdentifier(client)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, sr.salt)
+	mac.Write([]byte(realm + "\x00" + sector + "\x00" + subject))
+	pairwiseSubject := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	if err := sr.store.SavePairwiseSubject(realm, sector, subject, pairwiseSubject); err != nil {
+		return "", fmt.Errorf("unable to save pairwise subject: %v", err)
+	}
+	return pairwiseSubject, nil
+}
+
+// LocalSubject resolves a subject identifier of a token back to the user. Public subjects are returned unchanged.
+func (sr *subjectResolver) LocalSubject(realm string, subject string) (string, error) {
+	local, err := sr.store.FindSubject(realm, subject)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve pairwise subject: %v", err)
+	}
+	if local == "" {
+		return subject, nil
+	}
+	return local, nil
+}
+
+// sectorIdentifier is the host of the sector_identifier_uri, or of the redirect URIs if there is none
+func (sr *subjectResolver) sectorIdentifier(client *Client) (string, error) {
+	if client.SectorIdentifierURI != "" {
+		if err := sr.validateSectorDocument(client); err != nil {
+			return "", err
+		}
+		return hostOf(client.SectorIdentifierURI)
+	}
+
+	sector := ""
+	for _, redirectURI := range client.RedirectURIs {
+		host, err := hostOf(redirectURI)
+		if err != nil {
+			return "", err
+		}
+		if sector != "" && sector != host {
+			return "", fmt.Errorf("client %s has redirect URIs on several hosts and needs a sector_identifier_uri", client.ID)
+		}
+		sector = host
+	}
+	if sector == "" {
+		return "", fmt.Errorf("client %s has no redirect URIs", client.ID)
+	}
+	return sector, nil
+}
+
+// validateSectorDocument checks that the sector identifier document lists every redirect URI of the client
+func (sr *subjectResolver) validateSectorDocument(client *Client) error {
+	redirectURIs, err := sr.fetchSectorDocument(client.SectorIdentifierURI)
+	if err != nil {
+		return err
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		if !contains(redirectURIs, redirectURI) {
+			return fmt.Errorf("redirect URI %s of client %s is missing in its sector identifier document", redirectURI, client.ID)
+		}
+	}
+	return nil
+}
+
+func (sr *subjectResolver) fetchSectorDocument(sectorURI string) ([]string, error) {
+	sr.mutex.Lock()
+	document, ok := sr.sectors[sectorURI]
+	sr.mutex.Unlock()
+	if ok && time.Since(document.fetched) < sectorDocumentTTL {
+		return document.redirectURIs, nil
+	}
+
+	parsed, err := url.Parse(sectorURI)
+	if err != nil || parsed.Scheme != "https" {
+		return nil, fmt.Errorf("sector_identifier_uri %s must be an https URL", sectorURI)
+	}
+	response, err := sr.httpClient.Get(sectorURI)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch sector identifier document: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch sector identifier document: status %d", response.StatusCode)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	var redirectURIs []string
+	if err := json.Unmarshal(body, &redirectURIs); err != nil {
+		return nil, fmt.Errorf("sector identifier document must be a JSON array of redirect URIs: %v", err)
+	}
+
+	sr.mutex.Lock()
+	sr.sectors[sectorURI] = sectorDocument{redirectURIs: redirectURIs, fetched: time.Now()}
+	sr.mutex.Unlock()
+	return redirectURIs, nil
+}
+
+func hostOf(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return "", fmt.Errorf("invalid URL %s", rawURL)
+	}
+	return parsed.Hostname(), nil
+}
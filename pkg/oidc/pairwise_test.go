@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type memoryPairwiseStore map[string]string
+
+func (store memoryPairwiseStore) SavePairwiseSubject(realm string, sector string, subject string, pairwiseSubject string) error {
+	store[realm+"/"+pairwiseSubject] = subject
+	return nil
+}
+
+func (store memoryPairwiseStore) FindSubject(realm string, pairwiseSubject string) (string, error) {
+	return store[realm+"/"+pairwiseSubject], nil
+}
+
+func newTestSubjectResolver() *subjectResolver {
+	return NewSubjectResolver("test-salt", memoryPairwiseStore{}, http.DefaultClient)
+}
+
+func TestSubjectFor_whenSameSector_thenSameSubject(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	resolver := newTestSubjectResolver()
+	shop := &Client{ID: "shop", SubjectType: SubjectTypePairwise, RedirectURIs: []string{"https://shop.example.com/cb"}}
+	shopAdmin := &Client{ID: "shop-admin", SubjectType: SubjectTypePairwise, RedirectURIs: []string{"https://shop.example.com/admin/cb"}}
+	blog := &Client{ID: "blog", SubjectType: SubjectTypePairwise, RedirectURIs: []string{"https://blog.example.com/cb"}}
+
+	// act
+	shopSubject, err := resolver.SubjectFor("YEP", shop, "user-1")
+	shopAdminSubject, _ := resolver.SubjectFor("YEP", shopAdmin, "user-1")
+	blogSubject, _ := resolver.SubjectFor("YEP", blog, "user-1")
+	otherUserSubject, _ := resolver.SubjectFor("YEP", shop, "user-2")
+
+	// assert
+	a.NoError(err)
+	a.NotEqual("user-1", shopSubject)
+	a.Equal(shopSubject, shopAdminSubject)
+	a.NotEqual(shopSubject, blogSubject)
+	a.NotEqual(shopSubject, otherUserSubject)
+}
+
+func TestSubjectFor_whenPublicClient_thenLocalSubject(t *testing.T) {
+	// arrange
+	resolver := newTestSubjectResolver()
+
+	// act
+	subject, err := resolver.SubjectFor("YEP", &Client{ID: "app"}, "user-1")
+
+	// assert
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", subject)
+}
+
+func TestLocalSubject_whenPairwiseSubject_thenResolveUser(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	resolver := newTestSubjectResolver()
+	client := &Client{ID: "shop", SubjectType: SubjectTypePairwise, RedirectURIs: []string{"https://shop.example.com/cb"}}
+	pairwiseSubject, _ := resolver.SubjectFor("YEP", client, "user-1")
+
+	// act
+	local, err := resolver.LocalSubject("YEP", pairwiseSubject)
+	public, _ := resolver.LocalSubject("YEP", "user-2")
+
+	// assert
+	a.NoError(err)
+	a.Equal("user-1", local)
+	a.Equal("user-2", public)
+}
+
+func TestSubjectFor_whenRedirectURIsOnSeveralHosts_thenVerifySectorDocument(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `["https://shop.example.com/cb","https://shop.example.org/cb"]`)
+	}))
+	defer server.Close()
+	resolver := NewSubjectResolver("test-salt", memoryPairwiseStore{}, server.Client())
+	listed := &Client{ID: "shop", SubjectType: SubjectTypePairwise, SectorIdentifierURI: server.URL + "/sector.json",
+		RedirectURIs: []string{"https://shop.example.com/cb", "https://shop.example.org/cb"}}
+	unlisted := &Client{ID: "evil", SubjectType: SubjectTypePairwise, SectorIdentifierURI: server.URL + "/sector.json",
+		RedirectURIs: []string{"https://evil.example.com/cb"}}
+	withoutDocument := &Client{ID: "multi", SubjectType: SubjectTypePairwise,
+		RedirectURIs: []string{"https://shop.example.com/cb", "https://shop.example.org/cb"}}
+
+	// act
+	_, listedErr := resolver.SubjectFor("YEP", listed, "user-1")
+	_, unlistedErr := resolver.SubjectFor("YEP", unlisted, "user-1")
+	_, withoutDocumentErr := resolver.SubjectFor("YEP", withoutDocument, "user-1")
+
+	// assert
+	a.NoError(listedErr)
+	a.Error(unlistedErr)
+	a.Error(withoutDocumentErr)
+}
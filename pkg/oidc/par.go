@@ -0,0 +1,94 @@
+package oidc
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// requestURIPrefix starts the request_uri of pushed authorization requests (RFC 9126)
+const requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// PushedAuthorizationResponse is the successful response of the pushed authorization request endpoint
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
+
+// PushAuthorizationRequest handles the pushed authorization request endpoint. Clients authenticate like at the token
+// endpoint and send the parameters of the authorization request, which is checked and stored. The authorization
+// endpoint then only gets the client_id and the returned request_uri.
+func (ah *authorizationHandler) PushAuthorizationRequest(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	if err := r.ParseForm(); err != nil {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidRequest, "malformed request"))
+		return
+	}
+
+	client, err := authenticateClient(ah.clients, realm, r)
+	if err != nil {
+		log.Debugf("PushAuthorizationRequest: client authentication failed: %v", err)
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+		WriteError(w, http.StatusUnauthorized, NewError(ErrorInvalidClient, "client authentication failed"))
+		return
+	}
+	if r.PostForm.Get("request_uri") != "" {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidRequest, "request_uri must not be pushed"))
+		return
+	}
+	// Clients authenticating with client_secret_basic need not repeat their client_id
+	if r.PostForm.Get("client_id") == "" {
+		r.PostForm.Set("client_id", client.ID)
+	}
+	request, err := ParseAuthorizationRequest(realm, r.PostForm)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.ClientID != client.ID {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidRequest, "client_id does not match the authenticated client"))
+		return
+	}
+	if !client.AllowsRedirectURI(request.RedirectURI) {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidRequest, "redirect_uri not registered"))
+		return
+	}
+	if err := ah.checkRequest(client, request); err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	key, err := ah.pushed.put(request)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&PushedAuthorizationResponse{RequestURI: requestURIPrefix + key, ExpiresIn: int64(pushedRequestTTL.Seconds())})
+}
+
+// authorizationRequest reads the authorization request from the parameters, or takes the pushed request the
+// request_uri parameter refers to. Pushed requests can be used once and only by the client which pushed them.
+func (ah *authorizationHandler) authorizationRequest(realm string, values url.Values) (*AuthorizationRequest, error) {
+	requestURI := values.Get("request_uri")
+	if requestURI == "" {
+		return ParseAuthorizationRequest(realm, values)
+	}
+	if !strings.HasPrefix(requestURI, requestURIPrefix) {
+		return nil, NewError(ErrorInvalidRequestURI, "unknown request_uri")
+	}
+	value, ok := ah.pushed.take(strings.TrimPrefix(requestURI, requestURIPrefix))
+	if !ok {
+		return nil, NewError(ErrorInvalidRequestURI, "unknown or expired request_uri")
+	}
+	request := value.(*AuthorizationRequest)
+	if request.Realm != realm || request.ClientID != values.Get("client_id") {
+		return nil, NewError(ErrorInvalidRequestURI, "request_uri was pushed by another client")
+	}
+	return request, nil
+}
@@ -0,0 +1,91 @@
+package oidc
+
+import (
+	"encoding/json"
+	clientDto "github.com/NerdShoreDev/YEP/server/pkg/client/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/consent/dto"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var parClients = StaticClients{"YEP": {
+	"app":   {ID: "app", Secrets: []clientDto.ClientSecret{{Hash: HashClientSecret("s3cret")}}, RedirectURIs: []string{"https://app.example.com/cb"}, Trusted: true},
+	"other": {ID: "other", Secrets: []clientDto.ClientSecret{{Hash: HashClientSecret("0ther")}}, RedirectURIs: []string{"https://other.example.com/cb"}},
+}}
+
+func push(handler *authorizationHandler, clientID string, secret string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/auth/realm/YEP/protocol/openid-connect/par", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(clientID, secret)
+	w := httptest.NewRecorder()
+	handler.PushAuthorizationRequest(w, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+	return w
+}
+
+func TestPushAuthorizationRequest_whenPushed_thenAuthorizeWithRequestURIOnce(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	consents := &MockConsentStore{}
+	consents.On("FindConsent", "YEP", "user-1", "app").Return((*dto.Consent)(nil), nil)
+	handler := NewAuthorizationHandler(parClients, consents, staticSession{testSession}, nil, testPages, NewAuthorizationDetailsValidator(paymentTypes), NewClaimsEngine(StaticScopeMappings{}, StaticUserClaims{}), newTestSubjectResolver())
+	pushed := push(handler, "app", "s3cret", url.Values{
+		"response_type":         {"code"},
+		"redirect_uri":          {"https://app.example.com/cb"},
+		"scope":                 {"openid"},
+		"state":                 {"af0ifjsldkj"},
+		"authorization_details": {paymentDetails},
+	})
+	var response PushedAuthorizationResponse
+	json.NewDecoder(pushed.Body).Decode(&response)
+
+	// act
+	w := httptest.NewRecorder()
+	handler.Authorize(w, authorizeRequest(url.Values{"client_id": {"app"}, "request_uri": {response.RequestURI}}))
+	again := httptest.NewRecorder()
+	handler.Authorize(again, authorizeRequest(url.Values{"client_id": {"app"}, "request_uri": {response.RequestURI}}))
+
+	// assert
+	a.Equal(http.StatusCreated, pushed.Code)
+	a.True(strings.HasPrefix(response.RequestURI, requestURIPrefix))
+	a.Equal(int64(60), response.ExpiresIn)
+	a.Equal(http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	a.Equal("app.example.com", location.Host)
+	a.Equal("af0ifjsldkj", location.Query().Get("state"))
+	grant, ok := handler.RedeemCode(location.Query().Get("code"))
+	a.True(ok)
+	a.Equal("payment_initiation", grant.AuthorizationDetails[0].Type)
+	a.Equal(http.StatusBadRequest, again.Code)
+	a.Contains(again.Body.String(), "unknown or expired request_uri")
+}
+
+func TestPushAuthorizationRequest_whenRequestInvalid_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	handler := NewAuthorizationHandler(parClients, &MockConsentStore{}, staticSession{testSession}, nil, testPages, NewAuthorizationDetailsValidator(paymentTypes), NewClaimsEngine(StaticScopeMappings{}, StaticUserClaims{}), newTestSubjectResolver())
+	request := url.Values{"response_type": {"code"}, "redirect_uri": {"https://app.example.com/cb"}}
+	pushed := push(handler, "app", "s3cret", request)
+	var response PushedAuthorizationResponse
+	json.NewDecoder(pushed.Body).Decode(&response)
+
+	// act
+	wrongSecret := push(handler, "app", "guess", request)
+	foreignRedirect := push(handler, "app", "s3cret", url.Values{"response_type": {"code"}, "redirect_uri": {"https://evil.example.com/cb"}})
+	unknownType := push(handler, "app", "s3cret", url.Values{"response_type": {"code"}, "redirect_uri": {"https://app.example.com/cb"}, "authorization_details": {`[{"type":"unknown"}]`}})
+	otherClient := httptest.NewRecorder()
+	handler.Authorize(otherClient, authorizeRequest(url.Values{"client_id": {"other"}, "request_uri": {response.RequestURI}}))
+
+	// assert
+	a.Equal(http.StatusUnauthorized, wrongSecret.Code)
+	a.Equal(http.StatusBadRequest, foreignRedirect.Code)
+	a.Contains(foreignRedirect.Body.String(), "redirect_uri not registered")
+	a.Equal(http.StatusBadRequest, unknownType.Code)
+	a.Contains(unknownType.Body.String(), ErrorInvalidAuthorizationDetails)
+	a.Equal(http.StatusBadRequest, otherClient.Code)
+	a.Contains(otherClient.Body.String(), "request_uri was pushed by another client")
+}
@@ -0,0 +1,27 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// CodeChallengeMethodS256 is the only PKCE method supported, plain would let the challenge leak the verifier
+const CodeChallengeMethodS256 = "S256"
+
+// codeVerifierPattern is the syntax of code verifiers from RFC 7636, code challenges of S256 are 43 characters of it
+var (
+	codeVerifierPattern  = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+	codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+)
+
+// verifyCodeVerifier checks the code_verifier of the token request against the S256 code_challenge of the authorization
+func verifyCodeVerifier(challenge string, verifier string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	hash := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(hash[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,115 @@
+package oidc
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/consent/dto"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Example verifier and challenge of RFC 7636 appendix B
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+var publicClients = StaticClients{"YEP": {"spa": {ID: "spa", Public: true, RedirectURIs: []string{"https://spa.example.com/cb"}, Trusted: true}}}
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+
+	// act & assert
+	a.True(verifyCodeVerifier(testCodeChallenge, testCodeVerifier))
+	a.False(verifyCodeVerifier(testCodeChallenge, strings.ToUpper(testCodeVerifier)))
+	a.False(verifyCodeVerifier(testCodeChallenge, "short"))
+	a.False(verifyCodeVerifier(testCodeChallenge, ""))
+}
+
+func TestParseAuthorizationRequest_whenCodeChallengeNotS256_thenFail(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	base := url.Values{"response_type": {"code"}, "client_id": {"spa"}}
+
+	for name, params := range map[string]url.Values{
+		"plain":          {"code_challenge": {testCodeChallenge}, "code_challenge_method": {"plain"}},
+		"default method": {"code_challenge": {testCodeChallenge}},
+		"malformed":      {"code_challenge": {"too-short"}, "code_challenge_method": {"S256"}},
+		"method only":    {"code_challenge_method": {"S256"}},
+	} {
+		for key, value := range base {
+			params[key] = value
+		}
+
+		// act
+		_, err := ParseAuthorizationRequest("YEP", params)
+
+		// assert
+		a.Error(err, name)
+		a.Equal(ErrorInvalidRequest, err.(*Error).Code, name)
+	}
+}
+
+func TestAuthorize_whenPublicClientSendsNoCodeChallenge_thenRedirectError(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	handler := NewAuthorizationHandler(publicClients, &MockConsentStore{}, staticSession{testSession}, nil, testPages, NewAuthorizationDetailsValidator(paymentTypes), NewClaimsEngine(StaticScopeMappings{}, StaticUserClaims{}), newTestSubjectResolver())
+	w := httptest.NewRecorder()
+
+	// act
+	handler.Authorize(w, authorizeRequest(url.Values{"response_type": {"code"}, "client_id": {"spa"}, "redirect_uri": {"https://spa.example.com/cb"}, "scope": {"openid"}}))
+
+	// assert
+	a.Equal(http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	a.Equal("spa.example.com", location.Host)
+	a.Equal(ErrorInvalidRequest, location.Query().Get("error"))
+}
+
+func TestToken_whenPublicClientRedeemsCode_thenRequireCodeVerifier(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	consents := &MockConsentStore{}
+	consents.On("FindConsent", "YEP", "user-1", "spa").Return((*dto.Consent)(nil), nil)
+	engine := NewClaimsEngine(StaticScopeMappings{}, StaticUserClaims{})
+	authorization := NewAuthorizationHandler(publicClients, consents, staticSession{testSession}, nil, testPages, NewAuthorizationDetailsValidator(paymentTypes), engine, newTestSubjectResolver())
+	tokens := NewTokenHandler(authorization, publicClients, engine, newTestIssuer(StaticSigningAlgorithms{}), newTestSubjectResolver())
+	redeem := func(verifier string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		authorization.Authorize(w, authorizeRequest(url.Values{
+			"response_type":         {"code"},
+			"client_id":             {"spa"},
+			"redirect_uri":          {"https://spa.example.com/cb"},
+			"scope":                 {"openid"},
+			"code_challenge":        {testCodeChallenge},
+			"code_challenge_method": {CodeChallengeMethodS256},
+		}))
+		location, _ := url.Parse(w.Header().Get("Location"))
+		form := url.Values{"grant_type": {"authorization_code"}, "client_id": {"spa"}, "code": {location.Query().Get("code")}, "redirect_uri": {"https://spa.example.com/cb"}}
+		if verifier != "" {
+			form.Set("code_verifier", verifier)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/auth/realm/YEP/protocol/openid-connect/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w = httptest.NewRecorder()
+		tokens.Token(w, mux.SetURLVars(r, map[string]string{"realm": "YEP"}))
+		return w
+	}
+
+	// act
+	missing := redeem("")
+	wrong := redeem(strings.Repeat("a", 43))
+	right := redeem(testCodeVerifier)
+
+	// assert
+	a.Equal(http.StatusBadRequest, missing.Code)
+	a.Contains(missing.Body.String(), ErrorInvalidGrant)
+	a.Equal(http.StatusBadRequest, wrong.Code)
+	a.Contains(wrong.Body.String(), ErrorInvalidGrant)
+	a.Equal(http.StatusOK, right.Code)
+	a.Contains(right.Body.String(), "access_token")
+}
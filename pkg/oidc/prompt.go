@@ -0,0 +1,86 @@
+package oidc
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"net/url"
+	"time"
+)
+
+// ACRLevels ranks authentication context class references by strength
+type ACRLevels map[string]int
+
+// DefaultACRLevels are the levels logins can reach. The password login is the only one and yields "1", there is no
+// second factor yet, so requests asking for stronger levels only are answered with unmet_authentication_requirements.
+var DefaultACRLevels = ACRLevels{
+	"0": 0,
+	"1": 1,
+}
+
+// Satisfies reports whether an authentication performed at acr meets one of the requested acr values. An existing
+// authentication at any requested strength is accepted, as acr_values lists the acceptable values.
+func (al ACRLevels) Satisfies(acr string, requested []string) bool {
+	if len(requested) == 0 || contains(requested, acr) {
+		return true
+	}
+	level, ok := al[acr]
+	if !ok {
+		return false
+	}
+	for _, value := range requested {
+		if known, ok := al[value]; ok && level >= known {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIDTokenHint reads the claims of an id_token_hint. The signature is not verified, because the hint
+// can only narrow down which session may be used and never grants access on its own.
+func parseIDTokenHint(hint string) (jwt.MapClaims, error) {
+	if hint == "" {
+		return nil, nil
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(hint, claims); err != nil {
+		return nil, NewError(ErrorInvalidRequest, "malformed id_token_hint")
+	}
+	if stringClaim(claims, "sub") == "" {
+		return nil, NewError(ErrorInvalidRequest, "id_token_hint without subject")
+	}
+	return claims, nil
+}
+
+// hintMatchesSession reports whether the session belongs to the end-user identified by the id_token_hint
+func hintMatchesSession(hint jwt.MapClaims, session *Session) bool {
+	if stringClaim(hint, "sub") != session.Subject {
+		return false
+	}
+	sid := stringClaim(hint, "sid")
+	return sid == "" || sid == session.ID
+}
+
+// sessionSatisfies reports whether the session may be used for the request without authenticating the user again
+func (ah *authorizationHandler) sessionSatisfies(request *AuthorizationRequest, session *Session, hint jwt.MapClaims, now time.Time) bool {
+	if session == nil {
+		return false
+	}
+	if request.HasPrompt("login") || request.HasPrompt("select_account") {
+		return false
+	}
+	if request.MaxAge != nil && now.Sub(session.AuthTime) > time.Duration(*request.MaxAge)*time.Second {
+		return false
+	}
+	if hint != nil && !hintMatchesSession(hint, session) {
+		return false
+	}
+	return ah.acrLevels.Satisfies(session.ACR, request.ACRValues)
+}
+
+// loginURL points to the login page of the realm carrying the hints of the request
+func loginURL(in *interaction) string {
+	params := url.Values{"interaction": {in.ID}}
+	if in.Request.LoginHint != "" {
+		params.Set("login_hint", in.Request.LoginHint)
+	}
+	return endpointPath(in.Request.Realm, "login") + "?" + params.Encode()
+}
@@ -0,0 +1,154 @@
+package oidc
+
+import (
+	"github.com/NerdShoreDev/YEP/server/pkg/consent/dto"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func authorizeWithSession(session *Session, consents ConsentStore, params url.Values) *url.URL {
+	handler := NewAuthorizationHandler(testClients, consents, staticSession{session}, nil, testPages, NewAuthorizationDetailsValidator(paymentTypes), NewClaimsEngine(StaticScopeMappings{}, StaticUserClaims{}), newTestSubjectResolver())
+	params.Set("response_type", "code")
+	params.Set("client_id", "third-party")
+	params.Set("redirect_uri", "https://client.example.com/cb")
+	w := httptest.NewRecorder()
+	handler.Authorize(w, authorizeRequest(params))
+	location, _ := url.Parse(w.Header().Get("Location"))
+	return location
+}
+
+func TestParseAuthorizationRequest_whenPromptNoneCombined_thenFail(t *testing.T) {
+	// arrange
+	values := url.Values{"client_id": {"c"}, "response_type": {"code"}, "prompt": {"none login"}}
+
+	// act
+	_, err := ParseAuthorizationRequest("YEP", values)
+
+	// assert
+	assert.EqualError(t, err, "invalid_request: prompt none must not be combined with other values")
+}
+
+func TestAuthorize_whenPromptNoneWithoutSession_thenLoginRequired(t *testing.T) {
+	// act
+	location := authorizeWithSession(nil, &MockConsentStore{}, url.Values{"prompt": {"none"}, "state": {"s1"}})
+
+	// assert
+	assert.Equal(t, "login_required", location.Query().Get("error"))
+	assert.Equal(t, "s1", location.Query().Get("state"))
+}
+
+func TestAuthorize_whenPromptNoneWithoutConsent_thenConsentRequired(t *testing.T) {
+	// arrange
+	consents := &MockConsentStore{}
+	consents.On("FindConsent", "YEP", "user-1", "third-party").Return((*dto.Consent)(nil), nil)
+
+	// act
+	location := authorizeWithSession(testSession, consents, url.Values{"prompt": {"none"}, "scope": {"openid"}})
+
+	// assert
+	assert.Equal(t, "consent_required", location.Query().Get("error"))
+}
+
+func TestAuthorize_whenMaxAgeExceeded_thenLoginWithHint(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	session := &Session{ID: "s", Realm: "YEP", Subject: "user-1", AuthTime: time.Now().Add(-time.Hour), ACR: "1"}
+
+	// act
+	location := authorizeWithSession(session, &MockConsentStore{}, url.Values{"max_age": {"300"}, "login_hint": {"jane@example.com"}})
+
+	// assert
+	a.Equal("/auth/realm/YEP/protocol/openid-connect/login", location.Path)
+	a.Equal("jane@example.com", location.Query().Get("login_hint"))
+	a.NotEmpty(location.Query().Get("interaction"))
+}
+
+func TestAuthorize_whenIDTokenHintForOtherUser_thenLoginRequired(t *testing.T) {
+	// arrange
+	hint, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-2"}).SignedString([]byte("secret"))
+
+	// act
+	location := authorizeWithSession(testSession, &MockConsentStore{}, url.Values{"prompt": {"none"}, "id_token_hint": {hint}})
+
+	// assert
+	assert.Equal(t, "login_required", location.Query().Get("error"))
+}
+
+func TestAuthorize_whenACRInsufficient_thenLogin(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	session := &Session{ID: "s", Realm: "YEP", Subject: "user-1", AuthTime: time.Now(), ACR: "0"}
+
+	// act
+	location := authorizeWithSession(session, &MockConsentStore{}, url.Values{"acr_values": {"1 3"}})
+
+	// assert
+	a.Equal("/auth/realm/YEP/protocol/openid-connect/login", location.Path)
+	a.NotEmpty(location.Query().Get("interaction"))
+}
+
+func TestAuthorize_whenLoginCannotReachACR_thenUnmetAuthenticationRequirements(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	session := &Session{ID: "s", Realm: "YEP", Subject: "user-1", AuthTime: time.Now(), ACR: "1"}
+
+	// act
+	location := authorizeWithSession(session, &MockConsentStore{}, url.Values{"acr_values": {"2 3"}, "state": {"xyz"}})
+
+	// assert
+	a.Equal("client.example.com", location.Host)
+	a.Equal(ErrorUnmetAuthenticationRequirements, location.Query().Get("error"))
+	a.Equal("xyz", location.Query().Get("state"))
+}
+
+func TestACRLevels(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+
+	// act & assert
+	a.True(DefaultACRLevels.Satisfies("1", []string{"0"}))
+	a.True(DefaultACRLevels.Satisfies("1", nil))
+	a.False(DefaultACRLevels.Satisfies("1", []string{"2"}))
+	a.False(DefaultACRLevels.Satisfies("", []string{"1"}))
+	a.True(DefaultACRLevels.Satisfies("1", []string{"2", "1"}))
+	a.False(DefaultACRLevels.Satisfies("0", []string{"2", "1"}))
+}
+
+func TestAuthorize_whenSessionReauthenticated_thenGrantCarriesNewAuthTime(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	sessions := NewSessionStore(time.Hour)
+	session := &Session{Realm: "YEP", Subject: "user-1", AuthTime: time.Now().Add(-time.Hour), ACR: "1"}
+	_ = sessions.Create(httptest.NewRecorder(), session)
+	consents := &MockConsentStore{}
+	consents.On("FindConsent", "YEP", "user-1", "first-party").Return((*dto.Consent)(nil), nil)
+	handler := NewAuthorizationHandler(testClients, consents, sessions, nil, testPages, NewAuthorizationDetailsValidator(paymentTypes), NewClaimsEngine(StaticScopeMappings{}, StaticUserClaims{}), newTestSubjectResolver())
+	params := url.Values{"response_type": {"code"}, "client_id": {"first-party"}, "redirect_uri": {"https://yep.example.com/cb"}, "acr_values": {"1"}, "max_age": {"60"}}
+	authorize := func() *url.URL {
+		r := authorizeRequest(params)
+		r.AddCookie(&http.Cookie{Name: sessionCookiePrefix + "YEP", Value: session.ID})
+		w := httptest.NewRecorder()
+		handler.Authorize(w, r)
+		location, _ := url.Parse(w.Header().Get("Location"))
+		return location
+	}
+
+	// act
+	challenged := authorize()
+	reauthenticated, err := sessions.Reauthenticate(session, passwordACR, time.Now())
+	completed := authorize()
+	grant, _ := handler.RedeemCode(completed.Query().Get("code"))
+
+	// assert
+	a.NoError(err)
+	a.Equal("/auth/realm/YEP/protocol/openid-connect/login", challenged.Path)
+	a.Equal(session.ID, reauthenticated.ID)
+	a.Equal(passwordACR, grant.ACR)
+	a.Equal(session.ID, grant.SessionID)
+	a.WithinDuration(time.Now(), grant.AuthTime, time.Second)
+}
@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"context"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// RealmSource looks up a realm by name, nil if there is none
+type RealmSource interface {
+	FindRealm(name string) (*realmDto.Realm, error)
+}
+
+type realmContextKey struct{}
+
+type realmLoader struct {
+	realms RealmSource
+}
+
+// NewRealmLoader creates the middleware loading the realm of the {realm} route variable into the request context
+func NewRealmLoader(realms RealmSource) *realmLoader {
+	return &realmLoader{realms: realms}
+}
+
+// Load answers requests to unknown or disabled realms with 404, the handler finds the realm with RealmFrom
+func (rl *realmLoader) Load(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["realm"]
+		realm, err := rl.realms.FindRealm(name)
+		if err != nil {
+			log.Errorf("unable to load realm %s: %v", name, err)
+			WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if realm == nil || !realm.Enabled {
+			WriteError(w, http.StatusNotFound, NewError(ErrorInvalidRequest, "realm %s not found", name))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithRealm(r.Context(), realm)))
+	})
+}
+
+// WithRealm returns a copy of the context carrying the realm
+func WithRealm(ctx context.Context, realm *realmDto.Realm) context.Context {
+	return context.WithValue(ctx, realmContextKey{}, realm)
+}
+
+// RealmFrom returns the realm the context carries
+func RealmFrom(ctx context.Context) (*realmDto.Realm, bool) {
+	realm, ok := ctx.Value(realmContextKey{}).(*realmDto.Realm)
+	return realm, ok && realm != nil
+}
+
+type realmSigningAlgorithms struct {
+	realms RealmSource
+}
+
+// NewRealmSigningAlgorithms creates the SigningAlgorithmSource reading the algorithm allowlist of the stored realms
+func NewRealmSigningAlgorithms(realms RealmSource) *realmSigningAlgorithms {
+	return &realmSigningAlgorithms{realms: realms}
+}
+
+func (rs *realmSigningAlgorithms) GetSigningAlgorithms(name string) ([]string, error) {
+	realm, err := rs.realms.FindRealm(name)
+	if err != nil {
+		return nil, err
+	}
+	if realm == nil || len(realm.SigningAlgorithms) == 0 {
+		return DefaultSigningAlgorithms, nil
+	}
+	return realm.SigningAlgorithms, nil
+}
+
+type realmScopeMappings struct {
+	realms RealmSource
+}
+
+// NewRealmScopeMappings creates the ScopeMappingSource reading the scope mappings of the stored realms
+func NewRealmScopeMappings(realms RealmSource) *realmScopeMappings {
+	return &realmScopeMappings{realms: realms}
+}
+
+func (rs *realmScopeMappings) GetScopeMappings(name string) ([]ScopeMapping, error) {
+	realm, err := rs.realms.FindRealm(name)
+	if err != nil || realm == nil {
+		return nil, err
+	}
+	mappings := make([]ScopeMapping, 0, len(realm.ScopeMappings))
+	for _, scopeMapping := range realm.ScopeMappings {
+		claims := make([]ClaimMapping, 0, len(scopeMapping.Claims))
+		for _, claimMapping := range scopeMapping.Claims {
+			claims = append(claims, ClaimMapping(claimMapping))
+		}
+		mappings = append(mappings, ScopeMapping{Scope: scopeMapping.Scope, Description: scopeMapping.Description, Claims: claims})
+	}
+	return mappings, nil
+}
+
+type realmAuthorizationDetailTypes struct {
+	realms RealmSource
+}
+
+// NewRealmAuthorizationDetailTypes creates the AuthorizationDetailTypeSource reading the types of the stored realms
+func NewRealmAuthorizationDetailTypes(realms RealmSource) *realmAuthorizationDetailTypes {
+	return &realmAuthorizationDetailTypes{realms: realms}
+}
+
+func (rt *realmAuthorizationDetailTypes) GetAuthorizationDetailTypes(name string) ([]AuthorizationDetailType, error) {
+	realm, err := rt.realms.FindRealm(name)
+	if err != nil || realm == nil {
+		return nil, err
+	}
+	types := make([]AuthorizationDetailType, 0, len(realm.AuthorizationDetailTypes))
+	for _, detailType := range realm.AuthorizationDetailTypes {
+		types = append(types, AuthorizationDetailType(detailType))
+	}
+	return types, nil
+}
+
+// lifetimes returns the token lifetimes of the client in the request's realm. Realms and clients may shorten the
+// server's lifetimes but not exceed them, since those bound how long replaced signing keys stay published.
+func (ti *tokenIssuer) lifetimes(ctx context.Context, client *Client) (time.Duration, time.Duration) {
+	accessTokenLifetime, idTokenLifetime := ti.accessTokenLifetime, ti.idTokenLifetime
+	if realm, ok := RealmFrom(ctx); ok {
+		accessTokenLifetime = shorter(accessTokenLifetime, time.Duration(realm.AccessTokenLifetime)*time.Second)
+		idTokenLifetime = shorter(idTokenLifetime, time.Duration(realm.IDTokenLifetime)*time.Second)
+	}
+	if client != nil {
+		accessTokenLifetime = shorter(accessTokenLifetime, client.AccessTokenLifetime)
+		idTokenLifetime = shorter(idTokenLifetime, client.IDTokenLifetime)
+	}
+	return accessTokenLifetime, idTokenLifetime
+}
+
+// shorter returns the lifetime unless the override is set and shorter
+func shorter(lifetime time.Duration, override time.Duration) time.Duration {
+	if override > 0 && override < lifetime {
+		return override
+	}
+	return lifetime
+}
@@ -0,0 +1,98 @@
+package oidc
+
+import (
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type staticRealms map[string]*realmDto.Realm
+
+func (s staticRealms) FindRealm(name string) (*realmDto.Realm, error) {
+	return s[name], nil
+}
+
+var testRealms = staticRealms{
+	"YEP":      {Name: "YEP", Enabled: true, AccessTokenLifetime: 30, IDTokenLifetime: 3600},
+	"disabled": {Name: "disabled"},
+}
+
+func serveRealm(name string) (*httptest.ResponseRecorder, *realmDto.Realm) {
+	var loaded *realmDto.Realm
+	router := mux.NewRouter()
+	router.PathPrefix("/auth/realm/{realm}").Subrouter().Handle("/protocol/openid-connect/certs", NewRealmLoader(testRealms).Load(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loaded, _ = RealmFrom(r.Context())
+	})))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, endpointPath(name, "certs"), nil))
+	return w, loaded
+}
+
+func TestRealmLoader_whenRealmEnabled_thenLoadIntoContext(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+
+	// act
+	w, realm := serveRealm("YEP")
+
+	// assert
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("YEP", realm.Name)
+}
+
+func TestRealmLoader_whenRealmUnknownOrDisabled_thenNotFound(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+
+	// act
+	unknown, unknownRealm := serveRealm("other")
+	disabled, disabledRealm := serveRealm("disabled")
+
+	// assert
+	a.Equal(http.StatusNotFound, unknown.Code)
+	a.Equal(http.StatusNotFound, disabled.Code)
+	a.Nil(unknownRealm)
+	a.Nil(disabledRealm)
+}
+
+func TestTokenIssuer_whenRealmOrClientSetsLifetimes_thenShortenButNotExceedServerLifetimes(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	issuer := NewTokenIssuer("https://sso.example.com", nil, time.Minute, time.Minute)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// act
+	accessTokenLifetime, idTokenLifetime := issuer.lifetimes(WithRealm(r.Context(), testRealms["YEP"]), nil)
+	defaultAccess, defaultID := issuer.lifetimes(r.Context(), nil)
+	clientAccess, clientID := issuer.lifetimes(WithRealm(r.Context(), testRealms["YEP"]), &Client{AccessTokenLifetime: time.Hour, IDTokenLifetime: 10 * time.Second})
+
+	// assert
+	a.Equal(30*time.Second, accessTokenLifetime)
+	a.Equal(time.Minute, idTokenLifetime)
+	a.Equal(time.Minute, defaultAccess)
+	a.Equal(time.Minute, defaultID)
+	a.Equal(30*time.Second, clientAccess)
+	a.Equal(10*time.Second, clientID)
+}
+
+func TestRealmScopeMappings_whenRealmMapsScopes_thenReturnThem(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	realms := staticRealms{"YEP": {Name: "YEP", Enabled: true, ScopeMappings: []realmDto.ScopeMapping{
+		{Scope: "org", Description: "Read your department", Claims: []realmDto.ClaimMapping{{Claim: "department", Attribute: "department", UserInfo: true}}},
+	}}}
+
+	// act
+	mappings, err := NewRealmScopeMappings(realms).GetScopeMappings("YEP")
+	unknown, unknownErr := NewRealmScopeMappings(realms).GetScopeMappings("other")
+
+	// assert
+	a.NoError(err)
+	a.Equal([]ScopeMapping{{Scope: "org", Description: "Read your department", Claims: []ClaimMapping{{Claim: "department", Attribute: "department", UserInfo: true}}}}, mappings)
+	a.NoError(unknownErr)
+	a.Nil(unknown)
+}
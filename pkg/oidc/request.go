@@ -0,0 +1,112 @@
+package oidc
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// AuthorizationRequest holds the parameters of an authorization or pushed authorization request
+type AuthorizationRequest struct {
+	Realm                string
+	ResponseType         string
+	ClientID             string
+	RedirectURI          string
+	Scopes               []string
+	State                string
+	Nonce                string
+	Prompt               []string
+	MaxAge               *int // seconds since the last active authentication, nil if not restricted
+	LoginHint            string
+	IDTokenHint          string
+	ACRValues            []string
+	Claims               *ClaimsRequest
+	AuthorizationDetails AuthorizationDetails
+	// CodeChallenge is the S256 PKCE challenge the token request has to present the verifier of
+	CodeChallenge string
+}
+
+// ParseAuthorizationRequest reads an authorization request from query or form values
+func ParseAuthorizationRequest(realm string, values url.Values) (*AuthorizationRequest, error) {
+	request := &AuthorizationRequest{
+		Realm:        realm,
+		ResponseType: values.Get("response_type"),
+		ClientID:     values.Get("client_id"),
+		RedirectURI:  values.Get("redirect_uri"),
+		Scopes:       strings.Fields(values.Get("scope")),
+		State:        values.Get("state"),
+		Nonce:        values.Get("nonce"),
+		Prompt:       strings.Fields(values.Get("prompt")),
+		LoginHint:    values.Get("login_hint"),
+		IDTokenHint:  values.Get("id_token_hint"),
+		ACRValues:    strings.Fields(values.Get("acr_values")),
+	}
+
+	if request.ClientID == "" {
+		return nil, NewError(ErrorInvalidRequest, "client_id required")
+	}
+	if request.ResponseType == "" {
+		return nil, NewError(ErrorInvalidRequest, "response_type required")
+	}
+
+	if request.HasPrompt("none") && len(request.Prompt) > 1 {
+		return nil, NewError(ErrorInvalidRequest, "prompt none must not be combined with other values")
+	}
+	if maxAge := values.Get("max_age"); maxAge != "" {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil || seconds < 0 {
+			return nil, NewError(ErrorInvalidRequest, "max_age must be a non-negative number of seconds")
+		}
+		request.MaxAge = &seconds
+	}
+
+	if challenge := values.Get("code_challenge"); challenge != "" {
+		if values.Get("code_challenge_method") != CodeChallengeMethodS256 {
+			return nil, NewError(ErrorInvalidRequest, "code_challenge_method must be %s", CodeChallengeMethodS256)
+		}
+		if !codeChallengePattern.MatchString(challenge) {
+			return nil, NewError(ErrorInvalidRequest, "malformed code_challenge")
+		}
+		request.CodeChallenge = challenge
+	} else if values.Get("code_challenge_method") != "" {
+		return nil, NewError(ErrorInvalidRequest, "code_challenge_method without code_challenge")
+	}
+
+	claims, err := ParseClaimsRequest(values)
+	if err != nil {
+		return nil, err
+	}
+	request.Claims = claims
+	// An acr requested as id_token claim selects the authentication strength like acr_values
+	if acr := claims.Requested(TargetIDToken)["acr"]; acr != nil && len(request.ACRValues) == 0 {
+		request.ACRValues = acr.stringValues()
+	}
+
+	details, err := ParseAuthorizationDetails(values)
+	if err != nil {
+		return nil, err
+	}
+	request.AuthorizationDetails = details
+
+	return request, nil
+}
+
+// HasScope reports whether scope has been requested
+func (ar *AuthorizationRequest) HasScope(scope string) bool {
+	for _, s := range ar.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPrompt reports whether the prompt parameter contains value
+func (ar *AuthorizationRequest) HasPrompt(value string) bool {
+	for _, p := range ar.Prompt {
+		if p == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+const sessionCookiePrefix = "YEP_SESSION_"
+
+// Session is the browser session of an authenticated user within a realm
+type Session struct {
+	ID       string
+	Realm    string
+	Subject  string
+	Username string
+	AuthTime time.Time
+	// ACR is the authentication context class reference the user authenticated with
+	ACR string
+}
+
+type sessionStore struct {
+	sessions *expiringStore
+}
+
+// NewSessionStore creates an in-memory store of browser sessions
+func NewSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{sessions: newExpiringStore(ttl)}
+}
+
+// Create starts a session for the authenticated user and sets the session cookie
+func (ss *sessionStore) Create(w http.ResponseWriter, session *Session) error {
+	id, err := ss.sessions.put(session)
+	if err != nil {
+		return err
+	}
+	session.ID = id
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookiePrefix + session.Realm,
+		Value:    id,
+		Path:     realmPath(session.Realm),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Reauthenticate records that the user of the session authenticated again, e.g. stepping up to a stronger acr.
+// The session keeps its id, so tokens issued before and after share their sid.
+func (ss *sessionStore) Reauthenticate(session *Session, acr string, authTime time.Time) (*Session, error) {
+	reauthenticated := *session
+	reauthenticated.ACR = acr
+	reauthenticated.AuthTime = authTime
+	if !ss.sessions.replace(session.ID, &reauthenticated) {
+		return nil, errors.New("session expired")
+	}
+	return &reauthenticated, nil
+}
+
+// CurrentSession returns the session of the request or nil if the user is not logged in to the realm
+func (ss *sessionStore) CurrentSession(r *http.Request, realm string) (*Session, error) {
+	cookie, err := r.Cookie(sessionCookiePrefix + realm)
+	if err != nil {
+		return nil, nil
+	}
+	value, ok := ss.sessions.get(cookie.Value)
+	if !ok {
+		return nil, nil
+	}
+	session := value.(*Session)
+	if session.Realm != realm {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// Delete ends the session and removes the session cookie
+func (ss *sessionStore) Delete(w http.ResponseWriter, session *Session) {
+	ss.sessions.delete(session.ID)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookiePrefix + session.Realm,
+		Value:    "",
+		Path:     realmPath(session.Realm),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+	})
+}
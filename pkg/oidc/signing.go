@@ -0,0 +1,83 @@
+package oidc
+
+import (
+	"fmt"
+	"github.com/NerdShoreDev/YEP/server/pkg/auth"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// DefaultSigningAlgorithms apply to realms without an algorithm allowlist
+var DefaultSigningAlgorithms = []string{"RS256"}
+
+// supportedSigningAlgorithms are the algorithms realm keys can be generated for. jwt-go knows EdDSA through pkg/auth.
+var supportedSigningAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", auth.SigningMethodEdDSA.Alg()}
+
+// SupportsSigningAlgorithm reports whether realm keys can be generated for the algorithm
+func SupportsSigningAlgorithm(algorithm string) bool {
+	return contains(supportedSigningAlgorithms, algorithm)
+}
+
+// SigningAlgorithmSource provides the signing algorithms a realm allows, the preferred one first
+type SigningAlgorithmSource interface {
+	GetSigningAlgorithms(realm string) ([]string, error)
+}
+
+// StaticSigningAlgorithms is a SigningAlgorithmSource keyed by realm
+type StaticSigningAlgorithms map[string][]string
+
+func (s StaticSigningAlgorithms) GetSigningAlgorithms(realm string) ([]string, error) {
+	if algorithms, ok := s[realm]; ok {
+		return algorithms, nil
+	}
+	return DefaultSigningAlgorithms, nil
+}
+
+// sign signs the claims with the preferred algorithm of the realm
+func (ti *tokenIssuer) sign(realm string, claims jwt.MapClaims) (string, error) {
+	return ti.signWith(realm, "", claims)
+}
+
+// signWith signs the claims with the given algorithm, which the realm must allow. An empty algorithm picks the realm's preferred one.
+func (ti *tokenIssuer) signWith(realm string, algorithm string, claims jwt.MapClaims) (string, error) {
+	algorithms, err := ti.keys.Algorithms(realm)
+	if err != nil {
+		return "", err
+	}
+	if len(algorithms) == 0 {
+		return "", fmt.Errorf("realm %s allows no supported signing algorithm", realm)
+	}
+	if algorithm == "" {
+		algorithm = algorithms[0]
+	}
+	if !contains(algorithms, algorithm) {
+		return "", fmt.Errorf("signing algorithm %s is not allowed in realm %s", algorithm, realm)
+	}
+
+	signer, err := ti.keys.ActiveKey(realm, algorithm)
+	if err != nil {
+		return "", err
+	}
+	return auth.SignToken(signer, claims)
+}
+
+// verificationKey is the jwt.Keyfunc of parse, accepting only algorithms the realm allows
+func (ti *tokenIssuer) verificationKey(realm string) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		algorithms, err := ti.keys.Algorithms(realm)
+		if err != nil {
+			return nil, err
+		}
+		if !contains(algorithms, token.Method.Alg()) {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		signer, err := ti.keys.VerificationKey(realm, kid)
+		if err != nil {
+			return nil, err
+		}
+		if signer.Algorithm() != token.Method.Alg() {
+			return nil, fmt.Errorf("key %s is not meant for %s", kid, token.Method.Alg())
+		}
+		return signer.Public(), nil
+	}
+}
@@ -0,0 +1,63 @@
+package oidc
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newTestIssuer(algorithms StaticSigningAlgorithms) *tokenIssuer {
+	keys := NewKeyManager(newMemoryKeyStore(), NewLocalKeyBackend(newTestKeyWrapper(testKEK)), algorithms, time.Hour, time.Minute)
+	return NewTokenIssuer("https://sso.example.com", keys, time.Minute, time.Minute)
+}
+
+func TestTokenIssuer_whenRealmPrefersAlgorithm_thenSignWithIt(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	issuer := newTestIssuer(StaticSigningAlgorithms{"YEP": {"ES256", "EdDSA"}, "Edwards": {"EdDSA"}})
+
+	for realm, algorithm := range map[string]string{"YEP": "ES256", "Edwards": "EdDSA", "Default": "RS256"} {
+		claims := jwt.MapClaims{"iss": issuer.Issuer(realm), "typ": TokenTypeBearer}
+
+		// act
+		signed, err := issuer.sign(realm, claims)
+		parsed, parseErr := issuer.parse(realm, signed, TokenTypeBearer)
+		token, _, _ := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+
+		// assert
+		a.NoError(err)
+		a.NoError(parseErr)
+		a.Equal(issuer.Issuer(realm), parsed["iss"])
+		a.Equal(algorithm, token.Header["alg"])
+	}
+}
+
+func TestTokenIssuer_whenAlgorithmNotAllowedInRealm_thenReject(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	issuer := newTestIssuer(StaticSigningAlgorithms{"YEP": {"ES256", "PS256"}, "Strict": {"ES256"}})
+	claims := jwt.MapClaims{"iss": issuer.Issuer("Strict"), "typ": TokenTypeBearer}
+
+	// act
+	signed, signErr := issuer.signWith("YEP", "PS256", claims)
+	_, parseErr := issuer.parse("Strict", signed, TokenTypeBearer)
+	_, disallowedErr := issuer.signWith("Strict", "RS256", claims)
+
+	// assert
+	a.NoError(signErr)
+	a.Error(parseErr)
+	a.Contains(parseErr.Error(), "unexpected signing method")
+	a.Error(disallowedErr)
+}
+
+func TestTokenIssuer_whenNoSupportedAlgorithmInRealm_thenFail(t *testing.T) {
+	// arrange
+	issuer := newTestIssuer(StaticSigningAlgorithms{"YEP": {"HS256"}})
+
+	// act
+	_, err := issuer.sign("YEP", jwt.MapClaims{})
+
+	// assert
+	assert.Error(t, err)
+}
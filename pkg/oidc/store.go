@@ -0,0 +1,97 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// expiringStore keeps short lived protocol state like interactions and authorization codes in memory
+type expiringStore struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]expiringEntry
+}
+
+type expiringEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newExpiringStore(ttl time.Duration) *expiringStore {
+	return &expiringStore{
+		ttl:     ttl,
+		entries: map[string]expiringEntry{},
+	}
+}
+
+// put stores value under a new random key and returns the key
+func (es *expiringStore) put(value interface{}) (string, error) {
+	key, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	es.evictExpired()
+	es.entries[key] = expiringEntry{value: value, expires: time.Now().Add(es.ttl)}
+	return key, nil
+}
+
+func (es *expiringStore) get(key string) (interface{}, bool) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	entry, ok := es.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// replace stores a new value under an existing key, keeping its expiry
+func (es *expiringStore) replace(key string, value interface{}) bool {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	entry, ok := es.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return false
+	}
+	es.entries[key] = expiringEntry{value: value, expires: entry.expires}
+	return true
+}
+
+// take returns and removes the value, so it can be used only once
+func (es *expiringStore) take(key string) (interface{}, bool) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	entry, ok := es.entries[key]
+	delete(es.entries, key)
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (es *expiringStore) delete(key string) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	delete(es.entries, key)
+}
+
+func (es *expiringStore) evictExpired() {
+	now := time.Now()
+	for key, entry := range es.entries {
+		if now.After(entry.expires) {
+			delete(es.entries, key)
+		}
+	}
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
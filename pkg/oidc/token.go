@@ -0,0 +1,292 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Token type claims telling access tokens and ID tokens apart
+const (
+	TokenTypeBearer = "Bearer"
+	TokenTypeID     = "ID"
+)
+
+// claimUserInfoRequest carries the userinfo part of the claims request parameter inside the access token
+const claimUserInfoRequest = "userinfo_claims"
+
+// CodeRedeemer exchanges authorization codes for their grants
+type CodeRedeemer interface {
+	RedeemCode(code string) (*Grant, bool)
+}
+
+// TokenResponse is the successful response of the token endpoint
+type TokenResponse struct {
+	AccessToken          string               `json:"access_token"`
+	TokenType            string               `json:"token_type"`
+	ExpiresIn            int64                `json:"expires_in"`
+	IDToken              string               `json:"id_token,omitempty"`
+	Scope                string               `json:"scope,omitempty"`
+	AuthorizationDetails AuthorizationDetails `json:"authorization_details,omitempty"`
+}
+
+type tokenIssuer struct {
+	baseURL             string
+	keys                *keyManager
+	accessTokenLifetime time.Duration
+	idTokenLifetime     time.Duration
+}
+
+// NewTokenIssuer creates the issuer signing the tokens of all realms with the realm keys of the key manager
+func NewTokenIssuer(baseURL string, keys *keyManager, accessTokenLifetime time.Duration, idTokenLifetime time.Duration) *tokenIssuer {
+	return &tokenIssuer{
+		baseURL:             strings.TrimSuffix(baseURL, "/"),
+		keys:                keys,
+		accessTokenLifetime: accessTokenLifetime,
+		idTokenLifetime:     idTokenLifetime,
+	}
+}
+
+// Issuer returns the issuer identifier of the realm
+func (ti *tokenIssuer) Issuer(realm string) string {
+	return ti.baseURL + realmPath(realm)
+}
+
+// parse verifies a token issued for the realm and returns its claims
+func (ti *tokenIssuer) parse(realm string, tokenString string, tokenType string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, ti.verificationKey(realm))
+	if err != nil {
+		return nil, err
+	}
+	if claims["iss"] != ti.Issuer(realm) {
+		return nil, fmt.Errorf("unauthorized issuer")
+	}
+	if claims["typ"] != tokenType {
+		return nil, fmt.Errorf("unexpected token type %v", claims["typ"])
+	}
+	return claims, nil
+}
+
+type tokenHandler struct {
+	codes    CodeRedeemer
+	clients  ClientLookup
+	claims   *claimsEngine
+	issuer   *tokenIssuer
+	subjects *subjectResolver
+}
+
+// NewTokenHandler creates the handler of the token, userinfo, introspection and discovery endpoints
+func NewTokenHandler(codes CodeRedeemer, clients ClientLookup, claims *claimsEngine, issuer *tokenIssuer, subjects *subjectResolver) *tokenHandler {
+	return &tokenHandler{
+		codes:    codes,
+		clients:  clients,
+		claims:   claims,
+		issuer:   issuer,
+		subjects: subjects,
+	}
+}
+
+// Token handles the token endpoint
+func (th *tokenHandler) Token(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	if err := r.ParseForm(); err != nil {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidRequest, "malformed request"))
+		return
+	}
+
+	client, err := authenticateClient(th.clients, realm, r)
+	if err != nil {
+		log.Debugf("Token: client authentication failed: %v", err)
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`"`)
+		WriteError(w, http.StatusUnauthorized, NewError(ErrorInvalidClient, "client authentication failed"))
+		return
+	}
+
+	// Browsers only hand the response to scripts of the client's web origins
+	if origin := r.Header.Get("Origin"); client.AllowsOrigin(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	}
+	grantType := r.PostForm.Get("grant_type")
+	if grantType != "" && contains(SupportedGrantTypes, grantType) && !client.AllowsGrantType(grantType) {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorUnauthorizedClient, "client may not use grant_type %s", grantType))
+		return
+	}
+	switch grantType {
+	case GrantTypeAuthorizationCode:
+		th.exchangeCode(w, r, realm, client)
+	default:
+		WriteError(w, http.StatusBadRequest, NewError(ErrorUnsupportedGrantType, "grant_type %s not supported", grantType))
+	}
+}
+
+func (th *tokenHandler) exchangeCode(w http.ResponseWriter, r *http.Request, realm string, client *Client) {
+	grant, ok := th.codes.RedeemCode(r.PostForm.Get("code"))
+	if !ok || grant.Request.Realm != realm || grant.Request.ClientID != client.ID {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidGrant, "invalid or expired authorization code"))
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != grant.Request.RedirectURI {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidGrant, "redirect_uri mismatch"))
+		return
+	}
+	if grant.Request.CodeChallenge == "" && client.Public {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidGrant, "authorization code of a public client without code_challenge"))
+		return
+	}
+	if grant.Request.CodeChallenge != "" && !verifyCodeVerifier(grant.Request.CodeChallenge, r.PostForm.Get("code_verifier")) {
+		WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidGrant, "code_verifier does not match the code_challenge"))
+		return
+	}
+
+	// Clients may narrow down the granted authorization details for the access token
+	details := grant.AuthorizationDetails
+	requested, err := ParseAuthorizationDetails(r.PostForm)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(requested) > 0 {
+		if !grant.AuthorizationDetails.Covers(requested) {
+			WriteError(w, http.StatusBadRequest, NewError(ErrorInvalidAuthorizationDetails, "authorization_details exceed the grant"))
+			return
+		}
+		details = requested
+	}
+
+	response, err := th.issueTokens(r.Context(), realm, client, grant, details)
+	if err != nil {
+		log.Errorf("unable to issue tokens: %v", err)
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (th *tokenHandler) issueTokens(ctx context.Context, realm string, client *Client, grant *Grant, details AuthorizationDetails) (*TokenResponse, error) {
+	now := time.Now()
+	accessTokenLifetime, idTokenLifetime := th.issuer.lifetimes(ctx, client)
+	jti, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	subject, err := th.subjects.SubjectFor(realm, client, grant.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	accessClaims := jwt.MapClaims{
+		"iss":       th.issuer.Issuer(realm),
+		"sub":       subject,
+		"aud":       client.ID,
+		"azp":       client.ID,
+		"typ":       TokenTypeBearer,
+		"iat":       now.Unix(),
+		"exp":       now.Add(accessTokenLifetime).Unix(),
+		"jti":       jti,
+		"scope":     strings.Join(grant.Scopes, " "),
+		"sid":       grant.SessionID,
+		"auth_time": grant.AuthTime.Unix(),
+	}
+	if grant.ACR != "" {
+		accessClaims["acr"] = grant.ACR
+	}
+	details.AddToClaims(accessClaims)
+	if userInfo := grant.Request.Claims.Requested(TargetUserInfo); len(userInfo) > 0 {
+		accessClaims[claimUserInfoRequest] = userInfo
+	}
+	accessToken, err := th.issuer.sign(realm, accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &TokenResponse{
+		AccessToken:          accessToken,
+		TokenType:            TokenTypeBearer,
+		ExpiresIn:            int64(accessTokenLifetime.Seconds()),
+		Scope:                strings.Join(grant.Scopes, " "),
+		AuthorizationDetails: details,
+	}
+	if contains(grant.Scopes, "openid") {
+		if response.IDToken, err = th.issueIDToken(realm, client, grant, subject, now, idTokenLifetime); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+func (th *tokenHandler) issueIDToken(realm string, client *Client, grant *Grant, subject string, now time.Time, lifetime time.Duration) (string, error) {
+	released, err := th.claims.Resolve(realm, grant.Subject, grant.Scopes, grant.Request.Claims.Requested(TargetIDToken), TargetIDToken)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	for name, value := range released {
+		claims[name] = value
+	}
+	claims["iss"] = th.issuer.Issuer(realm)
+	claims["sub"] = subject
+	claims["aud"] = client.ID
+	claims["azp"] = client.ID
+	claims["typ"] = TokenTypeID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(lifetime).Unix()
+	claims["auth_time"] = grant.AuthTime.Unix()
+	claims["sid"] = grant.SessionID
+	if grant.ACR != "" {
+		claims["acr"] = grant.ACR
+	}
+	if grant.Request.Nonce != "" {
+		claims["nonce"] = grant.Request.Nonce
+	}
+	idToken, err := th.issuer.signWith(realm, client.IDTokenSignedResponseAlg, claims)
+	if err != nil || client.IDTokenEncryptedResponseAlg == "" {
+		return idToken, err
+	}
+	return encrypt(client, client.IDTokenEncryptedResponseAlg, client.IDTokenEncryptedResponseEnc, []byte(idToken), true)
+}
+
+// authenticateClient checks client_secret_basic or client_secret_post credentials of token and pushed authorization
+// requests. Public clients only identify themselves.
+func authenticateClient(clients ClientLookup, realm string, r *http.Request) (*Client, error) {
+	clientID, secret, basic := r.BasicAuth()
+	method := AuthMethodClientSecretBasic
+	if basic {
+		// RFC 6749 requires the credentials to be form-urlencoded before they are put into the header
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+		method = AuthMethodClientSecretPost
+	}
+	if clientID == "" {
+		return nil, fmt.Errorf("client_id missing")
+	}
+
+	client, err := clients.GetClient(realm, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return client, nil
+	}
+	if client.TokenEndpointAuthMethod != "" && client.TokenEndpointAuthMethod != method {
+		return nil, fmt.Errorf("client %s must authenticate with %s", clientID, client.TokenEndpointAuthMethod)
+	}
+	if !client.VerifySecret(secret, time.Now()) {
+		return nil, fmt.Errorf("invalid secret for client %s", clientID)
+	}
+	return client, nil
+}
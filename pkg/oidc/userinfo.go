@@ -0,0 +1,106 @@
+package oidc
+
+import (
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// UserInfo handles the userinfo endpoint
+func (th *tokenHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	realm := mux.Vars(r)["realm"]
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if accessToken == "" {
+		accessToken = r.PostFormValue("access_token")
+	}
+
+	claims, err := th.issuer.parse(realm, accessToken, TokenTypeBearer)
+	if err != nil {
+		log.Debugf("UserInfo: access token validation error: %v", err)
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	requested, err := userInfoRequestFromClaims(claims)
+	if err != nil {
+		log.Errorf("malformed userinfo claims request in access token: %v", err)
+	}
+	subject := stringClaim(claims, "sub")
+	localSubject, err := th.subjects.LocalSubject(realm, subject)
+	if err != nil {
+		log.Errorf("unable to resolve subject: %v", err)
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	released, err := th.claims.Resolve(realm, localSubject, strings.Fields(stringClaim(claims, "scope")), requested, TargetUserInfo)
+	if err != nil {
+		log.Errorf("unable to resolve userinfo claims: %v", err)
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	released["sub"] = subject
+
+	w.Header().Set("Cache-Control", "no-store")
+	client, err := th.clients.GetClient(realm, stringClaim(claims, "azp"))
+	if err != nil {
+		log.Debugf("UserInfo: client of access token not found: %v", err)
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if client.UserInfoSignedResponseAlg == "" && client.UserInfoEncryptedResponseAlg == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(released)
+		return
+	}
+
+	response, err := th.userInfoJWT(realm, client, released)
+	if err != nil {
+		log.Errorf("unable to protect userinfo response for client %s: %v", client.ID, err)
+		WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwt")
+	w.Write([]byte(response))
+}
+
+// userInfoJWT signs and/or encrypts the userinfo claims as registered by the client
+func (th *tokenHandler) userInfoJWT(realm string, client *Client, released map[string]interface{}) (string, error) {
+	if client.UserInfoSignedResponseAlg == "" {
+		payload, err := json.Marshal(released)
+		if err != nil {
+			return "", err
+		}
+		return encrypt(client, client.UserInfoEncryptedResponseAlg, client.UserInfoEncryptedResponseEnc, payload, false)
+	}
+
+	claims := jwt.MapClaims{}
+	for name, value := range released {
+		claims[name] = value
+	}
+	claims["iss"] = th.issuer.Issuer(realm)
+	claims["aud"] = client.ID
+	signed, err := th.issuer.signWith(realm, client.UserInfoSignedResponseAlg, claims)
+	if err != nil || client.UserInfoEncryptedResponseAlg == "" {
+		return signed, err
+	}
+	return encrypt(client, client.UserInfoEncryptedResponseAlg, client.UserInfoEncryptedResponseEnc, []byte(signed), true)
+}
+
+func userInfoRequestFromClaims(claims jwt.MapClaims) (map[string]*ClaimRequest, error) {
+	value, ok := claims[claimUserInfoRequest]
+	if !ok {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var requested map[string]*ClaimRequest
+	err = json.Unmarshal(encoded, &requested)
+	return requested, err
+}
@@ -0,0 +1,12 @@
+package dto
+
+import "time"
+
+// PairwiseSubject maps the subject identifier a sector sees to the user it stands for
+type PairwiseSubject struct {
+	Realm           string    `bson:"realm" json:"realm"`
+	Sector          string    `bson:"sector" json:"sector"`
+	Subject         string    `bson:"subject" json:"subject"`
+	PairwiseSubject string    `bson:"pairwiseSubject" json:"pairwiseSubject"`
+	CreatedAt       time.Time `bson:"createdAt" json:"createdAt"`
+}
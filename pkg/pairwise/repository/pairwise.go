@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/pairwise/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const pairwiseCollection = "pairwise_subjects"
+
+type pairwiseStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewPairwiseStorage creates the Mongo backed storage of pairwise subject identifiers
+func NewPairwiseStorage(dbWrapper *db.DatabaseWrapper) *pairwiseStorage {
+	return &pairwiseStorage{
+		collection:   dbWrapper.Database.Collection(pairwiseCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique index on realm and pairwise subject
+func (ps *pairwiseStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), ps.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := ps.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "realm", Value: 1}, {Key: "pairwiseSubject", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// SavePairwiseSubject remembers the user behind a pairwise subject identifier
+func (ps *pairwiseStorage) SavePairwiseSubject(realm string, sector string, subject string, pairwiseSubject string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ps.queryTimeout*time.Second)
+	defer cancel()
+
+	filter := bson.M{"realm": realm, "pairwiseSubject": pairwiseSubject}
+	update := bson.M{"$setOnInsert": dto.PairwiseSubject{
+		Realm:           realm,
+		Sector:          sector,
+		Subject:         subject,
+		PairwiseSubject: pairwiseSubject,
+		CreatedAt:       time.Now().UTC(),
+	}}
+	_, err := ps.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// FindSubject returns the user behind a pairwise subject identifier or an empty string if it is unknown
+func (ps *pairwiseStorage) FindSubject(realm string, pairwiseSubject string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ps.queryTimeout*time.Second)
+	defer cancel()
+
+	var mapping dto.PairwiseSubject
+	err := ps.collection.FindOne(ctx, bson.M{"realm": realm, "pairwiseSubject": pairwiseSubject}).Decode(&mapping)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return mapping.Subject, nil
+}
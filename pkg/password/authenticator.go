@@ -0,0 +1,203 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	credentialDto "github.com/NerdShoreDev/YEP/server/pkg/credential/dto"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidCredentials is returned alike for unknown users, users without password and wrong passwords
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrUserDisabled is only returned once the password was right
+	ErrUserDisabled = errors.New("user disabled")
+	// ErrPasswordExpired is returned together with the user, who has to choose a new password before going on
+	ErrPasswordExpired = errors.New("password expired")
+)
+
+type RealmSource interface {
+	FindRealm(name string) (*realmDto.Realm, error)
+}
+
+type UserFinder interface {
+	FindUserByUsername(realm string, username string) (*userDto.User, error)
+	FindUserByEmail(realm string, email string) (*userDto.User, error)
+}
+
+type PasswordStore interface {
+	FindPassword(realm string, userID string) (*credentialDto.Credential, error)
+	SetPassword(realm string, userID string, password *credentialDto.Password) error
+}
+
+type passwordAuthenticator struct {
+	realms    RealmSource
+	users     UserFinder
+	passwords PasswordStore
+	breached  BreachedList
+	// dummyHashes are verified for unknown users, keyed by Params, so failing takes as long as for known users
+	dummyHashes sync.Map
+}
+
+// NewPasswordAuthenticator creates the authenticator checking and setting the passwords of realm users. breached may be
+// nil if there is no denylist of breached passwords.
+func NewPasswordAuthenticator(realms RealmSource, users UserFinder, passwords PasswordStore, breached BreachedList) *passwordAuthenticator {
+	return &passwordAuthenticator{realms: realms, users: users, passwords: passwords, breached: breached}
+}
+
+// Authenticate checks the password of the user with the username or email. Hashes of another algorithm or with other
+// parameters than the realm's are replaced once the password matched.
+func (pa *passwordAuthenticator) Authenticate(realm string, username string, password string) (*userDto.User, error) {
+	settings, err := pa.realm(realm)
+	if err != nil {
+		return nil, err
+	}
+	params := ParamsOf(settings.PasswordHashing)
+	user, err := pa.findUser(realm, username)
+	if err != nil {
+		return nil, err
+	}
+	var stored *credentialDto.Password
+	if user != nil {
+		credential, err := pa.passwords.FindPassword(realm, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if credential != nil && credential.Password != nil && credential.Password.Hash != "" {
+			stored = credential.Password
+		}
+	}
+	encoded := ""
+	if stored != nil {
+		encoded = stored.Hash
+	} else {
+		user = nil
+		if encoded, err = pa.dummyHash(params); err != nil {
+			return nil, err
+		}
+	}
+
+	match, outdated, err := Verify(encoded, password, params)
+	if err != nil {
+		// only stored hashes can be malformed, the dummy hash is not
+		log.Errorf("unable to verify password of user %s of realm %s: %v", user.ID, realm, err)
+		return nil, ErrInvalidCredentials
+	}
+	if !match || user == nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !user.Enabled {
+		return nil, ErrUserDisabled
+	}
+	if outdated {
+		pa.rehash(realm, user.ID, password, params, stored)
+	}
+	if Expired(settings.PasswordPolicy, stored, time.Now()) {
+		return user, ErrPasswordExpired
+	}
+	return user, nil
+}
+
+// SetPassword gives the user a new password, which has to comply with the realm's password policy. Every way of
+// setting a password should go through it.
+func (pa *passwordAuthenticator) SetPassword(realm string, user *userDto.User, password string) error {
+	settings, err := pa.realm(realm)
+	if err != nil {
+		return err
+	}
+	policy := settings.PasswordPolicy
+	violations := CheckPolicy(policy, user, password, pa.breached)
+
+	history := []string{}
+	credential, err := pa.passwords.FindPassword(realm, user.ID)
+	if err != nil {
+		return err
+	}
+	if credential != nil && credential.Password != nil && policy.History > 0 {
+		history = append([]string{credential.Password.Hash}, credential.Password.History...)
+		if len(history) > policy.History {
+			history = history[:policy.History]
+		}
+		if pa.reused(history, password) {
+			violations = append(violations, fmt.Sprintf("password must differ from the last %d passwords", policy.History))
+		}
+		// the new password is one of the last passwords from now on
+		if len(history) == policy.History {
+			history = history[:policy.History-1]
+		}
+	}
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	encoded, err := Hash(password, ParamsOf(settings.PasswordHashing))
+	if err != nil {
+		return err
+	}
+	return pa.passwords.SetPassword(realm, user.ID, &credentialDto.Password{Hash: encoded, ChangedAt: time.Now().UTC(), History: history})
+}
+
+// reused reports whether the password matches one of the hashes
+func (pa *passwordAuthenticator) reused(hashes []string, password string) bool {
+	for _, encoded := range hashes {
+		if match, _, err := Verify(encoded, password, DefaultParams); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
+// realm returns the settings of the realm, the defaults for unknown realms
+func (pa *passwordAuthenticator) realm(name string) (*realmDto.Realm, error) {
+	settings, err := pa.realms.FindRealm(name)
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil {
+		return &realmDto.Realm{Name: name}, nil
+	}
+	return settings, nil
+}
+
+// findUser looks the login up as username first and as email if it looks like one
+func (pa *passwordAuthenticator) findUser(realm string, login string) (*userDto.User, error) {
+	user, err := pa.users.FindUserByUsername(realm, login)
+	if err != nil || user != nil || !strings.Contains(login, "@") {
+		return user, err
+	}
+	return pa.users.FindUserByEmail(realm, login)
+}
+
+func (pa *passwordAuthenticator) dummyHash(params Params) (string, error) {
+	if encoded, ok := pa.dummyHashes.Load(params); ok {
+		return encoded.(string), nil
+	}
+	encoded, err := Hash("dummy password of unknown users", params)
+	if err != nil {
+		return "", err
+	}
+	pa.dummyHashes.Store(params, encoded)
+	return encoded, nil
+}
+
+// rehash upgrades the stored hash, keeping the age and history of the password. Passwords of unknown age start aging
+// now. Failing only postpones the upgrade to the next login, so the login goes on.
+func (pa *passwordAuthenticator) rehash(realm string, userID string, password string, params Params, stored *credentialDto.Password) {
+	upgraded := *stored
+	if upgraded.ChangedAt.IsZero() {
+		upgraded.ChangedAt = time.Now().UTC()
+	}
+	encoded, err := Hash(password, params)
+	if err == nil {
+		upgraded.Hash = encoded
+		err = pa.passwords.SetPassword(realm, userID, &upgraded)
+	}
+	if err != nil {
+		log.Warnf("unable to upgrade password hash of user %s of realm %s: %v", userID, realm, err)
+	}
+}
@@ -0,0 +1,174 @@
+package password
+
+import (
+	credentialDto "github.com/NerdShoreDev/YEP/server/pkg/credential/dto"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+)
+
+type MockUserFinder struct {
+	mock.Mock
+}
+
+func (mock *MockUserFinder) FindUserByUsername(realm string, username string) (*userDto.User, error) {
+	args := mock.Called(realm, username)
+	return args.Get(0).(*userDto.User), args.Error(1)
+}
+
+func (mock *MockUserFinder) FindUserByEmail(realm string, email string) (*userDto.User, error) {
+	args := mock.Called(realm, email)
+	return args.Get(0).(*userDto.User), args.Error(1)
+}
+
+type MockPasswordStore struct {
+	mock.Mock
+}
+
+func (mock *MockPasswordStore) FindPassword(realm string, userID string) (*credentialDto.Credential, error) {
+	args := mock.Called(realm, userID)
+	return args.Get(0).(*credentialDto.Credential), args.Error(1)
+}
+
+func (mock *MockPasswordStore) SetPassword(realm string, userID string, password *credentialDto.Password) error {
+	return mock.Called(realm, userID, password).Error(0)
+}
+
+type staticRealms map[string]*realmDto.Realm
+
+func (s staticRealms) FindRealm(name string) (*realmDto.Realm, error) {
+	return s[name], nil
+}
+
+var testRealms = staticRealms{
+	"YEP": {Name: "YEP", Enabled: true, PasswordHashing: realmDto.PasswordHashing{Memory: 1024, Iterations: 1}},
+	"strict": {Name: "strict", Enabled: true, PasswordHashing: realmDto.PasswordHashing{Memory: 1024, Iterations: 1}, PasswordPolicy: realmDto.PasswordPolicy{
+		MinLength: 10, RequireDigit: true, NotUsername: true, History: 2, MaxAgeDays: 90, NotBreached: true,
+	}},
+}
+
+type staticBreachedList []string
+
+func (s staticBreachedList) Contains(password string) bool {
+	for _, breached := range s {
+		if breached == password {
+			return true
+		}
+	}
+	return false
+}
+
+func passwordCredential(encoded string, changedAt time.Time) *credentialDto.Credential {
+	return &credentialDto.Credential{Type: credentialDto.TypePassword, Password: &credentialDto.Password{Hash: encoded, ChangedAt: changedAt}}
+}
+
+func TestPasswordAuthenticator_whenHashOutdated_thenUpgradeToArgon2id(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	users, passwords := &MockUserFinder{}, &MockPasswordStore{}
+	imported, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	users.On("FindUserByUsername", "YEP", "anna@example.com").Return((*userDto.User)(nil), nil)
+	users.On("FindUserByEmail", "YEP", "anna@example.com").Return(&userDto.User{ID: "user-1", Enabled: true}, nil)
+	passwords.On("FindPassword", "YEP", "user-1").Return(passwordCredential(string(imported), time.Time{}), nil)
+	var upgraded *credentialDto.Password
+	passwords.On("SetPassword", "YEP", "user-1", mock.Anything).Run(func(args mock.Arguments) {
+		upgraded = args.Get(2).(*credentialDto.Password)
+	}).Return(nil)
+
+	// act
+	user, err := NewPasswordAuthenticator(testRealms, users, passwords, nil).Authenticate("YEP", "anna@example.com", "s3cret")
+
+	// assert
+	a.NoError(err)
+	a.Equal("user-1", user.ID)
+	match, outdated, _ := Verify(upgraded.Hash, "s3cret", testParams)
+	a.True(match)
+	a.False(outdated)
+}
+
+func TestPasswordAuthenticator_whenUserUnknownOrPasswordWrong_thenSameError(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	users, passwords := &MockUserFinder{}, &MockPasswordStore{}
+	encoded, _ := Hash("s3cret", testParams)
+	users.On("FindUserByUsername", "YEP", "anna").Return(&userDto.User{ID: "user-1", Enabled: true}, nil)
+	users.On("FindUserByUsername", "YEP", "bob").Return((*userDto.User)(nil), nil)
+	users.On("FindUserByUsername", "YEP", "carl").Return(&userDto.User{ID: "user-3", Enabled: true}, nil)
+	users.On("FindUserByUsername", "YEP", "dora").Return(&userDto.User{ID: "user-4"}, nil)
+	passwords.On("FindPassword", "YEP", "user-1").Return(passwordCredential(encoded, time.Now()), nil)
+	passwords.On("FindPassword", "YEP", "user-3").Return((*credentialDto.Credential)(nil), nil)
+	passwords.On("FindPassword", "YEP", "user-4").Return(passwordCredential(encoded, time.Now()), nil)
+	authenticator := NewPasswordAuthenticator(testRealms, users, passwords, nil)
+
+	// act
+	_, wrong := authenticator.Authenticate("YEP", "anna", "wrong")
+	_, unknown := authenticator.Authenticate("YEP", "bob", "s3cret")
+	_, noPassword := authenticator.Authenticate("YEP", "carl", "")
+	_, disabledWrong := authenticator.Authenticate("YEP", "dora", "wrong")
+	_, disabled := authenticator.Authenticate("YEP", "dora", "s3cret")
+
+	// assert
+	a.Equal(ErrInvalidCredentials, wrong)
+	a.Equal(ErrInvalidCredentials, unknown)
+	a.Equal(ErrInvalidCredentials, noPassword)
+	a.Equal(ErrInvalidCredentials, disabledWrong)
+	a.Equal(ErrUserDisabled, disabled)
+	passwords.AssertNotCalled(t, "SetPassword", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPasswordAuthenticator_whenNewPasswordBreaksPolicy_thenRejectNamingAllRules(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	users, passwords := &MockUserFinder{}, &MockPasswordStore{}
+	user := &userDto.User{ID: "user-1", Username: "Anna", Enabled: true}
+	current, _ := Hash("current password 1", testParams)
+	previous, _ := Hash("previous password 1", testParams)
+	oldest, _ := Hash("oldest password 1", testParams)
+	passwords.On("FindPassword", "strict", "user-1").Return(&credentialDto.Credential{Password: &credentialDto.Password{Hash: current, History: []string{previous, oldest}}}, nil)
+	var stored *credentialDto.Password
+	passwords.On("SetPassword", "strict", "user-1", mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(2).(*credentialDto.Password)
+	}).Return(nil)
+	authenticator := NewPasswordAuthenticator(testRealms, users, passwords, staticBreachedList{"password123"})
+
+	// act
+	short := authenticator.SetPassword("strict", user, "anna")
+	breached := authenticator.SetPassword("strict", user, "password123")
+	reused := authenticator.SetPassword("strict", user, "previous password 1")
+	oldestAgain := authenticator.SetPassword("strict", user, "oldest password 1")
+
+	// assert
+	a.Equal(&PolicyError{Violations: []string{
+		"password must be at least 10 characters long", "password must contain a digit", "password must not contain the username or email",
+	}}, short)
+	a.Equal(&PolicyError{Violations: []string{"password appears in a data breach, choose another one"}}, breached)
+	a.Equal(&PolicyError{Violations: []string{"password must differ from the last 2 passwords"}}, reused)
+	a.NoError(oldestAgain)
+	a.Equal([]string{current}, stored.History)
+	a.WithinDuration(time.Now(), stored.ChangedAt, time.Minute)
+}
+
+func TestPasswordAuthenticator_whenPasswordOlderThanMaxAge_thenExpired(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	users, passwords := &MockUserFinder{}, &MockPasswordStore{}
+	encoded, _ := Hash("s3cret", testParams)
+	users.On("FindUserByUsername", "strict", "anna").Return(&userDto.User{ID: "user-1", Enabled: true}, nil)
+	users.On("FindUserByUsername", "strict", "bob").Return(&userDto.User{ID: "user-2", Enabled: true}, nil)
+	passwords.On("FindPassword", "strict", "user-1").Return(passwordCredential(encoded, time.Now().AddDate(0, 0, -91)), nil)
+	passwords.On("FindPassword", "strict", "user-2").Return(passwordCredential(encoded, time.Now().AddDate(0, 0, -89)), nil)
+	authenticator := NewPasswordAuthenticator(testRealms, users, passwords, nil)
+
+	// act
+	expiredUser, expired := authenticator.Authenticate("strict", "anna", "s3cret")
+	_, valid := authenticator.Authenticate("strict", "bob", "s3cret")
+
+	// assert
+	a.Equal(ErrPasswordExpired, expired)
+	a.Equal("user-1", expiredUser.ID)
+	a.NoError(valid)
+}
@@ -0,0 +1,90 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// prefixLength is the length of the SHA-1 prefixes of the k-anonymity range API of Pwned Passwords
+const prefixLength = 5
+
+type breachedPasswords struct {
+	// suffixes holds the sorted hash suffixes of each prefix, like the range API answers them
+	suffixes map[string][]string
+}
+
+// LoadBreachedPasswords reads a denylist of breached passwords. Each line is an upper case hex SHA-1 hash of a password,
+// optionally followed by :<count>. Lines of range API responses, which hold only the suffix, follow a line naming
+// their prefix, e.g. a file of "#21BD1" followed by the response of /range/21BD1.
+func LoadBreachedPasswords(path string) (*breachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	bp := &breachedPasswords{suffixes: map[string][]string{}}
+	prefix := ""
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.ToUpper(strings.TrimSpace(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			prefix = strings.TrimPrefix(line, "#")
+			if len(prefix) != prefixLength || !isHex(prefix) {
+				return nil, fmt.Errorf("%s:%d: invalid hash prefix %s", path, number, prefix)
+			}
+			continue
+		}
+		hash := strings.SplitN(line, ":", 2)[0]
+		switch {
+		case len(hash) == 2*sha1.Size && isHex(hash):
+			bp.add(hash[:prefixLength], hash[prefixLength:])
+		case len(hash) == 2*sha1.Size-prefixLength && isHex(hash) && prefix != "":
+			bp.add(prefix, hash)
+		default:
+			return nil, fmt.Errorf("%s:%d: expected a SHA-1 hash or the suffix of one after a #prefix line", path, number)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, suffixes := range bp.suffixes {
+		sort.Strings(suffixes)
+	}
+	return bp, nil
+}
+
+func (bp *breachedPasswords) add(prefix string, suffix string) {
+	bp.suffixes[prefix] = append(bp.suffixes[prefix], suffix)
+}
+
+// Contains reports whether the password is on the denylist
+func (bp *breachedPasswords) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes := bp.suffixes[hash[:prefixLength]]
+	i := sort.SearchStrings(suffixes, hash[prefixLength:])
+	return i < len(suffixes) && suffixes[i] == hash[prefixLength:]
+}
+
+// Len returns the number of passwords on the denylist
+func (bp *breachedPasswords) Len() int {
+	count := 0
+	for _, suffixes := range bp.suffixes {
+		count += len(suffixes)
+	}
+	return count
+}
+
+// isHex reports whether the upper cased value consists of hex digits only
+func isHex(value string) bool {
+	return strings.Trim(value, "0123456789ABCDEF") == ""
+}
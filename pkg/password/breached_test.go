@@ -0,0 +1,49 @@
+package password
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeDenylist(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "breached")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.WriteString(content)
+	return file.Name()
+}
+
+func TestLoadBreachedPasswords_whenHashesAndRanges_thenContainTheirPasswords(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	// SHA-1 of "password" and of "123456", the latter as a range API response of prefix 7C4A8
+	path := writeDenylist(t, "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n\n#7c4a8\nD09CA3762AF61E59520943DC26494F8941B:37359195\n")
+	defer os.Remove(path)
+
+	// act
+	breached, err := LoadBreachedPasswords(path)
+
+	// assert
+	a.NoError(err)
+	a.Equal(2, breached.Len())
+	a.True(breached.Contains("password"))
+	a.True(breached.Contains("123456"))
+	a.False(breached.Contains("correct horse battery staple"))
+}
+
+func TestLoadBreachedPasswords_whenSuffixWithoutPrefix_thenError(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	path := writeDenylist(t, "D09CA3762AF61E59520943DC26494F8941B:37359195\n")
+	defer os.Remove(path)
+
+	// act
+	_, err := LoadBreachedPasswords(path)
+
+	// assert
+	a.Error(err)
+}
@@ -0,0 +1,163 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"hash"
+	"strings"
+)
+
+const (
+	saltLength = 16
+	keyLength  = 32
+)
+
+// Bounds of the argon2id parameters a realm may choose
+const (
+	minMemory      = 8 * 1024
+	maxMemory      = 1024 * 1024
+	maxIterations  = 16
+	maxParallelism = 16
+)
+
+// ErrUnknownFormat is returned for stored hashes of none of the supported algorithms
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// Params are the argon2id parameters of new password hashes
+type Params struct {
+	// Memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultParams follow the OWASP recommendation for argon2id
+var DefaultParams = Params{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+// ParamsOf returns the parameters of the realm, using the defaults for those it does not set
+func ParamsOf(hashing realmDto.PasswordHashing) Params {
+	params := DefaultParams
+	if hashing.Memory != 0 {
+		params.Memory = hashing.Memory
+	}
+	if hashing.Iterations != 0 {
+		params.Iterations = hashing.Iterations
+	}
+	if hashing.Parallelism != 0 {
+		params.Parallelism = hashing.Parallelism
+	}
+	return params
+}
+
+// Validate keeps the parameters between a minimum strength and what a login can afford
+func (p Params) Validate() error {
+	if p.Memory < minMemory || p.Memory > maxMemory {
+		return fmt.Errorf("argon2id memory must be from %d to %d KiB", minMemory, maxMemory)
+	}
+	if p.Iterations < 1 || p.Iterations > maxIterations {
+		return fmt.Errorf("argon2id iterations must be from 1 to %d", maxIterations)
+	}
+	if p.Parallelism < 1 || p.Parallelism > maxParallelism {
+		return fmt.Errorf("argon2id parallelism must be from 1 to %d", maxParallelism)
+	}
+	return nil
+}
+
+// Hash hashes the password with argon2id and a random salt into the PHC string format
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+func Hash(password string, params Params) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, keyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify compares the password with the stored hash in constant time. Besides argon2id it verifies bcrypt hashes
+// ($2a$, $2b$, $2y$) and PBKDF2 hashes ($pbkdf2-sha1$, $pbkdf2-sha256$ or $pbkdf2-sha512$i=<iterations>$<salt>$<key>)
+// of imported users. outdated tells that a matching hash should be replaced by one with the params.
+func Verify(encoded string, password string, params Params) (match bool, outdated bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return verifyArgon2id(encoded, password, params)
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		return err == nil, true, err
+	case strings.HasPrefix(encoded, "$pbkdf2-"):
+		match, err := verifyPBKDF2(encoded, password)
+		return match, true, err
+	}
+	return false, false, ErrUnknownFormat
+}
+
+func verifyArgon2id(encoded string, password string, params Params) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownFormat
+	}
+	var version int
+	var stored Params
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, ErrUnknownFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &stored.Memory, &stored.Iterations, &stored.Parallelism); err != nil {
+		return false, false, ErrUnknownFormat
+	}
+	salt, saltErr := base64.RawStdEncoding.DecodeString(parts[4])
+	key, keyErr := base64.RawStdEncoding.DecodeString(parts[5])
+	if saltErr != nil || keyErr != nil || version != argon2.Version || stored.Iterations < 1 || stored.Parallelism < 1 || len(key) == 0 {
+		return false, false, ErrUnknownFormat
+	}
+	computed := argon2.IDKey([]byte(password), salt, stored.Iterations, stored.Memory, stored.Parallelism, uint32(len(key)))
+	match := subtle.ConstantTimeCompare(key, computed) == 1
+	return match, match && (stored != params || len(salt) < saltLength || len(key) < keyLength), nil
+}
+
+func verifyPBKDF2(encoded string, password string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return false, ErrUnknownFormat
+	}
+	var digest func() hash.Hash
+	switch parts[1] {
+	case "pbkdf2-sha1":
+		digest = sha1.New
+	case "pbkdf2-sha256":
+		digest = sha256.New
+	case "pbkdf2-sha512":
+		digest = sha512.New
+	default:
+		return false, ErrUnknownFormat
+	}
+	var iterations int
+	if _, err := fmt.Sscanf(parts[2], "i=%d", &iterations); err != nil || iterations < 1 {
+		return false, ErrUnknownFormat
+	}
+	salt, saltErr := decodeBase64(parts[3])
+	key, keyErr := decodeBase64(parts[4])
+	if saltErr != nil || keyErr != nil || len(key) == 0 {
+		return false, ErrUnknownFormat
+	}
+	computed := pbkdf2.Key([]byte(password), salt, iterations, len(key), digest)
+	return subtle.ConstantTimeCompare(key, computed) == 1, nil
+}
+
+// decodeBase64 accepts padded and unpadded standard base64, as exporting systems differ
+func decodeBase64(value string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+}
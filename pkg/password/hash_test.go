@@ -0,0 +1,73 @@
+package password
+
+import (
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+// testParams keep the tests fast, realms cannot choose that little memory
+var testParams = Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestHash_whenVerifiedWithSameParams_thenMatchAndUpToDate(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	encoded, err := Hash("s3cret", testParams)
+	a.NoError(err)
+
+	// act
+	match, outdated, err := Verify(encoded, "s3cret", testParams)
+	wrong, _, wrongErr := Verify(encoded, "S3cret", testParams)
+	_, stronger, _ := Verify(encoded, "s3cret", Params{Memory: 2048, Iterations: 1, Parallelism: 1})
+
+	// assert
+	a.NoError(err)
+	a.Regexp(`^\$argon2id\$v=19\$m=1024,t=1,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`, encoded)
+	a.True(match)
+	a.False(outdated)
+	a.NoError(wrongErr)
+	a.False(wrong)
+	a.True(stronger)
+}
+
+func TestVerify_whenImportedHash_thenMatchAndOutdated(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	a.NoError(err)
+	pbkdf2Hash := "$pbkdf2-sha256$i=1000$TmFDbE5hQ2xOYUNsTmFDbA==$UWnL9HIo9UScEY3sWjBpmwWNrnvrSzIGT0kBZEANrEA="
+
+	// act
+	bcryptMatch, bcryptOutdated, bcryptErr := Verify(string(bcryptHash), "s3cret", testParams)
+	bcryptWrong, _, bcryptWrongErr := Verify(string(bcryptHash), "wrong", testParams)
+	pbkdf2Match, pbkdf2Outdated, pbkdf2Err := Verify(pbkdf2Hash, "s3cret", testParams)
+	pbkdf2Wrong, _, _ := Verify(pbkdf2Hash, "wrong", testParams)
+	_, _, unknownErr := Verify("{SHA}abc", "s3cret", testParams)
+
+	// assert
+	a.NoError(bcryptErr)
+	a.True(bcryptMatch)
+	a.True(bcryptOutdated)
+	a.NoError(bcryptWrongErr)
+	a.False(bcryptWrong)
+	a.NoError(pbkdf2Err)
+	a.True(pbkdf2Match)
+	a.True(pbkdf2Outdated)
+	a.False(pbkdf2Wrong)
+	a.Equal(ErrUnknownFormat, unknownErr)
+}
+
+func TestParamsOf_whenRealmSetsSomeParams_thenDefaultTheOthers(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+
+	// act
+	params := ParamsOf(realmDto.PasswordHashing{Memory: 64 * 1024})
+	weak := ParamsOf(realmDto.PasswordHashing{Memory: 1024}).Validate()
+
+	// assert
+	a.Equal(Params{Memory: 64 * 1024, Iterations: DefaultParams.Iterations, Parallelism: DefaultParams.Parallelism}, params)
+	a.NoError(params.Validate())
+	a.Error(weak)
+}
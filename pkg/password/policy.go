@@ -0,0 +1,107 @@
+package password
+
+import (
+	"fmt"
+	credentialDto "github.com/NerdShoreDev/YEP/server/pkg/credential/dto"
+	realmDto "github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	userDto "github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Bounds of the password policy settings
+const (
+	// MaxHistory bounds the history, as setting a password hashes it once for every remembered password
+	MaxHistory = 24
+	// MaxMinLength leaves room for passphrases without letting hashing work on huge inputs
+	MaxMinLength = 256
+	// minNameLength keeps short usernames from ruling out most passwords
+	minNameLength = 3
+)
+
+// BreachedList is a denylist of breached passwords
+type BreachedList interface {
+	Contains(password string) bool
+}
+
+// PolicyError lists the rules of the realm's password policy a new password breaks
+type PolicyError struct {
+	Violations []string
+}
+
+func (pe *PolicyError) Error() string {
+	return strings.Join(pe.Violations, "; ")
+}
+
+// ValidatePolicy checks the settings of a password policy
+func ValidatePolicy(policy realmDto.PasswordPolicy) error {
+	if policy.MinLength < 0 || policy.MinLength > MaxMinLength {
+		return fmt.Errorf("password minimum length must be from 0 to %d", MaxMinLength)
+	}
+	if policy.History < 0 || policy.History > MaxHistory {
+		return fmt.Errorf("password history must be from 0 to %d", MaxHistory)
+	}
+	if policy.MaxAgeDays < 0 {
+		return fmt.Errorf("password maximum age must not be negative")
+	}
+	return nil
+}
+
+// CheckPolicy returns the rules the password breaks, except for the history, which needs the stored hashes
+func CheckPolicy(policy realmDto.PasswordPolicy, user *userDto.User, password string, breached BreachedList) []string {
+	violations := []string{}
+	if length := utf8.RuneCountInString(password); length < policy.MinLength {
+		violations = append(violations, fmt.Sprintf("password must be at least %d characters long", policy.MinLength))
+	}
+	var lower, upper, digit, special bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			special = true
+		}
+	}
+	if policy.RequireLowercase && !lower {
+		violations = append(violations, "password must contain a lowercase letter")
+	}
+	if policy.RequireUppercase && !upper {
+		violations = append(violations, "password must contain an uppercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		violations = append(violations, "password must contain a digit")
+	}
+	if policy.RequireSpecial && !special {
+		violations = append(violations, "password must contain a special character")
+	}
+	if policy.NotUsername && user != nil && containsName(password, user) {
+		violations = append(violations, "password must not contain the username or email")
+	}
+	if policy.NotBreached && breached != nil && breached.Contains(password) {
+		violations = append(violations, "password appears in a data breach, choose another one")
+	}
+	return violations
+}
+
+// containsName reports whether the password contains the username or the local part of the email, ignoring case
+func containsName(password string, user *userDto.User) bool {
+	folded := userDto.Normalize(password)
+	for _, name := range []string{user.Username, strings.SplitN(user.Email, "@", 2)[0]} {
+		name = userDto.Normalize(name)
+		if utf8.RuneCountInString(name) >= minNameLength && strings.Contains(folded, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the password is older than the policy allows. Passwords of unknown age never expire.
+func Expired(policy realmDto.PasswordPolicy, password *credentialDto.Password, now time.Time) bool {
+	return policy.MaxAgeDays > 0 && !password.ChangedAt.IsZero() && now.After(password.ChangedAt.AddDate(0, 0, policy.MaxAgeDays))
+}
@@ -0,0 +1,99 @@
+package dto
+
+import "time"
+
+// Realm is a tenant of the authorization server with its own clients, users, keys and endpoints
+type Realm struct {
+	Name        string `bson:"name" json:"name"`
+	DisplayName string `bson:"displayName" json:"displayName"`
+	// Enabled realms answer requests, disabled ones are treated as unknown
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// AccessTokenLifetime and IDTokenLifetime are in seconds, 0 uses the server's lifetime
+	AccessTokenLifetime int64 `bson:"accessTokenLifetime" json:"accessTokenLifetime"`
+	IDTokenLifetime     int64 `bson:"idTokenLifetime" json:"idTokenLifetime"`
+	// SigningAlgorithms are the algorithms tokens of the realm may be signed with, the preferred one first
+	SigningAlgorithms []string `bson:"signingAlgorithms" json:"signingAlgorithms"`
+	// PasswordHashing sets the argon2id parameters of new password hashes, zero values use the defaults
+	PasswordHashing PasswordHashing `bson:"passwordHashing" json:"passwordHashing"`
+	// PasswordPolicy is checked whenever a user of the realm gets a new password
+	PasswordPolicy PasswordPolicy `bson:"passwordPolicy" json:"passwordPolicy"`
+	// BruteForceProtection slows down and locks out failing logins
+	BruteForceProtection BruteForceProtection `bson:"bruteForceProtection" json:"bruteForceProtection"`
+	// ScopeMappings add scopes releasing user attributes as claims or replace the standard OpenID Connect scopes
+	ScopeMappings []ScopeMapping `bson:"scopeMappings" json:"scopeMappings"`
+	// AuthorizationDetailTypes are the types of the authorization_details request parameter the realm accepts
+	AuthorizationDetailTypes []AuthorizationDetailType `bson:"authorizationDetailTypes" json:"authorizationDetailTypes"`
+	// Theme names the look of the realm's login pages
+	Theme     string    `bson:"theme" json:"theme"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// ScopeMapping lists the claims a scope releases
+type ScopeMapping struct {
+	Scope       string         `bson:"scope" json:"scope"`
+	Description string         `bson:"description,omitempty" json:"description,omitempty"`
+	Claims      []ClaimMapping `bson:"claims" json:"claims"`
+}
+
+// ClaimMapping releases a user attribute as claim in ID tokens, userinfo responses or both
+type ClaimMapping struct {
+	Claim     string `bson:"claim" json:"claim"`
+	Attribute string `bson:"attribute" json:"attribute"`
+	IDToken   bool   `bson:"idToken" json:"idToken"`
+	UserInfo  bool   `bson:"userInfo" json:"userInfo"`
+}
+
+// AuthorizationDetailType describes the members of one authorization details type. Actions, locations and datatypes
+// restrict the common members when set; type specific members must be listed as required or optional fields.
+type AuthorizationDetailType struct {
+	Type           string   `bson:"type" json:"type"`
+	Description    string   `bson:"description,omitempty" json:"description,omitempty"`
+	Actions        []string `bson:"actions,omitempty" json:"actions,omitempty"`
+	Locations      []string `bson:"locations,omitempty" json:"locations,omitempty"`
+	Datatypes      []string `bson:"datatypes,omitempty" json:"datatypes,omitempty"`
+	RequiredFields []string `bson:"requiredFields,omitempty" json:"requiredFields,omitempty"`
+	OptionalFields []string `bson:"optionalFields,omitempty" json:"optionalFields,omitempty"`
+}
+
+// PasswordHashing holds the argon2id parameters. Stored hashes with other parameters are upgraded at the next login.
+type PasswordHashing struct {
+	// Memory in KiB
+	Memory      uint32 `bson:"memory" json:"memory"`
+	Iterations  uint32 `bson:"iterations" json:"iterations"`
+	Parallelism uint8  `bson:"parallelism" json:"parallelism"`
+}
+
+// PasswordPolicy holds the rules for new passwords, zero values disable a rule
+type PasswordPolicy struct {
+	MinLength        int  `bson:"minLength" json:"minLength"`
+	RequireLowercase bool `bson:"requireLowercase" json:"requireLowercase"`
+	RequireUppercase bool `bson:"requireUppercase" json:"requireUppercase"`
+	RequireDigit     bool `bson:"requireDigit" json:"requireDigit"`
+	RequireSpecial   bool `bson:"requireSpecial" json:"requireSpecial"`
+	// NotUsername rejects passwords containing the username or the local part of the email
+	NotUsername bool `bson:"notUsername" json:"notUsername"`
+	// History is the number of previous passwords which cannot be used again
+	History int `bson:"history" json:"history"`
+	// MaxAgeDays makes users change their password after as many days
+	MaxAgeDays int `bson:"maxAgeDays" json:"maxAgeDays"`
+	// NotBreached rejects passwords of the breached password denylist
+	NotBreached bool `bson:"notBreached" json:"notBreached"`
+}
+
+// BruteForceProtection holds the thresholds of failed logins, durations are in seconds and zero values disable a step
+type BruteForceProtection struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// FailureWindow forgets failures older than it, when 0 they count until a successful login or a day without failures
+	FailureWindow int64 `bson:"failureWindow" json:"failureWindow"`
+	// MinDelay is the wait after the first failure of a user, doubling with each further failure up to MaxDelay
+	MinDelay int64 `bson:"minDelay" json:"minDelay"`
+	MaxDelay int64 `bson:"maxDelay" json:"maxDelay"`
+	// MaxFailures failures of a user lock it out for LockoutDuration
+	MaxFailures     int   `bson:"maxFailures" json:"maxFailures"`
+	LockoutDuration int64 `bson:"lockoutDuration" json:"lockoutDuration"`
+	// MaxLockouts temporary lockouts without a successful login in between lock the user out until an admin unlocks it
+	MaxLockouts int `bson:"maxLockouts" json:"maxLockouts"`
+	// MaxIPFailures failures from one source address, whatever the user, block the address for LockoutDuration
+	MaxIPFailures int `bson:"maxIpFailures" json:"maxIpFailures"`
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/realm/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const realmCollection = "realms"
+
+type realmStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewRealmStorage creates the Mongo backed storage of realms
+func NewRealmStorage(dbWrapper *db.DatabaseWrapper) *realmStorage {
+	return &realmStorage{
+		collection:   dbWrapper.Database.Collection(realmCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique index on the realm name
+func (rs *realmStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := rs.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// FindRealm returns the realm with the name or nil if there is none
+func (rs *realmStorage) FindRealm(name string) (*dto.Realm, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	var realm dto.Realm
+	err := rs.collection.FindOne(ctx, bson.M{"name": name}).Decode(&realm)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &realm, nil
+}
+
+// FindRealms returns the page of realms matching the query ordered by name and the number of all matching realms
+func (rs *realmStorage) FindRealms(query db.Query) ([]*dto.Realm, int64, error) {
+	realms := []*dto.Realm{}
+	total, err := db.FindPage(rs.collection, rs.queryTimeout, query.Match(bson.M{}, "name", "displayName"), "name", query, &realms)
+	return realms, total, err
+}
+
+// CreateRealm stores a new realm
+func (rs *realmStorage) CreateRealm(realm *dto.Realm) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	realm.CreatedAt = time.Now().UTC()
+	realm.UpdatedAt = realm.CreatedAt
+	_, err := rs.collection.InsertOne(ctx, realm)
+	return err
+}
+
+// UpdateRealm overwrites the settings of the realm, keeping its name and creation time
+func (rs *realmStorage) UpdateRealm(realm *dto.Realm) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	realm.UpdatedAt = time.Now().UTC()
+	update := bson.M{"$set": bson.M{
+		"displayName":              realm.DisplayName,
+		"enabled":                  realm.Enabled,
+		"accessTokenLifetime":      realm.AccessTokenLifetime,
+		"idTokenLifetime":          realm.IDTokenLifetime,
+		"signingAlgorithms":        realm.SigningAlgorithms,
+		"passwordHashing":          realm.PasswordHashing,
+		"passwordPolicy":           realm.PasswordPolicy,
+		"bruteForceProtection":     realm.BruteForceProtection,
+		"scopeMappings":            realm.ScopeMappings,
+		"authorizationDetailTypes": realm.AuthorizationDetailTypes,
+		"theme":                    realm.Theme,
+		"updatedAt":                realm.UpdatedAt,
+	}}
+	result, err := rs.collection.UpdateOne(ctx, bson.M{"name": realm.Name}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteRealm removes the realm
+func (rs *realmStorage) DeleteRealm(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	result, err := rs.collection.DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// EnsureRealm creates the realm unless one with its name exists already
+func (rs *realmStorage) EnsureRealm(realm *dto.Realm) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	realm.CreatedAt = now
+	realm.UpdatedAt = now
+	_, err := rs.collection.UpdateOne(ctx, bson.M{"name": realm.Name}, bson.M{"$setOnInsert": realm}, options.Update().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,12 @@
+package dto
+
+import "time"
+
+// Role is a realm role granted to users directly or through groups
+type Role struct {
+	Realm       string    `bson:"realm" json:"realm"`
+	Name        string    `bson:"name" json:"name"`
+	Description string    `bson:"description" json:"description"`
+	CreatedAt   time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time `bson:"updatedAt" json:"updatedAt"`
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/role/dto"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const roleCollection = "roles"
+
+type roleStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewRoleStorage creates the Mongo backed storage of realm roles
+func NewRoleStorage(dbWrapper *db.DatabaseWrapper) *roleStorage {
+	return &roleStorage{
+		collection:   dbWrapper.Database.Collection(roleCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique index on realm and role name
+func (rs *roleStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := rs.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "realm", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// FindRole returns the role of the realm or nil if there is none
+func (rs *roleStorage) FindRole(realm string, name string) (*dto.Role, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	var role dto.Role
+	err := rs.collection.FindOne(ctx, bson.M{"realm": realm, "name": name}).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// FindRoles returns the page of roles of the realm matching the query and the number of all matching roles
+func (rs *roleStorage) FindRoles(realm string, query db.Query) ([]*dto.Role, int64, error) {
+	roles := []*dto.Role{}
+	total, err := db.FindPage(rs.collection, rs.queryTimeout, query.Match(bson.M{"realm": realm}, "name", "description"), "name", query, &roles)
+	return roles, total, err
+}
+
+// CreateRole stores a new role
+func (rs *roleStorage) CreateRole(role *dto.Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	role.CreatedAt = time.Now().UTC()
+	role.UpdatedAt = role.CreatedAt
+	_, err := rs.collection.InsertOne(ctx, role)
+	return err
+}
+
+// UpdateRole overwrites the description of the role
+func (rs *roleStorage) UpdateRole(role *dto.Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	role.UpdatedAt = time.Now().UTC()
+	update := bson.M{"$set": bson.M{"description": role.Description, "updatedAt": role.UpdatedAt}}
+	result, err := rs.collection.UpdateOne(ctx, bson.M{"realm": role.Realm, "name": role.Name}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteRole removes the role
+func (rs *roleStorage) DeleteRole(realm string, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	result, err := rs.collection.DeleteOne(ctx, bson.M{"realm": realm, "name": name})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteRoles removes all roles of the realm
+func (rs *roleStorage) DeleteRoles(realm string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := rs.collection.DeleteMany(ctx, bson.M{"realm": realm})
+	return err
+}
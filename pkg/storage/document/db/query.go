@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Query selects a filtered page of documents
+type Query struct {
+	// Filter holds fields which must match exactly
+	Filter map[string]interface{}
+	// Search matches documents containing it in one of the searched fields, ignoring case
+	Search string
+	Offset int64
+	// Limit caps the page size, 0 returns all documents
+	Limit int64
+}
+
+// Match combines the scope of the documents, e.g. their realm, with the filter and search of the query
+func (q Query) Match(scope bson.M, searchFields ...string) bson.M {
+	match := bson.M{}
+	for field, value := range q.Filter {
+		match[field] = value
+	}
+	for field, value := range scope {
+		match[field] = value
+	}
+	if q.Search != "" && len(searchFields) > 0 {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q.Search), Options: "i"}
+		search := bson.A{}
+		for _, field := range searchFields {
+			search = append(search, bson.M{field: pattern})
+		}
+		match["$or"] = search
+	}
+	return match
+}
+
+// FindPage decodes the page of matching documents sorted by the field into results and counts all matching documents.
+// A sort field starting with - sorts in descending order.
+func FindPage(collection *mongo.Collection, queryTimeout time.Duration, match bson.M, sortField string, query Query, results interface{}) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout*time.Second)
+	defer cancel()
+
+	total, err := collection.CountDocuments(ctx, match)
+	if err != nil {
+		return 0, err
+	}
+	direction := 1
+	if strings.HasPrefix(sortField, "-") {
+		sortField, direction = sortField[1:], -1
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: sortField, Value: direction}}).SetSkip(query.Offset)
+	if query.Limit > 0 {
+		findOptions.SetLimit(query.Limit)
+	}
+	cursor, err := collection.Find(ctx, match, findOptions)
+	if err != nil {
+		return 0, err
+	}
+	return total, cursor.All(ctx, results)
+}
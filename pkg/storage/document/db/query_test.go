@@ -0,0 +1,25 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	query := Query{Filter: map[string]interface{}{"enabled": true, "realm": "other"}, Search: "a.b"}
+
+	// act
+	match := query.Match(bson.M{"realm": "YEP"}, "username", "email")
+
+	// assert
+	a.Equal("YEP", match["realm"])
+	a.Equal(true, match["enabled"])
+	a.Equal(bson.A{
+		bson.M{"username": primitive.Regex{Pattern: `a\.b`, Options: "i"}},
+		bson.M{"email": primitive.Regex{Pattern: `a\.b`, Options: "i"}},
+	}, match["$or"])
+}
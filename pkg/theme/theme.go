@@ -0,0 +1,169 @@
+package theme
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// Pages of a theme, each rendered inside layout.html
+const (
+	PageLogin   = "login"
+	PageConsent = "consent"
+	PageError   = "error"
+	PageLogout  = "logout"
+)
+
+const layout = "layout.html"
+
+var pages = []string{PageLogin, PageConsent, PageError, PageLogout}
+
+// validName keeps theme names from leaving the themes directory
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+//go:embed templates static
+var builtin embed.FS
+
+// theme holds the parsed pages and static files of one theme
+type theme struct {
+	pages  map[string]*template.Template
+	static fs.FS
+}
+
+type themes struct {
+	dir     string
+	builtin *theme
+	// loaded caches the themes of the directory by name, they are read once
+	loaded sync.Map
+}
+
+// NewThemes creates the themes of the login pages. The built-in theme is used for realms without theme. A realm's theme
+// is the subdirectory of dir with its name; its templates and static directories override files of the built-in
+// theme with the same name. dir may be empty if there are no custom themes.
+func NewThemes(dir string) *themes {
+	templates, _ := fs.Sub(builtin, "templates")
+	static, _ := fs.Sub(builtin, "static")
+	builtinTheme, err := parseTheme(templates, static)
+	if err != nil {
+		panic(err)
+	}
+	return &themes{dir: dir, builtin: builtinTheme}
+}
+
+// ValidName reports whether name can name a theme
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Render writes the page of the named theme. The page is rendered completely before anything is written, so a broken
+// template results in an error instead of half a page.
+func (t *themes) Render(w http.ResponseWriter, name string, page string, status int, data interface{}) error {
+	tmpl, ok := t.theme(name).pages[page]
+	if !ok {
+		return errors.New("unknown page " + page)
+	}
+	var body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&body, layout, data); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// Login and consent pages must not be framed by other sites tricking users into clicking them
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	_, err := body.WriteTo(w)
+	return err
+}
+
+// ServeStatic serves the static file of the named theme
+func (t *themes) ServeStatic(w http.ResponseWriter, r *http.Request, name string, file string) {
+	f, err := t.theme(name).static.Open(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	content, seekable := f.(io.ReadSeeker)
+	if err != nil || info.IsDir() || !seekable {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
+
+// theme returns the named theme, the built-in one for realms without theme and for themes which cannot be loaded
+func (t *themes) theme(name string) *theme {
+	if name == "" || t.dir == "" {
+		return t.builtin
+	}
+	if loaded, ok := t.loaded.Load(name); ok {
+		return loaded.(*theme)
+	}
+	loaded := t.load(name)
+	t.loaded.Store(name, loaded)
+	return loaded
+}
+
+func (t *themes) load(name string) *theme {
+	dir := filepath.Join(t.dir, name)
+	if !ValidName(name) {
+		log.Errorf("invalid theme name %q, using the built-in theme", name)
+		return t.builtin
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		log.Errorf("theme %s not found in %s, using the built-in theme", name, t.dir)
+		return t.builtin
+	}
+	custom := os.DirFS(dir)
+	templates, _ := fs.Sub(custom, "templates")
+	static, _ := fs.Sub(custom, "static")
+	builtinTemplates, _ := fs.Sub(builtin, "templates")
+	loaded, err := parseTheme(overlay{templates, builtinTemplates}, overlay{static, t.builtin.static})
+	if err != nil {
+		log.Errorf("unable to parse theme %s, using the built-in theme: %v", name, err)
+		return t.builtin
+	}
+	log.Infof("Loaded theme %s", name)
+	return loaded
+}
+
+// parseTheme parses every page together with the layout
+func parseTheme(templates fs.FS, static fs.FS) (*theme, error) {
+	parsed := &theme{pages: map[string]*template.Template{}, static: static}
+	for _, page := range pages {
+		tmpl, err := template.ParseFS(templates, layout, page+".html")
+		if err != nil {
+			return nil, err
+		}
+		parsed.pages[page] = tmpl
+	}
+	return parsed, nil
+}
+
+// overlay opens files from the first file system having them
+type overlay []fs.FS
+
+func (o overlay) Open(name string) (fs.File, error) {
+	for _, layer := range o {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
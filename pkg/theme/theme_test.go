@@ -0,0 +1,97 @@
+package theme
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testPage struct {
+	Realm       string
+	Static      string
+	Action      string
+	Interaction string
+	CSRF        string
+	Username    string
+	Error       string
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestThemes_whenRealmHasNoTheme_thenRenderBuiltinPage(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	themes := NewThemes("")
+	w := httptest.NewRecorder()
+
+	// act
+	err := themes.Render(w, "", PageLogin, http.StatusUnauthorized, &testPage{Realm: "YEP", Static: "/static", Username: "<anna>", Error: "Invalid username or password."})
+
+	// assert
+	a.NoError(err)
+	a.Equal(http.StatusUnauthorized, w.Code)
+	a.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	a.Equal("DENY", w.Header().Get("X-Frame-Options"))
+	a.Contains(w.Body.String(), `<link rel="stylesheet" href="/static/style.css">`)
+	a.Contains(w.Body.String(), `value="&lt;anna&gt;"`)
+	a.Contains(w.Body.String(), "Invalid username or password.")
+}
+
+func TestThemes_whenThemeOverridesFiles_thenFallBackToBuiltinForOthers(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "brand", "templates", "layout.html"), `<body class="brand">{{template "content" .}}</body>`)
+	writeFile(t, filepath.Join(dir, "brand", "static", "style.css"), "body { color: hotpink; }")
+	themes := NewThemes(dir)
+
+	// act
+	page := httptest.NewRecorder()
+	renderErr := themes.Render(page, "brand", PageLogin, http.StatusOK, &testPage{Realm: "YEP"})
+	style := httptest.NewRecorder()
+	themes.ServeStatic(style, httptest.NewRequest(http.MethodGet, "/style.css", nil), "brand", "style.css")
+	logo := httptest.NewRecorder()
+	themes.ServeStatic(logo, httptest.NewRequest(http.MethodGet, "/logo.svg", nil), "brand", "logo.svg")
+	escape := httptest.NewRecorder()
+	themes.ServeStatic(escape, httptest.NewRequest(http.MethodGet, "/", nil), "brand", "../templates/layout.html")
+
+	// assert
+	a.NoError(renderErr)
+	a.Contains(page.Body.String(), `<body class="brand">`)
+	a.Contains(page.Body.String(), `name="password"`)
+	a.Equal("body { color: hotpink; }", style.Body.String())
+	a.Equal(http.StatusOK, logo.Code)
+	a.Equal("image/svg+xml", logo.Header().Get("Content-Type"))
+	a.Equal(http.StatusNotFound, escape.Code)
+}
+
+func TestThemes_whenThemeMissingOrBroken_thenUseBuiltinTheme(t *testing.T) {
+	// arrange
+	a := assert.New(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "broken", "templates", "error.html"), `{{define "content"}}{{.Message{{end}}`)
+	themes := NewThemes(dir)
+
+	// act
+	for _, name := range []string{"missing", "broken", "../broken"} {
+		w := httptest.NewRecorder()
+		err := themes.Render(w, name, PageError, http.StatusBadRequest, &struct{ Realm, Static, Code, Message string }{Message: "redirect_uri not registered"})
+
+		// assert
+		a.NoError(err, name)
+		a.Contains(w.Body.String(), "redirect_uri not registered", name)
+	}
+	a.True(ValidName("brand-2024"))
+	a.False(ValidName("../broken"))
+	a.False(ValidName("Brand"))
+}
@@ -0,0 +1,43 @@
+package dto
+
+import (
+	"strings"
+	"time"
+)
+
+// User is an account of a realm
+type User struct {
+	ID       string `bson:"id" json:"id"`
+	Realm    string `bson:"realm" json:"realm"`
+	Username string `bson:"username" json:"username"`
+	// UsernameKey is the normalized username which has to be unique in the realm
+	UsernameKey string `bson:"usernameKey" json:"-"`
+	Email       string `bson:"email" json:"email"`
+	// EmailKey is the normalized email which has to be unique in the realm, missing for users without email
+	EmailKey            string `bson:"emailKey,omitempty" json:"-"`
+	EmailVerified       bool   `bson:"emailVerified" json:"emailVerified"`
+	PhoneNumber         string `bson:"phoneNumber" json:"phoneNumber"`
+	PhoneNumberVerified bool   `bson:"phoneNumberVerified" json:"phoneNumberVerified"`
+	FirstName           string `bson:"firstName" json:"firstName"`
+	LastName            string `bson:"lastName" json:"lastName"`
+	Enabled             bool   `bson:"enabled" json:"enabled"`
+	// Attributes are custom profile values, which claims mappings can add to tokens
+	Attributes map[string][]string `bson:"attributes" json:"attributes"`
+	// RealmRoles are granted directly, further roles come with the groups
+	RealmRoles []string `bson:"realmRoles" json:"realmRoles"`
+	// Groups holds the ids of the groups the user is a member of
+	Groups    []string  `bson:"groups" json:"groups"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Normalize folds a username or email for lookups and uniqueness, so Anna@Example.com and anna@example.com are the same
+func Normalize(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// SetKeys derives the normalized keys from the username and email
+func (u *User) SetKeys() {
+	u.UsernameKey = Normalize(u.Username)
+	u.EmailKey = Normalize(u.Email)
+}
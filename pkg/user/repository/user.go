@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"github.com/NerdShoreDev/YEP/server/pkg/storage/document/db"
+	"github.com/NerdShoreDev/YEP/server/pkg/user/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const userCollection = "users"
+
+type userStorage struct {
+	collection   *mongo.Collection
+	queryTimeout time.Duration
+}
+
+// NewUserStorage creates the Mongo backed storage of realm users
+func NewUserStorage(dbWrapper *db.DatabaseWrapper) *userStorage {
+	return &userStorage{
+		collection:   dbWrapper.Database.Collection(userCollection),
+		queryTimeout: dbWrapper.QueryTimeout,
+	}
+}
+
+// EnsureIndexes creates the unique indexes on realm and user id and on realm and the normalized username and email
+func (us *userStorage) EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), us.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := us.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "realm", Value: 1}, {Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "realm", Value: 1}, {Key: "usernameKey", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys:    bson.D{{Key: "realm", Value: 1}, {Key: "emailKey", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"emailKey": bson.M{"$exists": true}}),
+		},
+	})
+	return err
+}
+
+// FindUser returns the user of the realm or nil if there is none
+func (us *userStorage) FindUser(realm string, id string) (*dto.User, error) {
+	return us.findOne(bson.M{"realm": realm, "id": id})
+}
+
+// FindUserByUsername returns the user of the realm with the username, compared case-insensitively, or nil if there is none
+func (us *userStorage) FindUserByUsername(realm string, username string) (*dto.User, error) {
+	return us.findOne(bson.M{"realm": realm, "usernameKey": dto.Normalize(username)})
+}
+
+// FindUserByEmail returns the user of the realm with the email, compared case-insensitively, or nil if there is none
+func (us *userStorage) FindUserByEmail(realm string, email string) (*dto.User, error) {
+	key := dto.Normalize(email)
+	if key == "" {
+		return nil, nil
+	}
+	return us.findOne(bson.M{"realm": realm, "emailKey": key})
+}
+
+func (us *userStorage) findOne(filter bson.M) (*dto.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), us.queryTimeout*time.Second)
+	defer cancel()
+
+	var user dto.User
+	err := us.collection.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindUsers returns the page of users of the realm matching the query and the number of all matching users
+func (us *userStorage) FindUsers(realm string, query db.Query) ([]*dto.User, int64, error) {
+	users := []*dto.User{}
+	// usernames and emails are filtered by their normalized keys, like they are looked up at login
+	filter := map[string]interface{}{}
+	for field, value := range query.Filter {
+		if text, ok := value.(string); ok && (field == "username" || field == "email") {
+			field, value = field+"Key", dto.Normalize(text)
+		}
+		filter[field] = value
+	}
+	query.Filter = filter
+	total, err := db.FindPage(us.collection, us.queryTimeout, query.Match(bson.M{"realm": realm}, "username", "email", "firstName", "lastName"), "username", query, &users)
+	return users, total, err
+}
+
+// CreateUser stores a new user under a generated id
+func (us *userStorage) CreateUser(user *dto.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), us.queryTimeout*time.Second)
+	defer cancel()
+
+	user.ID = primitive.NewObjectID().Hex()
+	user.SetKeys()
+	user.CreatedAt = time.Now().UTC()
+	user.UpdatedAt = user.CreatedAt
+	_, err := us.collection.InsertOne(ctx, user)
+	return err
+}
+
+// UpdateUser overwrites the profile, roles and groups of the user
+func (us *userStorage) UpdateUser(user *dto.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), us.queryTimeout*time.Second)
+	defer cancel()
+
+	user.SetKeys()
+	user.UpdatedAt = time.Now().UTC()
+	set := bson.M{
+		"username":            user.Username,
+		"usernameKey":         user.UsernameKey,
+		"email":               user.Email,
+		"emailVerified":       user.EmailVerified,
+		"phoneNumber":         user.PhoneNumber,
+		"phoneNumberVerified": user.PhoneNumberVerified,
+		"firstName":           user.FirstName,
+		"lastName":            user.LastName,
+		"enabled":             user.Enabled,
+		"attributes":          user.Attributes,
+		"realmRoles":          user.RealmRoles,
+		"groups":              user.Groups,
+		"updatedAt":           user.UpdatedAt,
+	}
+	update := bson.M{"$set": set}
+	// users without email must not have an email key, or they would collide in the unique index
+	if user.EmailKey == "" {
+		update["$unset"] = bson.M{"emailKey": ""}
+	} else {
+		set["emailKey"] = user.EmailKey
+	}
+	result, err := us.collection.UpdateOne(ctx, bson.M{"realm": user.Realm, "id": user.ID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// RemoveRealmRole takes the role away from all users of the realm it was granted to directly
+func (us *userStorage) RemoveRealmRole(realm string, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), us.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := us.collection.UpdateMany(ctx, bson.M{"realm": realm, "realmRoles": role}, bson.M{"$pull": bson.M{"realmRoles": role}})
+	return err
+}
+
+// RemoveGroup ends the membership of all users of the realm in the group
+func (us *userStorage) RemoveGroup(realm string, groupID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), us.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := us.collection.UpdateMany(ctx, bson.M{"realm": realm, "groups": groupID}, bson.M{"$pull": bson.M{"groups": groupID}})
+	return err
+}
+
+// DeleteUser removes the user
+func (us *userStorage) DeleteUser(realm string, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), us.queryTimeout*time.Second)
+	defer cancel()
+
+	result, err := us.collection.DeleteOne(ctx, bson.M{"realm": realm, "id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeleteUsers removes all users of the realm
+func (us *userStorage) DeleteUsers(realm string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), us.queryTimeout*time.Second)
+	defer cancel()
+
+	_, err := us.collection.DeleteMany(ctx, bson.M{"realm": realm})
+	return err
+}